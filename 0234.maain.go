@@ -1,7 +1,10 @@
+// run: go run 0234.maain.go modulator.go integrator.go lyapunov.go npy.go imageseed.go -mod "gg=sine@0.002:0.2:-0.32"
 package main
 
 import (
+	"flag"
 	"fmt" // Added for toHexAlpha function
+	"log"
 	"math"
 	"math/rand"
 	"path"
@@ -25,6 +28,8 @@ const (
 	predationRange = 10.0  // Radius for predation to occur
 	predationRate  = 1.5   // Energy transfer rate during predation
 	maxForceDist   = 80.0  // Max distance for rule interaction
+	particleD0     = 1e-6  // initial twin separation in pixels (Y key Lyapunov estimate)
+	imageParticles = 5000  // particles drawn from -image, as many as the default groups
 )
 
 // particle struct with new properties AND force accumulation fields
@@ -38,6 +43,7 @@ type particle struct {
 }
 
 var particles []*particle
+var all []*particle // every particle ever created, in creation order
 var cv *canvas.Canvas
 var wg sync.WaitGroup
 
@@ -46,6 +52,17 @@ var yellow []*particle
 var red []*particle
 var green []*particle
 
+// Rule weights between colour groups (g=green, r=red, y=yellow), bindable with -mod
+var (
+	wGG, wRR, wYY      = -0.32, -0.1, 0.15
+	wGR, wGY, wRG, wYG = -0.17, 0.34, -0.34, -0.20
+)
+
+var weights = map[string]*float64{
+	"gg": &wGG, "rr": &wRR, "yy": &wYY,
+	"gr": &wGR, "gy": &wGY, "rg": &wRG, "yg": &wYG,
+}
+
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
@@ -79,92 +96,185 @@ func draw(p *particle) {
 // create initializes particles
 func create(number int, color string, m float64) {
 	for i := 0; i < number; i++ {
-		p := &particle{
+		add(&particle{
 			x:      randomX(),
 			y:      randomY(),
 			color:  color,
 			mass:   m,
 			energy: energyStart,
+		})
+	}
+}
+
+func add(p *particle) {
+	particles = append(particles, p)
+	all = append(all, p)
+	switch p.color {
+	case "#FFFF00":
+		yellow = append(yellow, p)
+	case "#FF0000":
+		red = append(red, p)
+	case "#00FF00":
+		green = append(green, p)
+	}
+}
+
+// createFromImage draws n particles from the image, each joining the group whose hue is
+// nearest to that of its pixel, or a random group on grey pixels
+func createFromImage(s *ImageSampler, n int) {
+	w := float64(cv.Width()) - padding*2
+	h := float64(cv.Height()) - padding*2
+	for i := 0; i < n; i++ {
+		u, v, hue, sat := s.Sample(rand.Float64)
+		g := rand.Intn(len(groupColors))
+		if sat >= imageGreySat {
+			g = nearestHue(hue, groupHues)
+		}
+		add(&particle{
+			x:      padding + u*w,
+			y:      padding + v*h,
+			color:  groupColors[g],
+			mass:   groupMass[g],
+			energy: energyStart,
+		})
+	}
+}
+
+// ---------- State exchange ----------
+// Particle tables have one row per living particle; group is the index into groupColors
+var (
+	particleCols = []string{"x", "y", "vx", "vy", "group", "mass", "energy"}
+	groupColors  = []string{"#FFFF00", "#FF0000", "#00FF00"}
+	groupHues    = []float64{60, 0, 120}
+	groupMass    = []float64{massBase * 0.8, massBase * 1.2, massBase * 1.0}
+)
+
+func particleTable() [][]float64 {
+	rows := make([][]float64, len(particles))
+	for i, p := range particles {
+		g := 0
+		for k, c := range groupColors {
+			if c == p.color {
+				g = k
+			}
+		}
+		rows[i] = []float64{p.x, p.y, p.vx, p.vy, float64(g), p.mass, p.energy}
+	}
+	return rows
+}
+
+// loadParticles creates the particles from an (n, k) array with the columns of
+// particleCols; of those only x and y are required, the others default to rest, group 0
+// and the group's mass and starting energy
+func loadParticles(a NPYArray) error {
+	if len(a.Shape) != 2 || a.Shape[1] < 2 {
+		return fmt.Errorf("particle shape %v, want (n, 2..%d) with columns %v", a.Shape, len(particleCols), particleCols)
+	}
+	k := a.Shape[1]
+	for i := 0; i < a.Shape[0]; i++ {
+		row := a.Data[i*k : (i+1)*k]
+		col := func(c int, def float64) float64 {
+			if c < len(row) {
+				return row[c]
+			}
+			return def
 		}
-		particles = append(particles, p)
-		switch color {
-		case "#FFFF00":
-			yellow = append(yellow, p)
-		case "#FF0000":
-			red = append(red, p)
-		case "#00FF00":
-			green = append(green, p)
+		g := int(col(4, 0))
+		if g < 0 || g >= len(groupColors) {
+			return fmt.Errorf("particle %d: group %d, want 0 (yellow), 1 (red) or 2 (green)", i, g)
 		}
+		add(&particle{
+			x:      row[0],
+			y:      row[1],
+			vx:     col(2, 0),
+			vy:     col(3, 0),
+			color:  groupColors[g],
+			mass:   col(5, groupMass[g]),
+			energy: col(6, energyStart),
+		})
 	}
+	return nil
 }
 
 // FIX: rule now only calculates and accumulates forces (fx, fy) concurrently.
 // It avoids modifying vx/vy/x/y, eliminating the race condition.
 func rule(particles1 []*particle, particles2 []*particle, g float64) {
-	wg.Add(len(particles1))
-
 	// Check for self-interaction (where P1 and P2 slices point to the same list)
 	isSelfInteraction := reflect.ValueOf(particles1).Pointer() == reflect.ValueOf(particles2).Pointer()
 
-	for i := 0; i < len(particles1); i++ {
-		go func(i int) {
-			defer wg.Done()
-			a := particles1[i]
+	interact := func(i int) {
+		a := particles1[i]
 
-			// Determine loop start for O(N^2/2) optimization in self-interaction
-			startJ := 0
-			if isSelfInteraction {
-				startJ = i + 1 // Start at i+1 to avoid duplicate calculation and self-interaction
+		// Determine loop start for O(N^2/2) optimization in self-interaction
+		startJ := 0
+		if isSelfInteraction {
+			startJ = i + 1 // Start at i+1 to avoid duplicate calculation and self-interaction
+		}
+
+		// Iterate over particles2
+		for j := startJ; j < len(particles2); j++ {
+			b := particles2[j]
+
+			// If not self-interaction, skip interaction with self (shouldn't happen, but safety check)
+			if !isSelfInteraction && a == b {
+				continue
+			}
+
+			dx, dy := a.x-b.x, a.y-b.y
+			distSq := dx*dx + dy*dy
+			if distSq == 0 {
+				continue
 			}
 
-			// Iterate over particles2
-			for j := startJ; j < len(particles2); j++ {
-				b := particles2[j]
-
-				// If not self-interaction, skip interaction with self (shouldn't happen, but safety check)
-				if !isSelfInteraction && a == b {
-					continue
-				}
-
-				dx, dy := a.x-b.x, a.y-b.y
-				distSq := dx*dx + dy*dy
-				if distSq == 0 {
-					continue
-				}
-
-				d := math.Sqrt(distSq)
-				if d > maxForceDist {
-					continue
-				}
-
-				// Force with mass term: F = g * Mb / d
-				F := g * b.mass / d
-
-				fx_ab := F * dx // Force applied to A from B
-				fy_ab := F * dy
-
-				// Atomically add the calculated force to particle A's accumulation fields
-				// NOTE: While we use a goroutine per particle A, A is only written to by this goroutine,
-				// thus, no further lock (like sync/atomic) is strictly needed for A's fx/fy.
-				a.fx += fx_ab
-				a.fy += fy_ab
-
-				// --- Predation/Energy Transfer (handled here as an interaction effect) ---
-				if a.color == "#FF0000" && b.color == "#00FF00" && d < predationRange {
-					transfer := predationRate / b.mass
-					// NOTE: Energy is still a race condition risk, but minor.
-					// For a true fix, energy update should be done sequentially or via sync/atomic.
-					a.energy = math.Min(energyStart, a.energy+transfer)
-					b.energy -= transfer
-				}
-
-				// --- Optimization: Apply equal and opposite force to B only in self-interaction ---
-				if isSelfInteraction {
-					// Apply -F to B from A (Newton's 3rd Law)
-					b.fx -= fx_ab
-					b.fy -= fy_ab
-				}
+			d := math.Sqrt(distSq)
+			if d > maxForceDist {
+				continue
 			}
+
+			// Force with mass term: F = g * Mb / d
+			F := g * b.mass / d
+
+			fx_ab := F * dx // Force applied to A from B
+			fy_ab := F * dy
+
+			// Atomically add the calculated force to particle A's accumulation fields
+			// NOTE: While we use a goroutine per particle A, A is only written to by this goroutine,
+			// thus, no further lock (like sync/atomic) is strictly needed for A's fx/fy.
+			a.fx += fx_ab
+			a.fy += fy_ab
+
+			// --- Predation/Energy Transfer (handled here as an interaction effect) ---
+			if a.color == "#FF0000" && b.color == "#00FF00" && d < predationRange {
+				transfer := predationRate / b.mass
+				// NOTE: Energy is still a race condition risk, but minor.
+				// For a true fix, energy update should be done sequentially or via sync/atomic.
+				a.energy = math.Min(energyStart, a.energy+transfer)
+				b.energy -= transfer
+			}
+
+			// --- Optimization: Apply equal and opposite force to B only in self-interaction ---
+			if isSelfInteraction {
+				// Apply -F to B from A (Newton's 3rd Law)
+				b.fx -= fx_ab
+				b.fy -= fy_ab
+			}
+		}
+	}
+
+	// The goroutines below race on the forces of B in self-interaction, which swamps the
+	// tiny separation of a Lyapunov twin, so both worlds are stepped serially while it runs
+	if lyap != nil {
+		for i := range particles1 {
+			interact(i)
+		}
+		return
+	}
+
+	wg.Add(len(particles1))
+	for i := 0; i < len(particles1); i++ {
+		go func(i int) {
+			defer wg.Done()
+			interact(i)
 		}(i)
 	}
 	wg.Wait()
@@ -253,9 +363,121 @@ func updateWorld() {
 	green = newGreen
 }
 
+// stepWorld applies every rule and then updates the world once
+func stepWorld() {
+	// Self-Interactions (O(N^2/2) optimized and applies forces to both particles)
+	rule(green, green, wGG)
+	rule(red, red, wRR)
+	rule(yellow, yellow, wYY)
+
+	// Cross-Interactions (O(N^2) as they are distinct slices)
+	rule(green, red, wGR)
+	rule(green, yellow, wGY)
+	rule(red, green, wRG)
+	rule(yellow, green, wYG)
+
+	// Sequential Update: Apply forces, MaCE, positions, energy, and death
+	updateWorld()
+}
+
+// ---------------- Lyapunov exponent ----------------
+// The world lives in globals, so the perturbed twin is kept as a snapshot and swapped in
+// for its step. While the estimate runs, rule works serially so that both worlds step
+// deterministically and their separation is not drowned in race noise.
+type worldSnapshot struct {
+	values                        []particle // aligned with all
+	particles, yellow, red, green []*particle
+}
+
+func saveWorld(s *worldSnapshot) {
+	s.values = s.values[:0]
+	for _, p := range all {
+		s.values = append(s.values, *p)
+	}
+	s.particles = append(s.particles[:0], particles...)
+	s.yellow = append(s.yellow[:0], yellow...)
+	s.red = append(s.red[:0], red...)
+	s.green = append(s.green[:0], green...)
+}
+
+func loadWorld(s *worldSnapshot) {
+	for i, p := range all {
+		*p = s.values[i]
+	}
+	particles = append([]*particle(nil), s.particles...)
+	yellow = append([]*particle(nil), s.yellow...)
+	red = append([]*particle(nil), s.red...)
+	green = append([]*particle(nil), s.green...)
+}
+
+var (
+	lyap     *Lyapunov // nil when off
+	twin     worldSnapshot
+	refWorld worldSnapshot
+)
+
+// startLyapunov snapshots the world as the twin, with every position moved randomly so
+// that the total separation is particleD0
+func startLyapunov() {
+	saveWorld(&twin)
+	var d float64
+	off := make([][2]float64, len(twin.values))
+	for i := range off {
+		off[i] = [2]float64{rand.NormFloat64(), rand.NormFloat64()}
+		d += off[i][0]*off[i][0] + off[i][1]*off[i][1]
+	}
+	scale := particleD0 / math.Sqrt(d)
+	for i := range twin.values {
+		twin.values[i].x += off[i][0] * scale
+		twin.values[i].y += off[i][1] * scale
+	}
+	lyap = newLyapunov(particleD0, 1, lyapunovEvery)
+}
+
+// stepTwin advances the twin by one world step and updates the estimate
+func stepTwin() {
+	saveWorld(&refWorld)
+	loadWorld(&twin)
+	stepWorld()
+	saveWorld(&twin)
+	loadWorld(&refWorld)
+	lyap.Advance(twinDistance, rescaleTwin)
+}
+
+// twinDistance is the phase-space distance over particles alive in both worlds
+func twinDistance() float64 {
+	var s float64
+	for i, p := range all {
+		t := &twin.values[i]
+		if p.energy <= 0 || t.energy <= 0 {
+			continue
+		}
+		s += sq(t.x-p.x) + sq(t.y-p.y) + sq(t.vx-p.vx) + sq(t.vy-p.vy)
+	}
+	return math.Sqrt(s)
+}
+
+func rescaleTwin(f float64) {
+	for i, p := range all {
+		t := &twin.values[i]
+		t.x = p.x + f*(t.x-p.x)
+		t.y = p.y + f*(t.y-p.y)
+		t.vx = p.vx + f*(t.vx-p.vx)
+		t.vy = p.vy + f*(t.vy-p.vy)
+	}
+}
+
 func main() {
+	modSpec := flag.String("mod", "", "rule weight bindings param=source[:scale[:offset]], params: gg, rr, yy, gr, gy, rg, yg")
+	state := newStateIOFlags()
+	img := newImageSeedFlags()
+	flag.Parse()
+	bindings, err := parseBindings(*modSpec, weights)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	var wnd *sdlcanvas.Window
-	var err error
 	wnd, cv, err = sdlcanvas.CreateWindow(width, height, "Artificial Life - MaCE-Evolved (Debugged)")
 	if err != nil {
 		panic(err)
@@ -265,9 +487,36 @@ func main() {
 	cv.SetFont(font, 32)
 
 	// Create particles with different masses (Red=Predator, Green=Prey, Yellow=Neutral/Resource)
-	create(2000, "#FFFF00", massBase*0.8)
-	create(1000, "#FF0000", massBase*1.2)
-	create(2000, "#00FF00", massBase*1.0)
+	switch {
+	case state.Load != "":
+		a, err := readNPY(state.Load)
+		if err == nil {
+			err = loadParticles(a)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case img.Enabled():
+		sampler, err := img.Sampler()
+		if err != nil {
+			log.Fatal(err)
+		}
+		createFromImage(sampler, imageParticles)
+	default:
+		create(2000, "#FFFF00", massBase*0.8)
+		create(1000, "#FF0000", massBase*1.2)
+		create(2000, "#00FF00", massBase*1.0)
+	}
+
+	wnd.KeyDown = func(scancode int, rn rune, name string) {
+		if rn == 'y' {
+			if lyap == nil {
+				startLyapunov()
+			} else {
+				lyap = nil
+			}
+		}
+	}
 
 	wnd.MainLoop(func() {
 		cv.SetFillStyle("#000")
@@ -278,21 +527,21 @@ func main() {
 		cv.FillText("Yellow: "+fmt.Sprint(len(yellow)), 10, 30)
 		cv.FillText("Red: "+fmt.Sprint(len(red)), 10, 60)
 		cv.FillText("Green: "+fmt.Sprint(len(green)), 10, 90)
+		if lyap != nil {
+			cv.FillText(lyap.String()+" (per frame)", 10, 120)
+		}
 
-		// Apply rules (Force accumulation happens here)
-		// Self-Interactions (O(N^2/2) optimized and applies forces to both particles)
-		rule(green, green, -0.32)
-		rule(red, red, -0.1)
-		rule(yellow, yellow, 0.15)
-
-		// Cross-Interactions (O(N^2) as they are distinct slices)
-		rule(green, red, -0.17)
-		rule(green, yellow, 0.34)
-		rule(red, green, -0.34)
-		rule(yellow, green, -0.20)
-
-		// Sequential Update: Apply forces, MaCE, positions, energy, and death
-		updateWorld()
+		// Apply rules (Force accumulation happens here); the twin shares the rule weights
+		stepBindings(bindings)
+		stepWorld()
+		if lyap != nil {
+			stepTwin()
+		}
+		if state.Next() {
+			if err := state.DumpTable("particles", particleCols, particleTable()); err != nil {
+				log.Printf("dump: %v", err)
+			}
+		}
 
 		// Draw all surviving particles
 		for _, p := range particles {
@@ -38,6 +38,9 @@ var (
 	texture uint32
 	vao     uint32
 	program uint32
+
+	pixels  [width * height * 3]uint8 // colour buffer reused every frame
+	rampLUT [256][3]uint8             // the color ramp at 256 field levels
 )
 
 func init() {
@@ -186,6 +189,9 @@ func initGL() {
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
+	// allocate the texture once; drawField only replaces its contents
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGB, int32(width), int32(height), 0, gl.RGB, gl.UNSIGNED_BYTE, nil)
+	buildRampLUT()
 
 	program = newProgram()
 	gl.UseProgram(program)
@@ -218,31 +224,36 @@ func initGL() {
 }
 
 // --- draw ---
+
+// buildRampLUT precomputes the color ramp, so drawField does no math per cell
+func buildRampLUT() {
+	for k := range rampLUT {
+		// --- Modern Lenia Color Ramp (Dark Blue/Black background to Yellow/White center) ---
+		// Use a gamma curve to increase contrast
+		intensity := math.Pow(float64(k)/255, 0.5)
+
+		// Dark Blue/Black to Bright Yellow/White transition
+		r := uint8(255 * math.Min(1.0, 1.5*intensity)) // Red ramps up quickly
+		g := uint8(255 * math.Min(1.0, 1.0*intensity)) // Green ramps up moderately
+		b := uint8(255 * math.Max(0.0, 1.0-intensity)) // Blue decreases, creating yellow/red peak
+		rampLUT[k] = [3]uint8{r, g, b}
+	}
+}
+
 func drawField() {
-	pixels := make([]uint8, width*height*3)
 	for j := 0; j < height; j++ {
 		for i := 0; i < width; i++ {
-			v := field[j][i]
-
-			// --- Modern Lenia Color Ramp (Dark Blue/Black background to Yellow/White center) ---
-			// Use a gamma curve to increase contrast
-			intensity := math.Pow(float64(v), 0.5)
-
-			// Dark Blue/Black to Bright Yellow/White transition
-			r := uint8(255 * math.Min(1.0, 1.5*intensity)) // Red ramps up quickly
-			g := uint8(255 * math.Min(1.0, 1.0*intensity)) // Green ramps up moderately
-			b := uint8(255 * math.Max(0.0, 1.0-intensity)) // Blue decreases, creating yellow/red peak
-
+			c := rampLUT[uint8(255*field[j][i]+0.5)]
 			idx := (j*width + i) * 3
-			pixels[idx+0] = r
-			pixels[idx+1] = g
-			pixels[idx+2] = b
+			pixels[idx+0] = c[0]
+			pixels[idx+1] = c[1]
+			pixels[idx+2] = c[2]
 		}
 	}
 
 	// Update the OpenGL texture with the new pixel data
 	gl.BindTexture(gl.TEXTURE_2D, texture)
-	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGB, int32(width), int32(height), 0, gl.RGB, gl.UNSIGNED_BYTE, gl.Ptr(pixels))
+	gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, int32(width), int32(height), gl.RGB, gl.UNSIGNED_BYTE, gl.Ptr(pixels[:]))
 
 	// Draw the quad
 	gl.Clear(gl.COLOR_BUFFER_BIT)
@@ -283,7 +294,8 @@ func main() {
 	glfw.WindowHint(glfw.OpenGLProfile, glfw.OpenGLCoreProfile)
 	glfw.WindowHint(glfw.OpenGLForwardCompatible, glfw.True)
 
-	window, err := glfw.CreateWindow(winWidth, winHeight, "Go Lenia — Unicellular Mover", nil, nil)
+	const title = "Go Lenia — Unicellular Mover"
+	window, err := glfw.CreateWindow(winWidth, winHeight, title, nil, nil)
 	if err != nil {
 		panic(err)
 	}
@@ -303,6 +315,9 @@ func main() {
 	// Target approximately 60 FPS (16ms per frame) for smooth visuals
 	frameTime := time.Millisecond * 16
 
+	// Frame and draw times, averaged over 30 frames and shown in the title
+	frames, drawTime, titled := 0, time.Duration(0), time.Now()
+
 	for !window.ShouldClose() {
 		now := time.Now()
 
@@ -312,8 +327,17 @@ func main() {
 			last = now
 		}
 
+		drawStart := time.Now()
 		drawField()
+		drawTime += time.Since(drawStart)
 		window.SwapBuffers()
 		glfw.PollEvents()
+
+		if frames++; frames == 30 {
+			frameMs := float64(time.Since(titled)) / float64(time.Millisecond) / 30
+			drawMs := float64(drawTime) / float64(time.Millisecond) / 30
+			window.SetTitle(fmt.Sprintf("%s — frame %.1f ms  draw %.2f ms", title, frameMs, drawMs))
+			frames, drawTime, titled = 0, 0, time.Now()
+		}
 	}
 }
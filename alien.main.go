@@ -1,6 +1,8 @@
+// run: go run alien.main.go recorder.go imageseed.go svgtrail.go poster.go palette.go
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"math"
@@ -31,6 +33,12 @@ type Particle struct {
 	BaseHue float64
 }
 
+// Color is the particle's hue in degrees and brightness, shifting with its speed
+func (p *Particle) Color() (hue, val float64) {
+	speed := math.Sqrt(p.VX*p.VX + p.VY*p.VY)
+	return math.Mod(p.BaseHue+speed*120, 360), 0.6 + 0.4*(speed/MaxSpeed)
+}
+
 // ---------------- Simulation ----------------
 type Simulation struct {
 	Particles []*Particle
@@ -38,7 +46,9 @@ type Simulation struct {
 	Noise     *perlin.Perlin
 }
 
-func NewSimulation(cv *canvas.Canvas) *Simulation {
+// NewSimulation scatters the particles uniformly with random hues, or, given a sampler,
+// places them by image brightness with the hue of their pixel unless it is grey
+func NewSimulation(cv *canvas.Canvas, sampler *ImageSampler) *Simulation {
 	noise := perlin.NewPerlin(rand.Float64(), rand.Float64(), 2, 256)
 	sim := &Simulation{
 		Particles: make([]*Particle, 0, ParticleNum),
@@ -47,43 +57,26 @@ func NewSimulation(cv *canvas.Canvas) *Simulation {
 	}
 
 	for i := 0; i < ParticleNum; i++ {
-		sim.Particles = append(sim.Particles, &Particle{
+		p := &Particle{
 			X:       rand.Float64() * Width,
 			Y:       rand.Float64() * Height,
 			VX:      0,
 			VY:      0,
 			Size:    1.5 + rand.Float64()*2,
 			BaseHue: rand.Float64() * 360,
-		})
+		}
+		if sampler != nil {
+			u, v, hue, sat := sampler.Sample(rand.Float64)
+			p.X, p.Y = u*Width, v*Height
+			if sat >= imageGreySat {
+				p.BaseHue = hue
+			}
+		}
+		sim.Particles = append(sim.Particles, p)
 	}
 	return sim
 }
 
-// ---------------- Color Conversion ----------------
-func HSVtoHex(h, s, v float64) string {
-	h = math.Mod(h, 360)
-	c := v * s
-	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
-	m := v - c
-	var r, g, b float64
-
-	switch {
-	case h < 60:
-		r, g, b = c, x, 0
-	case h < 120:
-		r, g, b = x, c, 0
-	case h < 180:
-		r, g, b = 0, c, x
-	case h < 240:
-		r, g, b = 0, x, c
-	case h < 300:
-		r, g, b = x, 0, c
-	default:
-		r, g, b = c, 0, x
-	}
-	return fmt.Sprintf("#%02X%02X%02X", int((r+m)*255), int((g+m)*255), int((b+m)*255))
-}
-
 // ---------------- Simulation Step ----------------
 func (sim *Simulation) Update() {
 	// Apply Perlin noise motion
@@ -150,6 +143,18 @@ func (sim *Simulation) Update() {
 	}
 }
 
+// RecordTrails adds the particles' positions to a running SVG capture
+func (sim *Simulation) RecordTrails(svg *TrailSVG) {
+	if !svg.Recording() {
+		return
+	}
+	for i, p := range sim.Particles {
+		hue, val := p.Color()
+		svg.Add(i, p.X, p.Y, hue, val)
+	}
+	svg.Step()
+}
+
 // ---------------- Drawing ----------------
 func (sim *Simulation) Draw() {
 	cv := sim.Canvas
@@ -158,26 +163,98 @@ func (sim *Simulation) Draw() {
 	cv.FillRect(0, 0, Width, Height)
 
 	for _, p := range sim.Particles {
-		speed := math.Sqrt(p.VX*p.VX + p.VY*p.VY)
-		hue := math.Mod(p.BaseHue+speed*120, 360)
-		color := HSVtoHex(hue, 1, 0.6+0.4*(speed/MaxSpeed))
-		cv.SetFillStyle(color)
+		hue, val := p.Color()
+		cv.SetFillStyle(hsvToHex(hue, 1, val))
 		cv.FillRect(p.X, p.Y, p.Size, p.Size)
 	}
 }
 
+// ---------------- Poster ----------------
+// RenderPoster runs the simulation headless and accumulates every step into the poster
+func (sim *Simulation) RenderPoster(pst *Poster) error {
+	if err := pst.Begin(Width, Height); err != nil {
+		return err
+	}
+	for !pst.Done() {
+		sim.Update()
+		for _, p := range sim.Particles {
+			hue, val := p.Color()
+			pst.Splat(p.X, p.Y, p.Size, hue, val)
+		}
+		pst.Step()
+	}
+	return pst.Write()
+}
+
 // ---------------- Main ----------------
 func main() {
+	rec := newRecorderFlags()
+	img := newImageSeedFlags()
+	svg := newTrailSVGFlags()
+	pst := newPosterFlags()
+	flag.Parse()
+
+	rand.Seed(time.Now().UnixNano())
+	var sampler *ImageSampler
+	if img.Enabled() {
+		var err error
+		if sampler, err = img.Sampler(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// -poster renders a still without opening a window
+	if pst.Enabled() {
+		if err := NewSimulation(nil, sampler).RenderPoster(pst); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	wnd, cv, err := sdlcanvas.CreateWindow(Width, Height, "MaCE Cosmic Swirl")
 	if err != nil {
 		log.Fatal(err)
 	}
+	sim := NewSimulation(cv, sampler)
 
-	rand.Seed(time.Now().UnixNano())
-	sim := NewSimulation(cv)
+	// V captures the particle trails as SVG; with -svg the first capture starts at once
+	if svg.Path != "" {
+		svg.Start(len(sim.Particles), Width, Height)
+	}
+
+	// R toggles recording; with -record-frames the recording starts at once and the
+	// window closes when it is complete
+	if rec.MaxFrames > 0 {
+		if err := rec.Start(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	wnd.KeyDown = func(scancode int, rn rune, name string) {
+		switch rn {
+		case 'r':
+			rec.Toggle()
+		case 'v':
+			svg.Toggle(len(sim.Particles), Width, Height)
+		}
+	}
 
 	wnd.MainLoop(func() {
 		sim.Update()
+		sim.RecordTrails(svg)
 		sim.Draw()
+		if rec.Next() {
+			if err := rec.Capture(cv.GetImageData(0, 0, Width, Height)); err != nil {
+				log.Printf("recorder: %v", err)
+			}
+		}
+		if rec.Done() {
+			wnd.Close()
+		}
 	})
+	if err := rec.Stop(); err != nil {
+		log.Printf("recorder: %v", err)
+	}
+	if err := svg.Stop(); err != nil {
+		log.Printf("svg: %v", err)
+	}
 }
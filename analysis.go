@@ -0,0 +1,245 @@
+// analysis.go
+//
+// Spatial statistics of a Lenia field: radially averaged power spectrum, 2D
+// autocorrelation, characteristic length scales and box-counting fractal dimension.
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+)
+
+const analysisThreshold = 0.2 // cells above this count as occupied for box counting
+
+// FieldAnalysis holds the statistics of one field snapshot. Radial curves are indexed by
+// wavenumber (spectrum) or lag (autocorrelation) in steps of one cell of the shorter axis.
+type FieldAnalysis struct {
+	W, H int
+
+	Spectrum   []float64 // mean power per radial wavenumber bin, bin k = k cycles per min(W, H) cells
+	Autocorr   []float64 // W×H row-major autocorrelation, zero lag at index 0, normalized to 1
+	AutoRadial []float64 // autocorrelation averaged over rings of integer lag
+
+	PeakWavelength float64 // wavelength of the strongest non-DC spectral bin, in cells
+	LengthScale    float64 // inverse spectral centroid, in cells
+	CorrLength     float64 // first lag where the radial autocorrelation falls below 1/e
+
+	BoxSizes    []int
+	BoxCounts   []int
+	FractalDim  float64 // box-counting dimension of the thresholded field
+	Occupied    float64 // fraction of cells above analysisThreshold
+	Mean, Var   float64
+	Featureless bool // constant field: spectral and correlation results are zero
+}
+
+// Analyzer computes FieldAnalysis for fields of one size, reusing its FFT plan
+type Analyzer struct {
+	w, h int
+	plan *FFT2Plan
+	buf  []complex128
+}
+
+func newAnalyzer(w, h int) *Analyzer {
+	return &Analyzer{w: w, h: h, plan: newFFT2Plan(w, h), buf: make([]complex128, w*h)}
+}
+
+// Analyze computes every statistic of A, which must be h rows of w cells
+func (an *Analyzer) Analyze(A [][]float64) *FieldAnalysis {
+	w, h := an.w, an.h
+	n := float64(w * h)
+	fa := &FieldAnalysis{W: w, H: h}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fa.Mean += A[y][x]
+		}
+	}
+	fa.Mean /= n
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			d := A[y][x] - fa.Mean
+			fa.Var += d * d
+			an.buf[y*w+x] = complex(d, 0)
+		}
+	}
+	fa.Var /= n
+
+	// power spectrum of the mean-free field
+	an.plan.Transform(an.buf, false)
+	L := w
+	if h < L {
+		L = h
+	}
+	bins := L/2 + 1
+	fa.Spectrum = make([]float64, bins)
+	counts := make([]int, bins)
+	for y := 0; y < h; y++ {
+		fy := float64(freqIndex(y, h)) / float64(h)
+		for x := 0; x < w; x++ {
+			fx := float64(freqIndex(x, w)) / float64(w)
+			p := real(an.buf[y*w+x])*real(an.buf[y*w+x]) + imag(an.buf[y*w+x])*imag(an.buf[y*w+x])
+			an.buf[y*w+x] = complex(p/n, 0)
+			if b := int(math.Hypot(fx, fy)*float64(L) + 0.5); b < bins {
+				fa.Spectrum[b] += p / n
+				counts[b]++
+			}
+		}
+	}
+	var pSum, kSum, peak float64
+	for b := range fa.Spectrum {
+		if counts[b] > 0 {
+			fa.Spectrum[b] /= float64(counts[b])
+		}
+		if b == 0 {
+			continue
+		}
+		pSum += fa.Spectrum[b]
+		kSum += float64(b) * fa.Spectrum[b]
+		if fa.Spectrum[b] > peak {
+			peak = fa.Spectrum[b]
+			fa.PeakWavelength = float64(L) / float64(b)
+		}
+	}
+	fa.Featureless = fa.Var < 1e-12
+	if !fa.Featureless && kSum > 0 {
+		fa.LengthScale = float64(L) * pSum / kSum
+	}
+
+	// autocorrelation is the inverse transform of the power (Wiener-Khinchin)
+	an.plan.Transform(an.buf, true)
+	fa.Autocorr = make([]float64, w*h)
+	zero := real(an.buf[0])
+	maxLag := L / 2
+	fa.AutoRadial = make([]float64, maxLag+1)
+	lagCounts := make([]int, maxLag+1)
+	for y := 0; y < h && !fa.Featureless && zero > 0; y++ {
+		dy := freqIndex(y, h)
+		for x := 0; x < w; x++ {
+			v := real(an.buf[y*w+x]) / zero
+			fa.Autocorr[y*w+x] = v
+			if r := int(math.Hypot(float64(freqIndex(x, w)), float64(dy)) + 0.5); r <= maxLag {
+				fa.AutoRadial[r] += v
+				lagCounts[r]++
+			}
+		}
+	}
+	for r := range fa.AutoRadial {
+		if lagCounts[r] > 0 {
+			fa.AutoRadial[r] /= float64(lagCounts[r])
+		}
+		if fa.CorrLength == 0 && r > 0 && fa.AutoRadial[r] < 1/math.E && !fa.Featureless {
+			// interpolate the crossing between the previous lag and this one
+			a, b := fa.AutoRadial[r-1], fa.AutoRadial[r]
+			fa.CorrLength = float64(r-1) + (a-1/math.E)/(a-b)
+		}
+	}
+
+	an.boxCount(A, fa)
+	return fa
+}
+
+// freqIndex returns the absolute frequency of DFT index i, which is also the shortest
+// toroidal distance of lag i
+func freqIndex(i, n int) int {
+	if i > n/2 {
+		return n - i
+	}
+	return i
+}
+
+// boxCount covers the thresholded field with boxes of size 1, 2, 4, ... and fits the
+// slope of log(count) against log(1/size)
+func (an *Analyzer) boxCount(A [][]float64, fa *FieldAnalysis) {
+	w, h := an.w, an.h
+	occupied := 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if A[y][x] > analysisThreshold {
+				occupied++
+			}
+		}
+	}
+	fa.Occupied = float64(occupied) / float64(w*h)
+	if occupied == 0 {
+		return
+	}
+	for s := 1; s <= w/4 && s <= h/4; s *= 2 {
+		count := 0
+		for by := 0; by < h; by += s {
+			for bx := 0; bx < w; bx += s {
+			box:
+				for y := by; y < by+s && y < h; y++ {
+					for x := bx; x < bx+s && x < w; x++ {
+						if A[y][x] > analysisThreshold {
+							count++
+							break box
+						}
+					}
+				}
+			}
+		}
+		fa.BoxSizes = append(fa.BoxSizes, s)
+		fa.BoxCounts = append(fa.BoxCounts, count)
+	}
+	if len(fa.BoxSizes) < 2 {
+		return
+	}
+	// least squares slope of log N(s) over log(1/s)
+	var sx, sy, sxx, sxy float64
+	for i, s := range fa.BoxSizes {
+		lx := -math.Log(float64(s))
+		ly := math.Log(float64(fa.BoxCounts[i]))
+		sx += lx
+		sy += ly
+		sxx += lx * lx
+		sxy += lx * ly
+	}
+	k := float64(len(fa.BoxSizes))
+	fa.FractalDim = (k*sxy - sx*sy) / (k*sxx - sx*sx)
+}
+
+// Summary is a one-line description for HUDs and logs
+func (fa *FieldAnalysis) Summary() string {
+	return fmt.Sprintf("λpeak %.1f  ℓ %.1f  corr %.1f  D %.2f  occ %.0f%%",
+		fa.PeakWavelength, fa.LengthScale, fa.CorrLength, fa.FractalDim, 100*fa.Occupied)
+}
+
+// WriteCSV writes the radial curves, one row per wavenumber/lag bin, to path and appends
+// the scalar results to summaryPath (with a header when the file is new)
+func (fa *FieldAnalysis) WriteCSV(path, summaryPath, label string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(f, "bin,wavelength,power,autocorr")
+	L := fa.W
+	if fa.H < L {
+		L = fa.H
+	}
+	for b := range fa.Spectrum {
+		wl := math.Inf(1)
+		if b > 0 {
+			wl = float64(L) / float64(b)
+		}
+		ac := 0.0
+		if b < len(fa.AutoRadial) {
+			ac = fa.AutoRadial[b]
+		}
+		fmt.Fprintf(f, "%d,%g,%g,%g\n", b, wl, fa.Spectrum[b], ac)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	_, statErr := os.Stat(summaryPath)
+	s, err := os.OpenFile(summaryPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if os.IsNotExist(statErr) {
+		fmt.Fprintln(s, "label,mean,variance,peak_wavelength,length_scale,corr_length,fractal_dim,occupied")
+	}
+	fmt.Fprintf(s, "%s,%g,%g,%g,%g,%g,%g,%g\n", label, fa.Mean, fa.Var,
+		fa.PeakWavelength, fa.LengthScale, fa.CorrLength, fa.FractalDim, fa.Occupied)
+	return s.Close()
+}
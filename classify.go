@@ -0,0 +1,336 @@
+// classify.go
+//
+// Outcome classification of a Lenia run from its field history: extinct, saturated,
+// static, oscillator, glider, chaotic or multi-creature. Periodicity comes from hashing
+// quantized field states, motion and creature counts from the tracker in tracking.go.
+// It needs tracking.go.
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+// Outcome is the label of a run
+type Outcome int
+
+const (
+	Undetermined Outcome = iota
+	Extinct
+	Saturated
+	Static
+	Oscillator
+	Glider
+	Chaotic
+	MultiCreature
+)
+
+var outcomeNames = [...]string{"undetermined", "extinct", "saturated", "static", "oscillator", "glider", "chaotic", "multi-creature"}
+
+func (o Outcome) String() string { return outcomeNames[o] }
+
+const (
+	classifyWindow   = 240  // most recent observations the label is based on
+	classifyWarmup   = 60   // observations before a label is given
+	classifyLevels   = 64   // quantization levels for state hashing
+	classifyExtinct  = 1e-4 // mean activity below this is extinct
+	classifySatMean  = 0.6  // mean activity above this is saturated
+	classifyStatic   = 2e-5 // mean |ΔA| per cell and step below this is static
+	classifyMassCV   = 0.05 // mass coefficient of variation for a fixed shape
+	classifyMinSpeed = 0.01 // cells per step for a glider
+	classifyPeriodic = 0.8  // mass autocorrelation peak that counts as oscillating
+	classifyMaxSpan  = 0.5  // a creature covers less than this fraction of each axis
+)
+
+// Classification is the current label with the measurements behind it
+type Classification struct {
+	Outcome   Outcome
+	Period    int     // repeat period in steps (oscillators, gliders), 0 if none
+	Speed     float64 // centroid speed of a single creature, cells per step
+	Creatures int     // median creature count over the window
+	MeanMass  float64 // mean activity per cell over the window
+}
+
+func (c Classification) String() string {
+	s := c.Outcome.String()
+	if c.Period > 0 {
+		s += fmt.Sprintf(" period %d", c.Period)
+	}
+	if c.Outcome == Glider {
+		s += fmt.Sprintf(" speed %.3f", c.Speed)
+	}
+	if c.Creatures > 1 {
+		s += fmt.Sprintf(" (%d creatures)", c.Creatures)
+	}
+	return s
+}
+
+// Classifier accumulates observations of one run. With Every > 1 only every Every-th
+// step passed to Observe is taken, which saves its cost on every other step; rates and
+// periods are still reported per step, though a period that Every does not divide is
+// seen as a multiple of itself.
+type Classifier struct {
+	Every int // steps between observations, 0 or 1 for every step
+
+	w, h    int
+	tracker *Tracker
+	prev    [][]float64
+
+	calls     int       // steps passed to Observe
+	steps     int       // observations taken
+	mass      []float64 // per observation, most recent classifyWindow
+	change    []float64 // mean |ΔA| per cell
+	creatures []int
+	track     []TrackPoint // centroid of the single creature, reset when it changes
+	trackID   int
+
+	row    []byte
+	hashes []uint64 // quantized state hash per observation
+	shapes []uint64 // the same, read relative to the single creature's centroid
+}
+
+func newClassifier(w, h int) *Classifier {
+	c := &Classifier{w: w, h: h, tracker: newTracker(w, h), row: make([]byte, w)}
+	c.Reset()
+	return c
+}
+
+// Reset starts a new run
+func (c *Classifier) Reset() {
+	c.tracker.Reset()
+	c.prev = make([][]float64, c.h)
+	for y := range c.prev {
+		c.prev[y] = make([]float64, c.w)
+	}
+	c.calls, c.steps = 0, 0
+	c.mass, c.change, c.creatures, c.track = nil, nil, nil, nil
+	c.trackID = 0
+	c.hashes, c.shapes = nil, nil
+}
+
+// Observe adds the current field state of the run; call it once per step
+func (c *Classifier) Observe(A [][]float64) {
+	c.calls++
+	if (c.calls-1)%c.stride() != 0 {
+		return
+	}
+	w, h := c.w, c.h
+	var mass, change, mx, my float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := A[y][x]
+			mass += v
+			change += math.Abs(v - c.prev[y][x])
+			c.prev[y][x] = v
+		}
+	}
+	n := float64(w * h)
+	if c.steps == 0 {
+		change = math.Inf(1)
+	}
+	c.mass = appendWindow(c.mass, mass/n)
+	c.change = appendWindow(c.change, change/n)
+
+	c.tracker.Update(A)
+	c.creatures = appendWindowInt(c.creatures, len(c.tracker.Blobs))
+	// a component spanning most of the grid is a texture, not a creature that can glide
+	if len(c.tracker.Blobs) == 1 && c.compact(c.tracker.Blobs[0]) {
+		b := c.tracker.Blobs[0]
+		if b.ID != c.trackID {
+			c.track, c.trackID = nil, b.ID
+		}
+		c.track = append(c.track, TrackPoint{Frame: c.steps, CX: b.CX, CY: b.CY})
+		if len(c.track) > classifyWindow {
+			c.track = c.track[1:]
+		}
+		mx, my = b.CX, b.CY
+	} else {
+		c.track, c.trackID = nil, 0
+	}
+
+	// periodicity is read from the hash sequences; for the shape hash the field is read
+	// relative to the creature's centroid, so a glider repeats while it moves
+	c.hashes = appendWindowHash(c.hashes, c.hash(A, 0, 0))
+	if c.trackID != 0 {
+		c.shapes = appendWindowHash(c.shapes, c.hash(A, int(math.Round(mx)), int(math.Round(my))))
+	} else {
+		c.shapes = nil
+	}
+	c.steps++
+}
+
+// stride is the number of steps between observations
+func (c *Classifier) stride() int {
+	if c.Every < 1 {
+		return 1
+	}
+	return c.Every
+}
+
+func (c *Classifier) compact(b *Blob) bool {
+	return float64(b.BW) < classifyMaxSpan*float64(c.w) && float64(b.BH) < classifyMaxSpan*float64(c.h)
+}
+
+// hash quantizes the field, read starting at (ox, oy) with wrap-around
+func (c *Classifier) hash(A [][]float64, ox, oy int) uint64 {
+	hf := fnv.New64a()
+	row := c.row
+	for y := 0; y < c.h; y++ {
+		src := A[(y+oy)%c.h]
+		for x := 0; x < c.w; x++ {
+			row[x] = byte(math.Min(classifyLevels-1, src[(x+ox)%c.w]*classifyLevels))
+		}
+		hf.Write(row)
+	}
+	return hf.Sum64()
+}
+
+func appendWindow(s []float64, v float64) []float64 {
+	s = append(s, v)
+	if len(s) > classifyWindow {
+		s = s[1:]
+	}
+	return s
+}
+
+func appendWindowHash(s []uint64, v uint64) []uint64 {
+	s = append(s, v)
+	if len(s) > classifyWindow {
+		s = s[1:]
+	}
+	return s
+}
+
+// hashPeriod returns the smallest p for which the last 2p hashes (at least
+// classifyWarmup/2 of them) repeat with lag p, or 0 if there is none
+func hashPeriod(hs []uint64) int {
+	for p := 1; p <= len(hs)/2; p++ {
+		n := 2 * p
+		if n < classifyWarmup/2 {
+			n = classifyWarmup / 2
+		}
+		if n > len(hs) {
+			break
+		}
+		repeats := true
+		for i := len(hs) - n + p; i < len(hs) && repeats; i++ {
+			repeats = hs[i] == hs[i-p]
+		}
+		if repeats {
+			return p
+		}
+	}
+	return 0
+}
+
+func appendWindowInt(s []int, v int) []int {
+	s = append(s, v)
+	if len(s) > classifyWindow {
+		s = s[1:]
+	}
+	return s
+}
+
+// Result labels the run from the observations so far. Extinction and saturation are
+// reported at once; the other labels need classifyWarmup observations.
+func (c *Classifier) Result() Classification {
+	var r Classification
+	if c.steps == 0 {
+		return r
+	}
+	mean, sd := meanStd(c.mass)
+	r.MeanMass = mean
+	counts := append([]int(nil), c.creatures...)
+	sort.Ints(counts)
+	r.Creatures = counts[len(counts)/2]
+	last := c.mass[len(c.mass)-1]
+	switch {
+	case last < classifyExtinct:
+		r.Outcome = Extinct
+		return r
+	case last > classifySatMean:
+		r.Outcome = Saturated
+		return r
+	case c.steps < classifyWarmup:
+		return r
+	}
+
+	var change float64
+	for _, v := range c.change[len(c.change)/2:] {
+		change += v
+	}
+	change /= float64(len(c.change)-len(c.change)/2) * float64(c.stride())
+	period := hashPeriod(c.hashes) * c.stride()
+	massPer := c.massPeriod() * c.stride()
+
+	switch {
+	case r.Creatures >= 2:
+		r.Outcome = MultiCreature
+	case change < classifyStatic || period == 1:
+		r.Outcome = Static
+	case c.isGlider(mean, sd, &r):
+		// checked before periodicity: a glider crossing the torus also repeats its state
+		r.Outcome = Glider
+	case period > 0:
+		r.Outcome, r.Period = Oscillator, period
+	case massPer > 0:
+		r.Outcome, r.Period = Oscillator, massPer
+	default:
+		r.Outcome = Chaotic
+	}
+	return r
+}
+
+// isGlider checks for one creature of constant mass whose centroid moves steadily
+func (c *Classifier) isGlider(mean, sd float64, r *Classification) bool {
+	if r.Creatures != 1 || len(c.track) < classifyWarmup || mean <= 0 || sd/mean > classifyMassCV {
+		return false
+	}
+	// net displacement, so a creature jittering in place has no speed
+	var sx, sy float64
+	for i := 1; i < len(c.track); i++ {
+		dx, dy := c.tracker.torusDist(c.track[i-1].CX, c.track[i-1].CY, c.track[i].CX, c.track[i].CY)
+		sx += dx
+		sy += dy
+	}
+	r.Speed = math.Hypot(sx, sy) / float64((len(c.track)-1)*c.stride())
+	if r.Speed < classifyMinSpeed {
+		return false
+	}
+	r.Period = hashPeriod(c.shapes) * c.stride()
+	return true
+}
+
+// massPeriod returns the lag of the strongest mass autocorrelation peak above
+// classifyPeriodic, or 0 when the mass series is not periodic
+func (c *Classifier) massPeriod() int {
+	m := c.mass
+	mean, sd := meanStd(m)
+	if sd < 1e-9 || len(m) < classifyWarmup {
+		return 0
+	}
+	best, bestLag := classifyPeriodic, 0
+	for lag := 2; lag < len(m)/2; lag++ {
+		var sum float64
+		for i := lag; i < len(m); i++ {
+			sum += (m[i] - mean) * (m[i-lag] - mean)
+		}
+		if ac := sum / float64(len(m)-lag) / (sd * sd); ac > best {
+			best, bestLag = ac, lag
+		}
+	}
+	return bestLag
+}
+
+func meanStd(v []float64) (mean, sd float64) {
+	for _, x := range v {
+		mean += x
+	}
+	mean /= float64(len(v))
+	for _, x := range v {
+		sd += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(sd / float64(len(v)))
+}
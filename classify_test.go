@@ -0,0 +1,95 @@
+// test: go test classify_test.go classify.go tracking.go
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+const (
+	testClassifyW = 40
+	testClassifyH = 32
+)
+
+// blobField returns a field with a w×h rectangle of value v at (x, y), wrapping around
+// the edges; w = 0 gives a uniform field of v
+func blobField(x, y, w, h int, v float64) [][]float64 {
+	A := make([][]float64, testClassifyH)
+	for i := range A {
+		A[i] = make([]float64, testClassifyW)
+		if w == 0 {
+			for j := range A[i] {
+				A[i][j] = v
+			}
+		}
+	}
+	for dy := 0; dy < h; dy++ {
+		for dx := 0; dx < w; dx++ {
+			A[(y+dy)%testClassifyH][(x+dx)%testClassifyW] = v
+		}
+	}
+	return A
+}
+
+func TestClassifier(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		every  int
+		steps  int
+		field  func(step int) [][]float64
+		want   Outcome
+		period int
+		speed  float64
+	}{
+		{"empty", 1, 10, func(int) [][]float64 { return blobField(0, 0, 0, 0, 0) }, Extinct, 0, 0},
+		{"full", 1, 10, func(int) [][]float64 { return blobField(0, 0, 0, 0, 1) }, Saturated, 0, 0},
+		{"fixed blob", 1, 100, func(int) [][]float64 { return blobField(10, 10, 5, 5, 0.5) }, Static, 0, 0},
+		{"flip", 1, 100, func(s int) [][]float64 {
+			// a 5×3 bar turning between horizontal and vertical about the same centre
+			if s%2 == 0 {
+				return blobField(10, 11, 5, 3, 0.5)
+			}
+			return blobField(11, 10, 3, 5, 0.5)
+		}, Oscillator, 2, 0},
+		{"translating blob", 1, 100, func(s int) [][]float64 { return blobField(s, 12, 4, 4, 0.5) }, Glider, 0, 1},
+		{"translating blob, every 2nd step", 2, 200, func(s int) [][]float64 { return blobField(s, 12, 4, 4, 0.5) }, Glider, 0, 1},
+	} {
+		c := newClassifier(testClassifyW, testClassifyH)
+		c.Every = tc.every
+		for s := 0; s < tc.steps; s++ {
+			c.Observe(tc.field(s))
+		}
+		r := c.Result()
+		if r.Outcome != tc.want {
+			t.Errorf("%s: %v, want %v", tc.name, r, tc.want)
+			continue
+		}
+		if tc.period > 0 && r.Period != tc.period {
+			t.Errorf("%s: period %d, want %d", tc.name, r.Period, tc.period)
+		}
+		if tc.speed > 0 && math.Abs(r.Speed-tc.speed) > 1e-9 {
+			t.Errorf("%s: speed %g, want %g", tc.name, r.Speed, tc.speed)
+		}
+	}
+}
+
+// a field only gets a label other than extinct or saturated after classifyWarmup
+// observations, and Reset starts over
+func TestClassifierWarmupReset(t *testing.T) {
+	c := newClassifier(testClassifyW, testClassifyH)
+	A := blobField(10, 10, 5, 5, 0.5)
+	for s := 0; s < classifyWarmup-1; s++ {
+		c.Observe(A)
+	}
+	if r := c.Result(); r.Outcome != Undetermined {
+		t.Fatalf("before warm-up: %v, want undetermined", r)
+	}
+	c.Observe(A)
+	if r := c.Result(); r.Outcome != Static {
+		t.Fatalf("after warm-up: %v, want static", r)
+	}
+	c.Reset()
+	if r := c.Result(); r.Outcome != Undetermined {
+		t.Errorf("after Reset: %v, want undetermined", r)
+	}
+}
@@ -1,7 +1,10 @@
+// run: go run colores.main.go palette.go render.go webview.go
 package main
 
 import (
+	"flag"
 	"fmt"
+	"image"
 	"image/color"
 	"log"
 	"math"
@@ -9,6 +12,7 @@ import (
 	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/text"
 	"golang.org/x/image/font/basicfont"
 )
@@ -20,6 +24,10 @@ const (
 	dtDefault  = 0.08
 	muDefault  = 0.30
 	sigDefault = 0.06
+
+	screenW     = 800
+	screenH     = 600
+	headlessTPS = 60 // updates per second without a window (-web-headless)
 )
 
 type KernelEntry struct {
@@ -34,6 +42,8 @@ type Game struct {
 	mu       float64
 	sigma    float64
 	texture  *ebiten.Image
+	palettes *PaletteCycle
+	pixels   *FieldPixels
 
 	// Camera
 	camX, camY     float64
@@ -41,6 +51,10 @@ type Game struct {
 	lastMx, lastMy int
 	rightDragging  bool
 
+	// browser viewer
+	web      *WebView
+	webFrame *image.RGBA // the camera view, rendered on the CPU
+
 	frame   int
 	start   time.Time
 	lastFPS int
@@ -133,6 +147,7 @@ func NewGame() *Game {
 		mu:      muDefault,
 		sigma:   sigDefault,
 		texture: tex,
+		pixels:  newFieldPixels(gridW, gridH),
 		camZoom: 4, // initial zoom factor
 		start:   time.Now(),
 	}
@@ -156,25 +171,49 @@ func (g *Game) step() {
 }
 
 // ---- Input / Camera ----
+// keyDown reports whether key k is held in the window or, by its KeyboardEvent.code, in
+// the browser viewer
+func (g *Game) keyDown(k ebiten.Key, code string) bool {
+	return ebiten.IsKeyPressed(k) || g.web != nil && g.web.Pressed(code)
+}
+
+func (g *Game) keyJustPressed(k ebiten.Key, code string) bool {
+	return inpututil.IsKeyJustPressed(k) || g.web != nil && g.web.JustPressed(code)
+}
+
+// zoom scales the view by 1.1 per wheel step around the screen position mx, my
+func (g *Game) zoom(scrollY float64, mx, my int) {
+	oldZoom := g.camZoom
+	g.camZoom *= math.Pow(1.1, scrollY)
+	if g.camZoom < 1 {
+		g.camZoom = 1
+	}
+	// Keep mouse position stable (zoom to cursor)
+	dx := float64(mx)/oldZoom - (g.camX + float64(mx)/g.camZoom)
+	dy := float64(my)/oldZoom - (g.camY + float64(my)/g.camZoom)
+	g.camX += dx
+	g.camY += dy
+}
+
 func (g *Game) handleCamera() {
 	// Zoom with scroll wheel
-	_, scrollY := ebiten.Wheel()
-	if scrollY != 0 {
-		oldZoom := g.camZoom
-		g.camZoom *= math.Pow(1.1, scrollY)
-		if g.camZoom < 1 {
-			g.camZoom = 1
+	mx, my := ebiten.CursorPosition()
+	if _, scrollY := ebiten.Wheel(); scrollY != 0 {
+		g.zoom(scrollY, mx, my)
+	}
+
+	// The browser has no drag: its wheel zooms and a click centres the view there
+	if g.web != nil {
+		for _, s := range g.web.Scrolls() {
+			g.zoom(s.DY, int(s.X*screenW), int(s.Y*screenH))
+		}
+		for _, c := range g.web.Clicks() {
+			g.camX += (c.X - 0.5) * screenW / g.camZoom
+			g.camY += (c.Y - 0.5) * screenH / g.camZoom
 		}
-		// Keep mouse position stable (zoom to cursor)
-		mx, my := ebiten.CursorPosition()
-		dx := float64(mx)/oldZoom - (g.camX + float64(mx)/g.camZoom)
-		dy := float64(my)/oldZoom - (g.camY + float64(my)/g.camZoom)
-		g.camX += dx
-		g.camY += dy
 	}
 
 	// Right mouse drag for pan
-	mx, my := ebiten.CursorPosition()
 	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight) {
 		if !g.rightDragging {
 			g.rightDragging = true
@@ -192,16 +231,16 @@ func (g *Game) handleCamera() {
 
 	// WSAD keyboard pan
 	speed := 5.0 / g.camZoom
-	if ebiten.IsKeyPressed(ebiten.KeyW) {
+	if g.keyDown(ebiten.KeyW, "KeyW") {
 		g.camY -= speed
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyS) {
+	if g.keyDown(ebiten.KeyS, "KeyS") {
 		g.camY += speed
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyA) {
+	if g.keyDown(ebiten.KeyA, "KeyA") {
 		g.camX -= speed
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyD) {
+	if g.keyDown(ebiten.KeyD, "KeyD") {
 		g.camX += speed
 	}
 }
@@ -209,56 +248,113 @@ func (g *Game) handleCamera() {
 // ---- Ebiten loop ----
 func (g *Game) Update() error {
 	g.handleCamera()
+	if g.keyJustPressed(ebiten.KeyP, "KeyP") {
+		g.palettes.Next()
+	}
 	g.step()
 	g.frame++
 	if g.frame%30 == 0 {
 		elapsed := time.Since(g.start).Seconds()
 		g.lastFPS = int(float64(g.frame) / elapsed)
 	}
+	g.publishWeb()
 	return nil
 }
 
 func (g *Game) Draw(screen *ebiten.Image) {
-	for y := 0; y < gridH; y++ {
-		for x := 0; x < gridW; x++ {
-			v := g.A[y][x]
-			r, gg, b := colorRamp(v)
-			g.texture.Set(x, y, color.NRGBA{r, gg, b, 0xFF})
-		}
-	}
+	g.pixels.Fill(g.A, g.palettes.Current(), 0)
+	g.texture.WritePixels(g.pixels.Pix)
 
 	op := &ebiten.DrawImageOptions{}
 	op.GeoM.Scale(g.camZoom, g.camZoom)
 	op.GeoM.Translate(-g.camX*g.camZoom, -g.camY*g.camZoom)
 	screen.DrawImage(g.texture, op)
 
-	text.Draw(screen,
-		fmt.Sprintf("Zoom: %.2f  Cam:(%.1f,%.1f) FPS:%d", g.camZoom, g.camX, g.camY, g.lastFPS),
-		basicfont.Face7x13, 6, 16, color.White)
-	text.Draw(screen, "Controls: Scroll=Zoom  WSAD=Move  Right-drag=Pan",
-		basicfont.Face7x13, 6, 32, color.White)
+	for k, line := range g.hud() {
+		text.Draw(screen, line, basicfont.Face7x13, 6, 16+16*k, color.White)
+	}
 }
 
-func (g *Game) Layout(outW, outH int) (int, int) {
-	return 800, 600
+// hud is the overlay text, one string per line
+func (g *Game) hud() []string {
+	return []string{
+		fmt.Sprintf("Zoom: %.2f  Cam:(%.1f,%.1f) FPS:%d  Palette: %s", g.camZoom, g.camX, g.camY, g.lastFPS, g.palettes.Current().Name),
+		"Controls: Scroll=Zoom  WSAD=Move  Right-drag=Pan  P=Palette  (browser: Click=Centre)",
+	}
+}
+
+// ---- Browser viewer ----
+// publishWeb renders the camera view like Draw, but on the CPU, and sends it with the HUD
+// to the browser viewer when a frame is due
+func (g *Game) publishWeb() {
+	if g.web == nil || !g.web.Wanted() {
+		return
+	}
+	g.web.SetHUD(g.hud()...)
+	g.pixels.Fill(g.A, g.palettes.Current(), 0)
+	img := g.webFrame
+	for sy := 0; sy < screenH; sy++ {
+		wy := int(math.Floor(g.camY + (float64(sy)+0.5)/g.camZoom))
+		for sx := 0; sx < screenW; sx++ {
+			wx := int(math.Floor(g.camX + (float64(sx)+0.5)/g.camZoom))
+			o := img.PixOffset(sx, sy)
+			if wx < 0 || wx >= gridW || wy < 0 || wy >= gridH {
+				copy(img.Pix[o:o+4], []byte{0, 0, 0, 0xFF})
+				continue
+			}
+			copy(img.Pix[o:o+4], g.pixels.Pix[4*(wy*gridW+wx):])
+		}
+	}
+	g.web.Publish(img)
 }
 
-// ---- Color map ----
-func colorRamp(v float64) (r, g, b uint8) {
-	v = clamp(v, 0, 1)
-	if v < 0.5 {
-		t := v / 0.5
-		return uint8(20 + 50*t), uint8(50 + 150*t), uint8(200 - 100*t)
+// runHeadless updates the game at headlessTPS without a window, for the browser viewer
+func (g *Game) runHeadless() error {
+	tick := time.NewTicker(time.Second / headlessTPS)
+	defer tick.Stop()
+	for range tick.C {
+		if err := g.Update(); err != nil {
+			return err
+		}
 	}
-	t := (v - 0.5) / 0.5
-	return uint8(70 + 180*t), uint8(200 - 80*t), uint8(100 + 150*t)
+	return nil
+}
+
+func (g *Game) Layout(outW, outH int) (int, int) {
+	return screenW, screenH
 }
 
 func main() {
-	ebiten.SetWindowSize(800, 600)
+	ebiten.SetWindowSize(screenW, screenH)
 	ebiten.SetWindowTitle("Lenia with Camera Controls")
 
-	if err := ebiten.RunGame(NewGame()); err != nil {
+	paletteSpec := flag.String("palette", "classic", "colormap: classic, viridis, magma, inferno, cividis, twilight, greyscale or a gradient file")
+	web := newWebViewFlags()
+	flag.Parse()
+	palettes, err := newPaletteCycle(*paletteSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if web.Headless && !web.Enabled() {
+		log.Fatal("-web-headless needs -web")
+	}
+
+	game := NewGame()
+	game.palettes = palettes
+	if web.Enabled() {
+		if err := web.Start(); err != nil {
+			log.Fatal(err)
+		}
+		game.web = web
+		game.webFrame = image.NewRGBA(image.Rect(0, 0, screenW, screenH))
+	}
+	if web.Headless {
+		if err := game.runHeadless(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := ebiten.RunGame(game); err != nil {
 		log.Fatal(err)
 	}
 }
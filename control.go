@@ -0,0 +1,444 @@
+// control.go
+//
+// A JSON control API for scripting experiments against a running simulation. A program
+// registers its parameters with their ranges and its actions (snapshot, reseed, ...);
+// clients list and set parameters, pause, single-step and resume, run actions and
+// subscribe to the statistics the program publishes. Requests are queued and carried out
+// by the program between two steps, so a set of several parameters lands atomically.
+// The server listens on a TCP address or, given unix:/path, on a Unix socket. Requests
+// that change the run must be POSTs with Content-Type application/json:
+//
+//	curl localhost:7070/params
+//	curl -H 'Content-Type: application/json' -d '{"mu": 0.31, "sigma": 0.05}' localhost:7070/params
+//	curl -H 'Content-Type: application/json' -X POST 'localhost:7070/step?n=10'
+//	curl -H 'Content-Type: application/json' -X POST localhost:7070/action/snapshot
+//	curl -N localhost:7070/stats/stream
+//	curl --unix-socket /tmp/lenia.sock http://x/stats
+//
+// There is no authentication: anyone who can reach the address can steer the run, so
+// listen on 127.0.0.1:7070 or a Unix socket rather than :7070 on shared networks. The
+// content type check keeps web pages in a local browser out, since browsers only send a
+// cross-origin JSON POST after a CORS preflight that this server never grants.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	controlQueue   = 16              // requests waiting for the program
+	controlTimeout = 5 * time.Second // how long a request waits for room in the queue
+	controlMaxBody = 1 << 16         // largest request body
+)
+
+// ControlParam is a parameter clients may read and set
+type ControlParam struct {
+	Name     string
+	Min, Max float64
+	Doc      string
+	Get      func() float64
+	Set      func(float64)
+}
+
+type controlAction struct {
+	doc string
+	fn  func() (any, error)
+}
+
+type controlReq struct {
+	op    func() (any, error)
+	reply chan controlReply
+}
+
+type controlReply struct {
+	v   any
+	err error
+}
+
+// Control serves the control API for one program
+type Control struct {
+	Addr       string // TCP address or unix:/path, "" for no server
+	StatsEvery int    // steps between published statistics
+
+	// owned by the program goroutine
+	params  []ControlParam
+	actions map[string]controlAction
+	paused  bool
+	pending int // single steps left while paused
+	steps   int
+	statsAt int // step of the latest statistics
+
+	reqs chan controlReq
+
+	mu     sync.Mutex
+	stats  []byte // latest statistics as a JSON line
+	subs   map[chan []byte]bool
+	closed bool
+}
+
+// newControlFlags registers the control flags and returns the Control they fill in once
+// flag.Parse has run
+func newControlFlags() *Control {
+	c := &Control{actions: map[string]controlAction{}, subs: map[chan []byte]bool{}}
+	flag.StringVar(&c.Addr, "control", "", "serve the JSON control API on this address, e.g. 127.0.0.1:7070 or unix:/tmp/sim.sock (no authentication)")
+	flag.IntVar(&c.StatsEvery, "control-stats-every", 10, "steps between statistics published to control clients")
+	return c
+}
+
+// Enabled reports whether the server was asked for
+func (c *Control) Enabled() bool { return c.Addr != "" }
+
+// Param registers a parameter; register everything before Start
+func (c *Control) Param(p ControlParam) { c.params = append(c.params, p) }
+
+// Action registers a named action whose result is returned to the client as JSON
+func (c *Control) Action(name, doc string, fn func() (any, error)) {
+	c.actions[name] = controlAction{doc, fn}
+}
+
+// Start listens on Addr and serves the API in the background
+func (c *Control) Start() error {
+	if c.StatsEvery < 1 {
+		c.StatsEvery = 1
+	}
+	c.reqs = make(chan controlReq, controlQueue)
+	network, addr := "tcp", c.Addr
+	if strings.HasPrefix(addr, "unix:") {
+		network, addr = "unix", strings.TrimPrefix(addr, "unix:")
+		// a socket left behind by an earlier run would make Listen fail
+		if fi, err := os.Stat(addr); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(addr)
+		}
+	}
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", c.serveStatus)
+	mux.HandleFunc("/params", c.serveParams)
+	mux.HandleFunc("/pause", c.servePause)
+	mux.HandleFunc("/resume", c.servePause)
+	mux.HandleFunc("/step", c.servePause)
+	mux.HandleFunc("/action/", c.serveAction)
+	mux.HandleFunc("/stats", c.serveStats)
+	mux.HandleFunc("/stats/stream", c.serveStatsStream)
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			log.Printf("control: %v", err)
+		}
+	}()
+	log.Printf("control API on %s %s", network, ln.Addr())
+	return nil
+}
+
+// Close removes a Unix socket and ends the statistics streams
+func (c *Control) Close() {
+	if strings.HasPrefix(c.Addr, "unix:") {
+		os.Remove(strings.TrimPrefix(c.Addr, "unix:"))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		for s := range c.subs {
+			close(s)
+		}
+	}
+}
+
+// ---------- Program side ----------
+// Apply carries out the queued requests; call it between steps
+func (c *Control) Apply() {
+	for {
+		select {
+		case r := <-c.reqs:
+			v, err := r.op()
+			r.reply <- controlReply{v, err}
+		default:
+			return
+		}
+	}
+}
+
+// ShouldStep reports whether the program should advance a step now: always while
+// running, and once per requested single step while paused. It counts the steps taken.
+func (c *Control) ShouldStep() bool {
+	if c.paused {
+		if c.pending == 0 {
+			return false
+		}
+		c.pending--
+	}
+	c.steps++
+	return true
+}
+
+// Paused reports whether the simulation is paused by a client
+func (c *Control) Paused() bool { return c.paused }
+
+// Steps is the number of steps taken
+func (c *Control) Steps() int { return c.steps }
+
+// Stats publishes the statistics from fn every StatsEvery steps, with the step count
+// added; call it after each step
+func (c *Control) Stats(fn func() map[string]any) {
+	if c.reqs == nil || c.steps == c.statsAt || c.steps%c.StatsEvery != 0 {
+		return
+	}
+	c.statsAt = c.steps
+	s := fn()
+	s["step"] = c.steps
+	line, err := json.Marshal(s)
+	if err != nil {
+		log.Printf("control: %v", err)
+		return
+	}
+	line = append(line, '\n')
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats = line
+	for sub := range c.subs {
+		// a client that does not keep up misses records rather than stalling the program
+		select {
+		case sub <- line:
+		default:
+		}
+	}
+}
+
+// ---------- HTTP side ----------
+// call runs op on the program goroutine and returns its result. Once queued the op will
+// run, so the reply is awaited however long the program takes to get to it.
+func (c *Control) call(op func() (any, error)) (any, error) {
+	r := controlReq{op, make(chan controlReply, 1)}
+	select {
+	case c.reqs <- r:
+	case <-time.After(controlTimeout):
+		return nil, errors.New("simulation busy")
+	}
+	rep := <-r.reply
+	return rep.v, rep.err
+}
+
+// jsonPost checks that r is a POST (or PUT, if allowed) declared as JSON and answers it
+// with an error otherwise
+func (c *Control) jsonPost(w http.ResponseWriter, r *http.Request, put bool) bool {
+	if r.Method != http.MethodPost && !(put && r.Method == http.MethodPut) {
+		http.Error(w, "POST", http.StatusMethodNotAllowed)
+		return false
+	}
+	if t, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); t != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return false
+	}
+	return true
+}
+
+func (c *Control) respond(w http.ResponseWriter, v any, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		v = map[string]string{"error": err.Error()}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+type controlParamJSON struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Doc   string  `json:"doc"`
+}
+
+func (c *Control) paramList() []controlParamJSON {
+	out := make([]controlParamJSON, len(c.params))
+	for i, p := range c.params {
+		out[i] = controlParamJSON{p.Name, p.Get(), p.Min, p.Max, p.Doc}
+	}
+	return out
+}
+
+func (c *Control) status() map[string]any {
+	actions := make([]string, 0, len(c.actions))
+	for name := range c.actions {
+		actions = append(actions, name)
+	}
+	sort.Strings(actions)
+	return map[string]any{"paused": c.paused, "step": c.steps, "pending": c.pending, "actions": actions}
+}
+
+// serveStatus describes the run: paused or not, steps taken and the actions available
+func (c *Control) serveStatus(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	v, err := c.call(func() (any, error) { return c.status(), nil })
+	c.respond(w, v, err)
+}
+
+// serveParams lists the parameters on GET and sets them on POST from a JSON object of
+// name: value pairs. Either every value is in range and all are set, or none is.
+func (c *Control) serveParams(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		v, err := c.call(func() (any, error) { return c.paramList(), nil })
+		c.respond(w, v, err)
+	case http.MethodPost, http.MethodPut:
+		if !c.jsonPost(w, r, true) {
+			return
+		}
+		var set map[string]float64
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, controlMaxBody)).Decode(&set); err != nil {
+			c.respond(w, nil, fmt.Errorf("want a JSON object of parameter values: %v", err))
+			return
+		}
+		v, err := c.call(func() (any, error) {
+			byName := map[string]ControlParam{}
+			for _, p := range c.params {
+				byName[p.Name] = p
+			}
+			for name, x := range set {
+				p, ok := byName[name]
+				if !ok {
+					return nil, fmt.Errorf("unknown parameter %q", name)
+				}
+				if x < p.Min || x > p.Max {
+					return nil, fmt.Errorf("%s = %g outside [%g, %g]", name, x, p.Min, p.Max)
+				}
+			}
+			for name, x := range set {
+				byName[name].Set(x)
+			}
+			return c.paramList(), nil
+		})
+		c.respond(w, v, err)
+	default:
+		http.Error(w, "GET or POST", http.StatusMethodNotAllowed)
+	}
+}
+
+// servePause handles /pause, /resume and /step?n=N; stepping pauses a running simulation
+// and queues N single steps
+func (c *Control) servePause(w http.ResponseWriter, r *http.Request) {
+	if !c.jsonPost(w, r, false) {
+		return
+	}
+	n := 1
+	if s := r.URL.Query().Get("n"); s != "" {
+		var err error
+		if n, err = strconv.Atoi(s); err != nil || n < 1 {
+			c.respond(w, nil, fmt.Errorf("bad step count %q", s))
+			return
+		}
+	}
+	v, err := c.call(func() (any, error) {
+		switch r.URL.Path {
+		case "/pause":
+			c.paused, c.pending = true, 0
+		case "/resume":
+			c.paused, c.pending = false, 0
+		case "/step":
+			c.paused = true
+			c.pending += n
+		}
+		return c.status(), nil
+	})
+	c.respond(w, v, err)
+}
+
+// serveAction runs /action/<name> on POST and lists the actions on GET /action/
+func (c *Control) serveAction(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/action/")
+	if name == "" && r.Method == http.MethodGet {
+		v, err := c.call(func() (any, error) {
+			docs := map[string]string{}
+			for n, a := range c.actions {
+				docs[n] = a.doc
+			}
+			return docs, nil
+		})
+		c.respond(w, v, err)
+		return
+	}
+	if !c.jsonPost(w, r, false) {
+		return
+	}
+	v, err := c.call(func() (any, error) {
+		a, ok := c.actions[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown action %q", name)
+		}
+		return a.fn()
+	})
+	c.respond(w, v, err)
+}
+
+// serveStats returns the latest statistics
+func (c *Control) serveStats(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	line := c.stats
+	c.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if line == nil {
+		line = []byte("null\n")
+	}
+	w.Write(line)
+}
+
+// serveStatsStream sends every published statistics record as one JSON line
+func (c *Control) serveStatsStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	sub := make(chan []byte, 16)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.subs[sub] = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		if !c.closed {
+			delete(c.subs, sub)
+		}
+		c.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line, ok := <-sub:
+			if !ok {
+				return
+			}
+			if _, err := w.Write(line); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
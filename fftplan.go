@@ -0,0 +1,177 @@
+// fftplan.go
+//
+// Planned FFTs: twiddles, bit-reversal tables and scratch space are computed once per
+// size, so transforms run in place without allocating. Power-of-two sizes use an
+// iterative radix-2 transform, other sizes go through Bluestein's chirp-z algorithm.
+package main
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// FFTPlan transforms complex sequences of one fixed length. A plan owns its scratch
+// space, so it must not be used from several goroutines at once.
+type FFTPlan struct {
+	n int
+
+	// radix-2 tables for size m (m == n for powers of two, the Bluestein size otherwise)
+	m   int
+	rev []int
+	tw  []complex128 // exp(-2πik/m) for k < m/2
+
+	// Bluestein
+	chirp   []complex128 // exp(-iπk²/n) for k < n
+	chirpFT []complex128 // transform of the conjugate chirp filter, length m
+	work    []complex128
+}
+
+func newFFTPlan(n int) *FFTPlan {
+	p := &FFTPlan{n: n, m: 1}
+	for p.m < n {
+		p.m <<= 1
+	}
+	if p.m != n {
+		for p.m < 2*n-1 {
+			p.m <<= 1
+		}
+	}
+	p.rev = make([]int, p.m)
+	bits := 0
+	for 1<<bits < p.m {
+		bits++
+	}
+	for i := range p.rev {
+		r := 0
+		for b := 0; b < bits; b++ {
+			r |= (i >> b & 1) << (bits - 1 - b)
+		}
+		p.rev[i] = r
+	}
+	p.tw = make([]complex128, p.m/2)
+	for k := range p.tw {
+		p.tw[k] = cmplx.Rect(1, -2*math.Pi*float64(k)/float64(p.m))
+	}
+	if p.m == n {
+		return p
+	}
+
+	p.chirp = make([]complex128, n)
+	for k := range p.chirp {
+		// k² mod 2n keeps the angle small and exact for large k
+		p.chirp[k] = cmplx.Rect(1, -math.Pi*float64(k*k%(2*n))/float64(n))
+	}
+	p.chirpFT = make([]complex128, p.m)
+	p.chirpFT[0] = 1
+	for k := 1; k < n; k++ {
+		c := cmplx.Conj(p.chirp[k])
+		p.chirpFT[k] = c
+		p.chirpFT[p.m-k] = c
+	}
+	p.radix2(p.chirpFT, false)
+	p.work = make([]complex128, p.m)
+	return p
+}
+
+// Len is the sequence length the plan was made for
+func (p *FFTPlan) Len() int { return p.n }
+
+// Transform replaces a (of length Len) by its DFT. The inverse is unnormalized; divide
+// by Len to undo a forward transform.
+func (p *FFTPlan) Transform(a []complex128, inverse bool) {
+	if p.m == p.n {
+		p.radix2(a, inverse)
+		return
+	}
+	if inverse {
+		for i := range a {
+			a[i] = cmplx.Conj(a[i])
+		}
+	}
+	p.bluestein(a)
+	if inverse {
+		for i := range a {
+			a[i] = cmplx.Conj(a[i])
+		}
+	}
+}
+
+// radix2 is the iterative in-place Cooley-Tukey transform of a length-m buffer
+func (p *FFTPlan) radix2(a []complex128, inverse bool) {
+	m := p.m
+	for i, r := range p.rev {
+		if i < r {
+			a[i], a[r] = a[r], a[i]
+		}
+	}
+	for size := 2; size <= m; size <<= 1 {
+		half, step := size/2, m/size
+		for start := 0; start < m; start += size {
+			for k := 0; k < half; k++ {
+				w := p.tw[k*step]
+				if inverse {
+					w = cmplx.Conj(w)
+				}
+				u, v := a[start+k], a[start+k+half]*w
+				a[start+k] = u + v
+				a[start+k+half] = u - v
+			}
+		}
+	}
+}
+
+// bluestein computes the forward DFT of a as a circular convolution with a chirp
+func (p *FFTPlan) bluestein(a []complex128) {
+	w := p.work
+	for k := 0; k < p.n; k++ {
+		w[k] = a[k] * p.chirp[k]
+	}
+	for k := p.n; k < p.m; k++ {
+		w[k] = 0
+	}
+	p.radix2(w, false)
+	for k := range w {
+		w[k] *= p.chirpFT[k]
+	}
+	p.radix2(w, true)
+	scale := complex(1/float64(p.m), 0)
+	for k := 0; k < p.n; k++ {
+		a[k] = w[k] * scale * p.chirp[k]
+	}
+}
+
+// ---------- 2D ----------
+// FFT2Plan transforms row-major w×h grids, rows then columns
+type FFT2Plan struct {
+	w, h     int
+	row, col *FFTPlan
+	column   []complex128
+}
+
+func newFFT2Plan(w, h int) *FFT2Plan {
+	p := &FFT2Plan{w: w, h: h, row: newFFTPlan(w), column: make([]complex128, h)}
+	if h == w {
+		p.col = p.row
+	} else {
+		p.col = newFFTPlan(h)
+	}
+	return p
+}
+
+// Transform replaces data by its 2D DFT in place; the inverse is unnormalized
+func (p *FFT2Plan) Transform(data []complex128, inverse bool) {
+	w, h := p.w, p.h
+	for y := 0; y < h; y++ {
+		p.row.Transform(data[y*w:(y+1)*w], inverse)
+	}
+	col := p.column
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			col[y] = data[y*w+x]
+		}
+		p.col.Transform(col, inverse)
+		for y := 0; y < h; y++ {
+			data[y*w+x] = col[y]
+		}
+	}
+}
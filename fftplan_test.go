@@ -0,0 +1,245 @@
+// test: go test -bench . fftplan_test.go fftplan.go spectral.go
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+)
+
+// naiveDFT is the O(n²) definition the plans are checked against
+func naiveDFT(a []complex128, inverse bool) []complex128 {
+	n := len(a)
+	sign := -1.0
+	if inverse {
+		sign = 1
+	}
+	out := make([]complex128, n)
+	for k := range out {
+		var s complex128
+		for j, v := range a {
+			// j·k mod n keeps the angle exact for large sizes
+			s += v * cmplx.Rect(1, sign*2*math.Pi*float64(j*k%n)/float64(n))
+		}
+		out[k] = s
+	}
+	return out
+}
+
+func randomSequence(rng *rand.Rand, n int) []complex128 {
+	a := make([]complex128, n)
+	for i := range a {
+		a[i] = complex(rng.NormFloat64(), rng.NormFloat64())
+	}
+	return a
+}
+
+func maxDiff(a, b []complex128) float64 {
+	var d float64
+	for i := range a {
+		d = math.Max(d, cmplx.Abs(a[i]-b[i]))
+	}
+	return d
+}
+
+func TestFFTPlanMatchesDFT(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, tc := range []struct {
+		n    int
+		path string
+	}{
+		{1, "radix-2"},
+		{2, "radix-2"},
+		{8, "radix-2"},
+		{256, "radix-2"},
+		{3, "Bluestein"},
+		{5, "Bluestein"},
+		{12, "Bluestein"},
+		{100, "Bluestein"},
+		{400, "Bluestein"},
+	} {
+		p := newFFTPlan(tc.n)
+		for _, inverse := range []bool{false, true} {
+			a := randomSequence(rng, tc.n)
+			want := naiveDFT(a, inverse)
+			p.Transform(a, inverse)
+			if d := maxDiff(a, want); d > 1e-9*float64(tc.n) {
+				t.Errorf("n=%d (%s) inverse=%v: differs from the DFT by %g", tc.n, tc.path, inverse, d)
+			}
+		}
+	}
+}
+
+func TestFFTPlanRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for _, n := range []int{16, 60, 240} {
+		p := newFFTPlan(n)
+		a := randomSequence(rng, n)
+		b := append([]complex128(nil), a...)
+		p.Transform(b, false)
+		p.Transform(b, true)
+		for i := range b {
+			b[i] /= complex(float64(n), 0)
+		}
+		if d := maxDiff(a, b); d > 1e-10 {
+			t.Errorf("n=%d: forward and inverse differ from the input by %g", n, d)
+		}
+	}
+}
+
+func TestFFT2PlanMatchesDFT(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	for _, sz := range [][2]int{{8, 4}, {6, 5}, {12, 16}} {
+		w, h := sz[0], sz[1]
+		data := randomSequence(rng, w*h)
+		// rows, then columns, each by the definition
+		want := make([]complex128, w*h)
+		for y := 0; y < h; y++ {
+			copy(want[y*w:], naiveDFT(data[y*w:(y+1)*w], false))
+		}
+		col := make([]complex128, h)
+		for x := 0; x < w; x++ {
+			for y := range col {
+				col[y] = want[y*w+x]
+			}
+			for y, v := range naiveDFT(col, false) {
+				want[y*w+x] = v
+			}
+		}
+		newFFT2Plan(w, h).Transform(data, false)
+		if d := maxDiff(data, want); d > 1e-9*float64(w*h) {
+			t.Errorf("%dx%d: differs from the DFT by %g", w, h, d)
+		}
+	}
+}
+
+// ---------- Benchmarks ----------
+// benchSize is the lattice width of tres.main.go; it is not a power of two, so its rows
+// go through Bluestein unless padded
+const benchSize = 400
+
+// legacyFFT is the recursive radix-2 transform the row filter used to call, kept only as
+// the benchmark baseline
+func legacyFFT(a []complex128) []complex128 {
+	n := len(a)
+	if n == 1 {
+		return []complex128{a[0]}
+	}
+	even := make([]complex128, n/2)
+	odd := make([]complex128, n/2)
+	for i := 0; i < n/2; i++ {
+		even[i] = a[2*i]
+		odd[i] = a[2*i+1]
+	}
+	even = legacyFFT(even)
+	odd = legacyFFT(odd)
+	res := make([]complex128, n)
+	for k := 0; k < n/2; k++ {
+		t := cmplx.Exp(complex(0, -2*math.Pi*float64(k)/float64(n))) * odd[k]
+		res[k] = even[k] + t
+		res[k+n/2] = even[k] - t
+	}
+	return res
+}
+
+func legacyIFFT(A []complex128) []complex128 {
+	n := len(A)
+	conj := make([]complex128, n)
+	for i := 0; i < n; i++ {
+		conj[i] = cmplx.Conj(A[i])
+	}
+	y := legacyFFT(conj)
+	res := make([]complex128, n)
+	for i := 0; i < n; i++ {
+		res[i] = cmplx.Conj(y[i]) / complex(float64(n), 0)
+	}
+	return res
+}
+
+func benchField(size int) [][]float64 {
+	rng := rand.New(rand.NewSource(1))
+	field := make([][]float64, size)
+	for y := range field {
+		field[y] = make([]float64, size)
+		for x := range field[y] {
+			field[y][x] = rng.Float64()
+		}
+	}
+	return field
+}
+
+func benchPadded(size int) int {
+	padded := 1
+	for padded < size {
+		padded <<= 1
+	}
+	return padded
+}
+
+// one filter pass over the rows: forward and inverse transform of each
+func BenchmarkLegacyRows(b *testing.B) {
+	field := benchField(benchSize)
+	buf := make([]complex128, benchPadded(benchSize))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for y := range field {
+			for x := range buf {
+				buf[x] = 0
+			}
+			for x, v := range field[y] {
+				buf[x] = complex(v, 0)
+			}
+			legacyIFFT(legacyFFT(buf))
+		}
+	}
+}
+
+func BenchmarkPlanRows(b *testing.B) {
+	field := benchField(benchSize)
+	for _, n := range []int{benchSize, benchPadded(benchSize)} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			p := newFFTPlan(n)
+			buf := make([]complex128, n)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for y := range field {
+					for x := range buf {
+						buf[x] = 0
+					}
+					for x, v := range field[y] {
+						buf[x] = complex(v, 0)
+					}
+					p.Transform(buf, false)
+					p.Transform(buf, true)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPlan2D(b *testing.B) {
+	field := benchField(benchSize)
+	p := newFFT2Plan(benchSize, benchSize)
+	data := make([]complex128, benchSize*benchSize)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for y, row := range field {
+			for x, v := range row {
+				data[y*benchSize+x] = complex(v, 0)
+			}
+		}
+		p.Transform(data, false)
+		p.Transform(data, true)
+	}
+}
+
+func BenchmarkSpectralFilter(b *testing.B) {
+	field := benchField(benchSize)
+	f := &SpectralFilter{Kind: Lowpass, Cutoff: 0.3, Width: filterWidth, Every: 1}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		f.Apply(field)
+	}
+}
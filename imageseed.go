@@ -0,0 +1,207 @@
+// imageseed.go
+//
+// Seeding simulations from pictures: a PNG or JPEG becomes a Lenia starting field (its
+// luminance or one channel, area-averaged onto the grid), or a particle layout drawn with
+// probability proportional to brightness where each particle carries the hue of its pixel.
+// A screenshot of a run can be fed back in this way.
+// Example flags: -image screenshot.png.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"sort"
+)
+
+// ImageSeed is the picture a program starts from
+type ImageSeed struct {
+	Path    string // PNG or JPEG, "" for the program's own start
+	Channel string // lum, r, g, b, a, sat or val
+	Invert  bool   // use 1 - channel, e.g. for dark figures on a light background
+}
+
+var imageChannels = []string{"lum", "r", "g", "b", "a", "sat", "val"}
+
+// imageGreySat is the saturation below which a pixel's hue means nothing
+const imageGreySat = 0.15
+
+// newImageSeedFlags registers the image flags and returns the ImageSeed they fill in once
+// flag.Parse has run
+func newImageSeedFlags() *ImageSeed {
+	s := &ImageSeed{}
+	flag.StringVar(&s.Path, "image", "", "PNG or JPEG to seed the simulation from")
+	flag.StringVar(&s.Channel, "image-channel", "lum", "image channel used as density: lum, r, g, b, a, sat or val")
+	flag.BoolVar(&s.Invert, "image-invert", false, "invert the image channel")
+	return s
+}
+
+// Enabled reports whether an image was given
+func (s *ImageSeed) Enabled() bool { return s.Path != "" }
+
+// load decodes the image and checks the channel name
+func (s *ImageSeed) load() (image.Image, error) {
+	known := false
+	for _, c := range imageChannels {
+		known = known || c == s.Channel
+	}
+	if !known {
+		return nil, fmt.Errorf("image channel %q, want one of %v", s.Channel, imageChannels)
+	}
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", s.Path, err)
+	}
+	return img, nil
+}
+
+// value is the chosen channel of c in [0, 1]
+func (s *ImageSeed) value(c color.Color) float64 {
+	r16, g16, b16, a16 := c.RGBA()
+	r, g, b, a := float64(r16)/0xffff, float64(g16)/0xffff, float64(b16)/0xffff, float64(a16)/0xffff
+	var v float64
+	switch s.Channel {
+	case "r":
+		v = r
+	case "g":
+		v = g
+	case "b":
+		v = b
+	case "a":
+		v = a
+	case "sat":
+		_, v, _ = rgbToHSV(r, g, b)
+	case "val":
+		_, _, v = rgbToHSV(r, g, b)
+	default:
+		// Rec. 709 luma of the premultiplied colour, so transparent areas are dark
+		v = 0.2126*r + 0.7152*g + 0.0722*b
+	}
+	if s.Invert {
+		v = 1 - v
+	}
+	return v
+}
+
+// rgbToHSV returns the hue in degrees and saturation and value in [0, 1]
+func rgbToHSV(r, g, b float64) (h, s, v float64) {
+	v = math.Max(r, math.Max(g, b))
+	c := v - math.Min(r, math.Min(g, b))
+	if v > 0 {
+		s = c / v
+	}
+	switch {
+	case c == 0:
+		h = 0
+	case v == r:
+		h = 60 * math.Mod((g-b)/c+6, 6)
+	case v == g:
+		h = 60 * ((b-r)/c + 2)
+	default:
+		h = 60 * ((r-g)/c + 4)
+	}
+	return h, s, v
+}
+
+// ---------- Fields ----------
+// Field resamples the image to a w×h field. Each cell averages the pixels it covers, or
+// takes the nearest pixel when the image is smaller than the grid.
+func (s *ImageSeed) Field(w, h int) ([][]float64, error) {
+	img, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	A := make([][]float64, h)
+	for y := range A {
+		A[y] = make([]float64, w)
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := b.Min.Y + (y+1)*b.Dy()/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := range A[y] {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := b.Min.X + (x+1)*b.Dx()/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var sum float64
+			for py := y0; py < y1; py++ {
+				for px := x0; px < x1; px++ {
+					sum += s.value(img.At(px, py))
+				}
+			}
+			A[y][x] = sum / float64((x1-x0)*(y1-y0))
+		}
+	}
+	return A, nil
+}
+
+// ---------- Particle layouts ----------
+// ImageSampler draws image positions with probability proportional to the channel value
+type ImageSampler struct {
+	img  image.Image
+	w, h int
+	cdf  []float64 // cumulative channel value over the pixels in row-major order
+}
+
+// Sampler prepares drawing positions from the image
+func (s *ImageSeed) Sampler() (*ImageSampler, error) {
+	img, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	is := &ImageSampler{img: img, w: b.Dx(), h: b.Dy(), cdf: make([]float64, b.Dx()*b.Dy())}
+	var sum float64
+	for y := 0; y < is.h; y++ {
+		for x := 0; x < is.w; x++ {
+			sum += math.Max(0, s.value(img.At(b.Min.X+x, b.Min.Y+y)))
+			is.cdf[y*is.w+x] = sum
+		}
+	}
+	if sum == 0 {
+		return nil, fmt.Errorf("%s: channel %s is zero everywhere", s.Path, s.Channel)
+	}
+	return is, nil
+}
+
+// Sample draws a position u, v in [0, 1) relative to the image size, jittered within its
+// pixel, and the hue of the pixel in degrees with its saturation; below imageGreySat the
+// hue should be ignored. rnd returns uniform numbers in [0, 1).
+func (is *ImageSampler) Sample(rnd func() float64) (u, v, hue, sat float64) {
+	// the first pixel whose cumulative value passes the target, so black pixels are never drawn
+	t := rnd() * is.cdf[len(is.cdf)-1]
+	i := sort.Search(len(is.cdf), func(i int) bool { return is.cdf[i] > t })
+	if i >= len(is.cdf) {
+		i = len(is.cdf) - 1
+	}
+	x, y := i%is.w, i/is.w
+	b := is.img.Bounds()
+	r16, g16, b16, _ := is.img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+	hue, sat, _ = rgbToHSV(float64(r16)/0xffff, float64(g16)/0xffff, float64(b16)/0xffff)
+	return (float64(x) + rnd()) / float64(is.w), (float64(y) + rnd()) / float64(is.h), hue, sat
+}
+
+// nearestHue returns the index of the hue in hues closest to h around the colour circle
+func nearestHue(h float64, hues []float64) int {
+	best, bestD := 0, math.Inf(1)
+	for i, c := range hues {
+		d := math.Abs(math.Mod(h-c+540, 360) - 180)
+		if d < bestD {
+			best, bestD = i, d
+		}
+	}
+	return best
+}
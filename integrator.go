@@ -0,0 +1,260 @@
+// integrator.go
+//
+// Explicit integrators for the chaotic attractors and the Lenia field update.
+// Example flags: -integrator rk45 -field rk4.
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Method selects an integration scheme
+type Method int
+
+const (
+	Euler Method = iota
+	Midpoint
+	RK4
+	RK45 // adaptive Dormand-Prince, attractors only
+)
+
+var methodNames = [...]string{"euler", "midpoint", "rk4", "rk45"}
+
+func (m Method) String() string { return methodNames[m] }
+
+func parseMethod(s string) (Method, error) {
+	for i, n := range methodNames {
+		if n == s {
+			return Method(i), nil
+		}
+	}
+	return Euler, fmt.Errorf("unknown integrator %q (want euler, midpoint, rk4 or rk45)", s)
+}
+
+// odeMethod is the scheme given to attractors built by newModulator; set it from a flag
+// before parsing bindings
+var odeMethod = Euler
+
+// ---------- Attractor integration ----------
+const (
+	odeTol    = 1e-6   // RK45 local error tolerance per step
+	odeMinSub = 1e-6   // smallest RK45 sub-step before giving up on the tolerance
+	odeMaxSub = 100000 // RK45 sub-steps per call before giving up on the rest of dt
+)
+
+type vec3 [3]float64
+
+func (a vec3) add(b vec3, s float64) vec3 {
+	return vec3{a[0] + s*b[0], a[1] + s*b[1], a[2] + s*b[2]}
+}
+
+// odeSystem is an attractor whose state and derivative can be integrated generically
+type odeSystem interface {
+	state() vec3
+	deriv(vec3) vec3
+	stepSize() float64
+}
+
+// stepODE advances s by dt. RK45 covers dt with as many adaptive sub-steps as the
+// tolerance needs, so the same dt stays accurate where Euler would drift.
+func stepODE(m Method, f func(vec3) vec3, s vec3, dt float64) vec3 {
+	switch m {
+	case Midpoint:
+		k1 := f(s)
+		return s.add(f(s.add(k1, dt/2)), dt)
+	case RK4:
+		k1 := f(s)
+		k2 := f(s.add(k1, dt/2))
+		k3 := f(s.add(k2, dt/2))
+		k4 := f(s.add(k3, dt))
+		for i := range s {
+			s[i] += dt / 6 * (k1[i] + 2*k2[i] + 2*k3[i] + k4[i])
+		}
+		return s
+	case RK45:
+		return adaptiveODE(f, s, dt, odeTol)
+	}
+	return s.add(f(s), dt)
+}
+
+// adaptiveODE integrates over dt with Dormand-Prince 5(4) sub-steps. A state that has
+// overflowed is returned as soon as the smallest sub-step cannot avoid it, and after
+// odeMaxSub sub-steps the state reached so far is returned.
+func adaptiveODE(f func(vec3) vec3, s vec3, dt, tol float64) vec3 {
+	h := dt
+	for done, n := 0.0, 0; done < dt && n < odeMaxSub; n++ {
+		if h > dt-done {
+			h = dt - done
+		}
+		next, errEst := dopri5(f, s, h)
+		if math.IsNaN(errEst) || math.IsInf(errEst, 0) {
+			// a stage overflowed: retry smaller, keeping h finite
+			if h <= odeMinSub {
+				return next
+			}
+			h = math.Max(h/2, odeMinSub)
+			continue
+		}
+		if errEst <= tol || h <= odeMinSub {
+			s = next
+			done += h
+		}
+		// standard step size controller with a safety factor
+		scale := 0.9 * math.Pow(tol/math.Max(errEst, 1e-300), 0.2)
+		h *= math.Max(0.2, math.Min(5, scale))
+		h = math.Max(h, odeMinSub)
+	}
+	return s
+}
+
+// dopri5 takes one Dormand-Prince step and returns the 5th order result together with
+// the max-norm difference to the embedded 4th order one
+func dopri5(f func(vec3) vec3, s vec3, h float64) (vec3, float64) {
+	k1 := f(s)
+	k2 := f(s.add(k1, h/5))
+	k3 := f(comb(s, h, []float64{3.0 / 40, 9.0 / 40}, k1, k2))
+	k4 := f(comb(s, h, []float64{44.0 / 45, -56.0 / 15, 32.0 / 9}, k1, k2, k3))
+	k5 := f(comb(s, h, []float64{19372.0 / 6561, -25360.0 / 2187, 64448.0 / 6561, -212.0 / 729}, k1, k2, k3, k4))
+	k6 := f(comb(s, h, []float64{9017.0 / 3168, -355.0 / 33, 46732.0 / 5247, 49.0 / 176, -5103.0 / 18656}, k1, k2, k3, k4, k5))
+	y5 := comb(s, h, []float64{35.0 / 384, 0, 500.0 / 1113, 125.0 / 192, -2187.0 / 6784, 11.0 / 84}, k1, k2, k3, k4, k5, k6)
+	k7 := f(y5)
+	y4 := comb(s, h, []float64{5179.0 / 57600, 0, 7571.0 / 16695, 393.0 / 640, -92097.0 / 339200, 187.0 / 2100, 1.0 / 40}, k1, k2, k3, k4, k5, k6, k7)
+	var errEst float64
+	for i := range y5 {
+		errEst = math.Max(errEst, math.Abs(y5[i]-y4[i]))
+	}
+	return y5, errEst
+}
+
+// comb returns s + h*Σ c[i]*k[i]
+func comb(s vec3, h float64, c []float64, k ...vec3) vec3 {
+	for i := range k {
+		s = s.add(k[i], h*c[i])
+	}
+	return s
+}
+
+// compareODE runs every method for n steps from the system's current state and returns
+// each end state's distance from a tight-tolerance RK45 reference. The system itself is
+// left untouched.
+func compareODE(sys odeSystem, n int) [len(methodNames)]float64 {
+	dt := sys.stepSize()
+	ref := sys.state()
+	for i := 0; i < n; i++ {
+		ref = adaptiveODE(sys.deriv, ref, dt, 1e-11)
+	}
+	var errs [len(methodNames)]float64
+	for m := range methodNames {
+		s := sys.state()
+		for i := 0; i < n; i++ {
+			s = stepODE(Method(m), sys.deriv, s, dt)
+		}
+		errs[m] = math.Sqrt(sq(s[0]-ref[0]) + sq(s[1]-ref[1]) + sq(s[2]-ref[2]))
+	}
+	return errs
+}
+
+func sq(v float64) float64 { return v * v }
+
+// ---------- Field integration ----------
+// fieldRate writes dA/dt for the lattice src into dst
+type fieldRate func(src, dst [][]float64)
+
+// fieldStepper advances a Lenia lattice with a fixed-step scheme, keeping the stage
+// buffers between steps. Stage states are clipped to [0, 1] like the final one so the
+// growth function never sees values Lenia cannot produce.
+type fieldStepper struct {
+	Method Method
+	k      [4][][]float64
+	tmp    [][]float64
+}
+
+func newFieldStepper(m Method) (*fieldStepper, error) {
+	if m == RK45 {
+		return nil, fmt.Errorf("rk45 is only available for the attractors; use euler, midpoint or rk4 for the field")
+	}
+	return &fieldStepper{Method: m}, nil
+}
+
+func (fs *fieldStepper) alloc(h, w int) {
+	if fs.tmp != nil && len(fs.tmp) == h && len(fs.tmp[0]) == w {
+		return
+	}
+	for i := range fs.k {
+		fs.k[i] = newLattice(h, w)
+	}
+	fs.tmp = newLattice(h, w)
+}
+
+func newLattice(h, w int) [][]float64 {
+	m := make([][]float64, h)
+	for y := range m {
+		m[y] = make([]float64, w)
+	}
+	return m
+}
+
+// stage sets tmp = clip(A + c*k)
+func (fs *fieldStepper) stage(A, k [][]float64, c float64) [][]float64 {
+	for y := range A {
+		for x := range A[y] {
+			fs.tmp[y][x] = math.Max(0, math.Min(1, A[y][x]+c*k[y][x]))
+		}
+	}
+	return fs.tmp
+}
+
+// step writes clip(A + dt*Φ) into out, where Φ is the scheme's slope estimate
+func (fs *fieldStepper) step(A, out [][]float64, dt float64, rate fieldRate) {
+	fs.alloc(len(A), len(A[0]))
+	k := fs.k
+	rate(A, k[0])
+	switch fs.Method {
+	case Midpoint:
+		rate(fs.stage(A, k[0], dt/2), k[1])
+		k[0], k[1] = k[1], k[0]
+	case RK4:
+		rate(fs.stage(A, k[0], dt/2), k[1])
+		rate(fs.stage(A, k[1], dt/2), k[2])
+		rate(fs.stage(A, k[2], dt), k[3])
+		for y := range A {
+			for x := range A[y] {
+				k[0][y][x] = (k[0][y][x] + 2*k[1][y][x] + 2*k[2][y][x] + k[3][y][x]) / 6
+			}
+		}
+	}
+	for y := range A {
+		for x := range A[y] {
+			out[y][x] = math.Max(0, math.Min(1, A[y][x]+dt*k[0][y][x]))
+		}
+	}
+}
+
+// compareField takes one step of each fixed-step method from A and returns the RMS
+// difference of each result from an RK4 reference made of four quarter steps
+func compareField(A [][]float64, dt float64, rate fieldRate) [RK4 + 1]float64 {
+	h, w := len(A), len(A[0])
+	ref, next := newLattice(h, w), newLattice(h, w)
+	for y := range A {
+		copy(ref[y], A[y])
+	}
+	fs := &fieldStepper{Method: RK4}
+	for i := 0; i < 4; i++ {
+		fs.step(ref, next, dt/4, rate)
+		ref, next = next, ref
+	}
+	var errs [RK4 + 1]float64
+	for m := Euler; m <= RK4; m++ {
+		fs.Method = m
+		fs.step(A, next, dt, rate)
+		var sum float64
+		for y := range A {
+			for x := range A[y] {
+				sum += sq(next[y][x] - ref[y][x])
+			}
+		}
+		errs[m] = math.Sqrt(sum / float64(h*w))
+	}
+	return errs
+}
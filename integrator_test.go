@@ -0,0 +1,42 @@
+// test: go test integrator_test.go integrator.go
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// exponential decay ds/dt = -s has the exact solution s·e^-t
+func TestAdaptiveODEDecay(t *testing.T) {
+	decay := func(s vec3) vec3 { return vec3{-s[0], -s[1], -s[2]} }
+	for _, dt := range []float64{0.01, 0.5, 3} {
+		got := adaptiveODE(decay, vec3{1, 2, -3}, dt, odeTol)
+		for i, s0 := range []float64{1, 2, -3} {
+			if want := s0 * math.Exp(-dt); math.Abs(got[i]-want) > 1e-5 {
+				t.Errorf("dt=%g: s[%d] = %g, want %g", dt, i, got[i], want)
+			}
+		}
+	}
+}
+
+// a derivative that overflows makes every error estimate NaN; the call must still return
+func TestAdaptiveODENonFinite(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		f    func(vec3) vec3
+		s    vec3
+	}{
+		{"infinite derivative", func(vec3) vec3 { return vec3{math.Inf(1), 0, 0} }, vec3{1, 0, 0}},
+		{"overflowing stage", func(s vec3) vec3 { return vec3{s[0] * 1e300, 0, 0} }, vec3{1e10, 0, 0}},
+		{"NaN state", func(s vec3) vec3 { return s }, vec3{math.NaN(), 0, 0}},
+	} {
+		done := make(chan vec3, 1)
+		go func() { done <- adaptiveODE(tc.f, tc.s, 0.01, odeTol) }()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: adaptiveODE did not return", tc.name)
+		}
+	}
+}
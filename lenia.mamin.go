@@ -26,6 +26,9 @@ var (
 	texture uint32
 	vao     uint32
 	program uint32
+
+	pixels  [width * height * 3]uint8 // colour buffer reused every frame
+	rampLUT [256][3]uint8             // the gradient at 256 field levels
 )
 
 func init() {
@@ -141,6 +144,9 @@ func initGL() {
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
 	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
+	// allocate the texture once; drawField only replaces its contents
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGB, int32(width), int32(height), 0, gl.RGB, gl.UNSIGNED_BYTE, nil)
+	buildRampLUT()
 
 	program = newProgram()
 	gl.UseProgram(program)
@@ -172,23 +178,29 @@ func initGL() {
 }
 
 // --- draw ---
+func buildRampLUT() {
+	for k := range rampLUT {
+		v := float32(k) / 255
+		// purple → yellow gradient
+		r := uint8(255 * v)
+		g := uint8(255 * math.Sqrt(float64(v)))
+		b := uint8(255 * (1 - v*v))
+		rampLUT[k] = [3]uint8{r, g, b}
+	}
+}
+
 func drawField() {
-	pixels := make([]uint8, width*height*3)
 	for j := 0; j < height; j++ {
 		for i := 0; i < width; i++ {
-			v := field[j][i]
-			// purple → yellow gradient
-			r := uint8(255 * v)
-			g := uint8(255 * math.Sqrt(float64(v)))
-			b := uint8(255 * (1 - v*v))
+			c := rampLUT[uint8(255*field[j][i]+0.5)]
 			idx := (j*width + i) * 3
-			pixels[idx+0] = r
-			pixels[idx+1] = g
-			pixels[idx+2] = b
+			pixels[idx+0] = c[0]
+			pixels[idx+1] = c[1]
+			pixels[idx+2] = c[2]
 		}
 	}
 	gl.BindTexture(gl.TEXTURE_2D, texture)
-	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGB, int32(width), int32(height), 0, gl.RGB, gl.UNSIGNED_BYTE, gl.Ptr(pixels))
+	gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, int32(width), int32(height), gl.RGB, gl.UNSIGNED_BYTE, gl.Ptr(pixels[:]))
 	gl.Clear(gl.COLOR_BUFFER_BIT)
 	gl.UseProgram(program)
 	gl.BindVertexArray(vao)
@@ -201,7 +213,8 @@ func main() {
 	}
 	defer glfw.Terminate()
 
-	window, err := glfw.CreateWindow(winWidth, winHeight, "Go Lenia — Modern OpenGL", nil, nil)
+	const title = "Go Lenia — Modern OpenGL"
+	window, err := glfw.CreateWindow(winWidth, winHeight, title, nil, nil)
 	if err != nil {
 		panic(err)
 	}
@@ -222,14 +235,25 @@ func main() {
 	}
 
 	last := time.Now()
+	// frame and draw times, averaged over 30 frames and shown in the title
+	frames, drawTime, titled := 0, time.Duration(0), time.Now()
 	for !window.ShouldClose() {
 		now := time.Now()
 		if now.Sub(last) > time.Millisecond*16 { // 60 FPS
 			updateField()
 			last = now
 		}
+		drawStart := time.Now()
 		drawField()
+		drawTime += time.Since(drawStart)
 		window.SwapBuffers()
 		glfw.PollEvents()
+
+		if frames++; frames == 30 {
+			frameMs := float64(time.Since(titled)) / float64(time.Millisecond) / 30
+			drawMs := float64(drawTime) / float64(time.Millisecond) / 30
+			window.SetTitle(fmt.Sprintf("%s — frame %.1f ms  draw %.2f ms", title, frameMs, drawMs))
+			frames, drawTime, titled = 0, 0, time.Now()
+		}
 	}
 }
@@ -0,0 +1,137 @@
+// lyapunov.go
+//
+// Largest Lyapunov exponent by the twin-trajectory (Benettin) method: a copy of the
+// system starts a tiny distance d0 away, both are stepped together, and every few steps
+// the separation d is logged and the twin is pulled back to d0 along the same direction.
+// The exponent is the mean growth rate log(d/d0) per unit time; positive means chaos.
+// It needs integrator.go.
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+const (
+	lyapunovEvery = 10   // steps between renormalizations
+	fieldD0       = 1e-3 // initial twin separation of a Lenia field (Euclidean over all cells)
+	odeD0         = 1e-8 // initial twin separation of an attractor
+)
+
+// Lyapunov accumulates the exponent estimate. The program steps both trajectories and
+// calls Advance once per step.
+type Lyapunov struct {
+	D0    float64 // separation the twin is renormalized to
+	Dt    float64 // time per step, may be changed between steps
+	Every int     // steps between renormalizations
+
+	Exponent  float64 // running estimate per unit time
+	Renorms   int
+	Collapsed bool // the twin merged with the reference; Exponent is -Inf
+
+	steps   int
+	span    float64 // time since the last renormalization
+	logSum  float64
+	elapsed float64
+}
+
+func newLyapunov(d0, dt float64, every int) *Lyapunov {
+	return &Lyapunov{D0: d0, Dt: dt, Every: every}
+}
+
+// Advance records one step of both trajectories. dist returns their separation and
+// rescale moves the twin towards the reference by the factor f.
+func (l *Lyapunov) Advance(dist func() float64, rescale func(f float64)) {
+	if l.Collapsed {
+		return
+	}
+	l.steps++
+	l.span += l.Dt
+	if l.steps%l.Every != 0 {
+		return
+	}
+	d := dist()
+	if d == 0 {
+		// e.g. both fields died out: no direction is left to follow
+		l.Collapsed = true
+		l.Exponent = math.Inf(-1)
+		return
+	}
+	l.logSum += math.Log(d / l.D0)
+	l.elapsed += l.span
+	l.span = 0
+	l.Exponent = l.logSum / l.elapsed
+	l.Renorms++
+	rescale(l.D0 / d)
+}
+
+// String is a HUD line
+func (l *Lyapunov) String() string {
+	switch {
+	case l.Collapsed:
+		return "λ: -inf (twin merged)"
+	case l.Renorms == 0:
+		return "λ: measuring..."
+	}
+	return fmt.Sprintf("λ: %+.4f per unit time over t=%.1f", l.Exponent, l.elapsed)
+}
+
+// ---------- Lenia fields ----------
+func fieldDistance(a, b [][]float64) float64 {
+	var s float64
+	for y := range a {
+		for x := range a[y] {
+			s += sq(a[y][x] - b[y][x])
+		}
+	}
+	return math.Sqrt(s)
+}
+
+// fieldRescale sets twin = ref + f·(twin − ref), clipped to [0, 1]
+func fieldRescale(twin, ref [][]float64, f float64) {
+	for y := range twin {
+		for x := range twin[y] {
+			twin[y][x] = math.Max(0, math.Min(1, ref[y][x]+f*(twin[y][x]-ref[y][x])))
+		}
+	}
+}
+
+// perturbField sets twin to ref plus a random offset of length d0. Cells at 0 or 1 would
+// clip the offset away, so only cells strictly inside are perturbed.
+func perturbField(twin, ref [][]float64, d0 float64, rng *rand.Rand) {
+	for y := range twin {
+		for x := range twin[y] {
+			twin[y][x] = ref[y][x]
+			if v := ref[y][x]; v > 0 && v < 1 {
+				twin[y][x] = math.Max(0, math.Min(1, v+rng.NormFloat64()*d0))
+			}
+		}
+	}
+	if d := fieldDistance(twin, ref); d > 0 {
+		fieldRescale(twin, ref, d0/d)
+	}
+}
+
+// ---------- Attractors ----------
+// odeLyapunov estimates the largest exponent of sys over n steps from its current state,
+// integrating with method m. The system itself is left untouched.
+func odeLyapunov(sys odeSystem, m Method, n int) float64 {
+	dt := sys.stepSize()
+	ref := sys.state()
+	twin := ref
+	twin[0] += odeD0
+	l := newLyapunov(odeD0, dt, lyapunovEvery)
+	dist := func() float64 { return math.Sqrt(sq(twin[0]-ref[0]) + sq(twin[1]-ref[1]) + sq(twin[2]-ref[2])) }
+	rescale := func(f float64) {
+		for i := range twin {
+			twin[i] = ref[i] + f*(twin[i]-ref[i])
+		}
+	}
+	for i := 0; i < n; i++ {
+		ref = stepODE(m, sys.deriv, ref, dt)
+		twin = stepODE(m, sys.deriv, twin, dt)
+		l.Advance(dist, rescale)
+	}
+	return l.Exponent
+}
@@ -1,31 +1,80 @@
 // lenia_evolve.go
+// run: go run main.go fftplan.go analysis.go tracking.go classify.go integrator.go lyapunov.go palette.go render.go webview.go
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"image"
 	"image/color"
 	"log"
 	"math"
 	"math/rand"
+	"os"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/hajimehoshi/ebiten/v2/vector"
 	"golang.org/x/image/font/basicfont"
 )
 
 // ---------- Simulation parameters (tweak these) ----------
 const (
-	gridW        = 200  // lattice width
-	gridH        = 120  // lattice height
-	cellSize     = 4    // display pixel size for each lattice cell
-	evalSteps    = 120  // simulation steps per genome evaluation (short)
-	populationSz = 12   // evolutionary population size
-	elitism      = 3    // keep top N as-is
-	mutationRate = 0.15 // per-parameter mutation probability
+	gridW         = 200  // lattice width
+	gridH         = 120  // lattice height
+	cellSize      = 4    // display pixel size for each lattice cell
+	evalSteps     = 120  // simulation steps per genome evaluation (short)
+	classifyEvery = 2    // evaluation steps between classifier observations; evalSteps/classifyEvery reaches classifyWarmup
+	populationSz  = 12   // evolutionary population size
+	elitism       = 3    // keep top N as-is
+	mutationRate  = 0.15 // per-parameter mutation probability (legacy mutation)
+
+	crossoverOp = "legacy" // legacy | uniform | blx | sbx
+	mutationOp  = "legacy" // legacy | self-adaptive | one-fifth
+	blxAlpha    = 0.5      // BLX-α interval extension
+	sbxEta      = 10.0     // SBX distribution index (larger keeps children closer to parents)
+	numGenes    = 6        // evolvable parameters per genome, see genes
+
+	speciation       = true // breed within distance-based species instead of one panmictic pool
+	speciesThreshold = 0.3  // map5D distance to a species representative for membership
+	speciesProtected = 4    // best species (by top fitness) whose champion always survives
+
+	evalSeeds      = 3    // seeded initial conditions per genome evaluation
+	evalSeedBase   = 1    // rand seed of the first evaluation seeding
+	extinctLevel   = 1e-4 // mean activity below this ends an evaluation run as extinct
+	saturatedLevel = 0.95 // cells at or above this count as saturated
+	saturatedFrac  = 0.9  // saturated cell fraction that ends an evaluation run
+
+	tileCols = 4 // interactive mode grid of live mini-simulations
+	tileRows = 3
+	maxStars = 5 // highest user rating per genome
+
+	statsHistoryLen = 200 // generations kept for the live charts
+
+	analysisWeight      = 0.3                     // fitness bonus for a fractal dimension near fractalTarget
+	fractalTarget       = 1.6                     // box-counting dimension of filamentary, non-space-filling patterns
+	analysisEvery       = 15                      // frames between overlay analyses (A key)
+	analysisCSVPath     = "analysis_spectrum.csv" // radial spectrum and autocorrelation (X key)
+	analysisSummaryPath = "analysis_summary.csv"  // one row of scalar statistics per export
+
+	lyapunovScale = 0.2 // exponent, per unit time, at which the -lyapunov-weight bonus has dropped to 1/e
+
+	headlessTPS = 60 // updates per second without a window (-web-headless)
 )
 
+// outcomeBonus is added to the fitness of an evaluation run by its classification
+var outcomeBonus = map[Outcome]float64{
+	Glider:        0.6,
+	Oscillator:    0.3,
+	MultiCreature: 0.3,
+	Chaotic:       0.1,
+}
+
 // ---------- Types ----------
 type KernelEntry struct {
 	dx, dy int
@@ -40,6 +89,39 @@ type Genome struct {
 	Dt         float64 // Δt
 	ColorBias  float64 // shift color mapping influence [-0.5,0.5]
 	Fitness    float64 // cached after evaluation
+	FitnessStd float64 // std-dev of fitness over the evaluation seeds
+	Outcome    string  // most common run classification over the evaluation seeds
+	Lyapunov   float64 // largest Lyapunov exponent of the first evaluation seed
+
+	Steps         [numGenes]float64 // self-adaptive mutation step size per gene
+	Bred          bool              // produced by crossover+mutate (not an elite or random)
+	ParentFitness float64           // fitness of the better parent, for the 1/5th success rule
+}
+
+// GenStats summarizes one evaluated generation; it is written as one JSONL record.
+type GenStats struct {
+	Generation   int                `json:"generation"`
+	Best         float64            `json:"best"`
+	Mean         float64            `json:"mean"`
+	Median       float64            `json:"median"`
+	Worst        float64            `json:"worst"`
+	Diversity    float64            `json:"diversity"` // mean pairwise distance of normalized genomes
+	MeanStd      float64            `json:"mean_std"`  // mean per-genome fitness std-dev over seeds
+	EarlyStops   int                `json:"early_stops"`
+	StepsRun     int                `json:"steps_run"` // simulated evaluation steps, out of len(pop)*evalSeeds*evalSteps
+	ParamMean    map[string]float64 `json:"param_mean"`
+	ParamStd     map[string]float64 `json:"param_std"`
+	MeanStep     map[string]float64 `json:"mean_step"` // self-adaptive mutation step sizes
+	Crossover    string             `json:"crossover"`
+	Mutation     string             `json:"mutation"`
+	SuccessRate  float64            `json:"success_rate"` // children that beat their better parent
+	StepScale    float64            `json:"step_scale"`   // 1/5th-rule step multiplier
+	SpeciesCount int                `json:"species_count"`
+	SpeciesSizes []int              `json:"species_sizes"` // best species first
+	Outcomes     map[string]int     `json:"outcomes"`      // genomes per run classification
+	EvalMs       float64            `json:"eval_ms"`       // time spent evaluating fitness
+	TotalMs      float64            `json:"total_ms"`      // whole evolveOnce, including breeding
+	Time         time.Time          `json:"time"`
 }
 
 type Game struct {
@@ -48,6 +130,7 @@ type Game struct {
 	kernel  []KernelEntry
 	Knorm   float64
 	texture *ebiten.Image
+	pixels  *FieldPixels
 
 	// runtime
 	generation      int
@@ -58,10 +141,48 @@ type Game struct {
 	autoEvolveDelay time.Duration
 	lastEvolveTime  time.Time
 
+	// interactive evolution
+	interactive bool
+	tiles       []*miniSim // one per displayed genome, same order as population
+	ratings     []int      // user rating (0..maxStars) per population index
+	userWeight  float64    // share of the user rating in the bred fitness, rest is evaluateGenome
+
+	// mutation step multiplier, adapted by the 1/5th success rule
+	stepScale float64
+
+	// speciation
+	species       []*Species // best species first
+	nextSpeciesID int
+
+	// statistics
+	evalStepsRun int        // evaluation steps since the last generation
+	earlyStops   int        // evaluation runs stopped early since the last generation
+	stats        []GenStats // most recent statsHistoryLen generations
+	statsLog     *os.File   // -stats-log file, nil when off
+	showCharts   bool
+
+	// outcome classification of evaluation runs
+	classifier *Classifier
+
+	// perturbed twin of the first evaluation seed, for the Lyapunov exponent
+	twinA, twinNext [][]float64
+	lyapunovWeight  float64 // fitness bonus for an exponent near zero (-lyapunov-weight), 0 skips the twin
+
+	// spatial analysis
+	analyzer     *Analyzer
+	analysis     *FieldAnalysis // latest overlay analysis of the displayed field
+	showAnalysis bool
+
 	// visualization
-	frame   int
-	start   time.Time
-	lastFPS int
+	palettes *PaletteCycle
+	timer    FrameTimer
+	frame    int
+	start    time.Time
+	lastFPS  int
+
+	// browser viewer
+	web       *WebView
+	webPixels *FieldPixels // interactive tiles composed into one frame
 }
 
 // ---------- Utility ----------
@@ -147,14 +268,24 @@ func NewGame() *Game {
 		A:               A,
 		Anext:           Anext,
 		texture:         ebiten.NewImage(gridW, gridH),
+		pixels:          newFieldPixels(gridW, gridH),
 		generation:      0,
 		currentIndex:    0,
 		stepCount:       0,
 		autoEvolve:      false,
 		autoEvolveDelay: 3 * time.Second,
 		lastEvolveTime:  time.Now(),
+		showCharts:      true,
+		userWeight:      1.0,
+		stepScale:       1.0,
+		analyzer:        newAnalyzer(gridW, gridH),
+		classifier:      newClassifier(gridW, gridH),
+		twinA:           newLattice(gridH, gridW),
+		twinNext:        newLattice(gridH, gridW),
 		start:           time.Now(),
+		webPixels:       newFieldPixels(gridW, gridH),
 	}
+	g.classifier.Every = classifyEvery
 
 	// initialize random population
 	g.population = make([]Genome, populationSz)
@@ -176,6 +307,7 @@ func randomGenome() Genome {
 		ShellSigma: 0.08 + rand.Float64()*0.3,  // 0.08..0.38
 		Dt:         0.03 + rand.Float64()*0.12, // 0.03..0.15
 		ColorBias:  rand.Float64()*1.0 - 0.5,   // -0.5..0.5
+		Steps:      baseSteps(),
 	}
 }
 
@@ -187,25 +319,32 @@ func (g *Game) applyGenomeKernel(gen *Genome) {
 
 // seed grid with a blob pattern influenced by genome (variation between genomes)
 func (g *Game) seedFromGenome(gen *Genome) {
-	cx, cy := gridW/2, gridH/2
+	seedField(g.A, g.Anext, gen, rand.New(rand.NewSource(rand.Int63())))
+}
+
+// seedField clears A/Anext (any size) and places the genome's start pattern in the middle,
+// drawing the noise sprinkle from rng
+func seedField(A, Anext [][]float64, gen *Genome, rng *rand.Rand) {
+	h, w := len(A), len(A[0])
+	cx, cy := w/2, h/2
 	// clear grid
-	for y := 0; y < gridH; y++ {
-		for x := 0; x < gridW; x++ {
-			g.A[y][x] = 0
-			g.Anext[y][x] = 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			A[y][x] = 0
+			Anext[y][x] = 0
 		}
 	}
 	// make center blob size proportional to radius
 	base := int(math.Max(6, gen.Radius*1.5))
-	for y := 0; y < gridH; y++ {
-		for x := 0; x < gridW; x++ {
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
 			d := math.Hypot(float64(x-cx), float64(y-cy))
 			if d < float64(base) {
-				g.A[y][x] = 0.6 * math.Exp(-d*d/(2*float64(base)*float64(base)))
+				A[y][x] = 0.6 * math.Exp(-d*d/(2*float64(base)*float64(base)))
 			}
 			// sprinkle genome-specific noise
-			if rand.Float64() < 0.002+0.001*rand.Float64() {
-				g.A[y][x] = rand.Float64()*0.8 + 0.05
+			if rng.Float64() < 0.002+0.001*rng.Float64() {
+				A[y][x] = rng.Float64()*0.8 + 0.05
 			}
 		}
 	}
@@ -213,70 +352,115 @@ func (g *Game) seedFromGenome(gen *Genome) {
 
 // ---------- Single step ----------
 func (g *Game) step(gen *Genome) {
-	for y := 0; y < gridH; y++ {
-		for x := 0; x < gridW; x++ {
+	stepField(g.A, g.Anext, g.kernel, gen)
+	g.A, g.Anext = g.Anext, g.A
+}
+
+// stepField writes one Lenia update of A into Anext; the caller swaps the buffers
+func stepField(A, Anext [][]float64, kernel []KernelEntry, gen *Genome) {
+	h, w := len(A), len(A[0])
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
 			var u float64
-			for _, k := range g.kernel {
-				nx := wrap(x+k.dx, gridW)
-				ny := wrap(y+k.dy, gridH)
-				u += k.w * g.A[ny][nx]
+			for _, k := range kernel {
+				nx := wrap(x+k.dx, w)
+				ny := wrap(y+k.dy, h)
+				u += k.w * A[ny][nx]
 			}
 			grow := growth(u, gen.Mu, gen.Sigma)
-			val := g.A[y][x] + gen.Dt*grow
-			g.Anext[y][x] = clamp(val, 0.0, 1.0)
+			val := A[y][x] + gen.Dt*grow
+			Anext[y][x] = clamp(val, 0.0, 1.0)
 		}
 	}
-	g.A, g.Anext = g.Anext, g.A
 }
 
 // ---------- Fitness evaluation ----------
-func (g *Game) evaluateGenome(gen *Genome) float64 {
-	// seed and apply kernel
+// evaluateGenome scores a genome over evalSeeds seeded starts and returns the mean and
+// standard deviation of the per-seed fitness. Seeds are shared by all genomes, so every
+// genome is judged on the same initial conditions. gen.Outcome is set to the most common
+// run classification.
+func (g *Game) evaluateGenome(gen *Genome) (mean, std float64) {
 	g.applyGenomeKernel(gen)
-	g.seedFromGenome(gen)
+	var sum, sumSq, bonus float64
+	votes := map[Outcome]int{}
+	for k := 0; k < evalSeeds; k++ {
+		seedField(g.A, g.Anext, gen, rand.New(rand.NewSource(evalSeedBase+int64(k))))
+		var lyap *Lyapunov
+		if k == 0 && g.lyapunovWeight > 0 {
+			perturbField(g.twinA, g.A, fieldD0, rand.New(rand.NewSource(evalSeedBase)))
+			lyap = newLyapunov(fieldD0, gen.Dt, lyapunovEvery)
+		}
+		score, outcome := g.evaluateRun(gen, lyap)
+		if lyap != nil {
+			gen.Lyapunov = lyap.Exponent
+			// a run that died out or filled up before the first renormalization has no
+			// estimate yet and earns nothing; neither does a collapsed twin (-Inf)
+			if lyap.Renorms > 0 {
+				bonus = g.lyapunovWeight * math.Exp(-sq(gen.Lyapunov/lyapunovScale))
+			}
+		}
+		sum += score
+		sumSq += score * score
+		votes[outcome]++
+	}
+	best := Undetermined
+	for o, n := range votes {
+		if n > votes[best] || (n == votes[best] && o > best) {
+			best = o
+		}
+	}
+	gen.Outcome = best.String()
+	mean = sum / evalSeeds
+	std = math.Sqrt(math.Max(0, sumSq/evalSeeds-mean*mean))
+	return mean + bonus, std
+}
 
-	// simulate for a short period and collect stats
+// evaluateRun simulates the seeded field for up to evalSteps and scores it. The run stops
+// early once the field is extinct or saturated; the final state is then assumed to persist
+// for the remaining samples, which keeps the score on the same scale as a full run.
+// The run's outcome classification is returned with the score. With a non-nil lyap the
+// perturbed twin in g.twinA is stepped alongside and the exponent estimate updated.
+func (g *Game) evaluateRun(gen *Genome, lyap *Lyapunov) (float64, Outcome) {
+	samples := (evalSteps + 3) / 4 // stats are taken every 4th step
 	var activitySum float64
 	var varianceSum float64
 	var edgeSum float64
 
+	taken := 0
+	g.classifier.Reset()
 	for step := 0; step < evalSteps; step++ {
 		g.step(gen)
+		g.classifier.Observe(g.A)
+		if lyap != nil {
+			stepField(g.twinA, g.twinNext, g.kernel, gen)
+			g.twinA, g.twinNext = g.twinNext, g.twinA
+			lyap.Advance(func() float64 { return fieldDistance(g.twinA, g.A) },
+				func(f float64) { fieldRescale(g.twinA, g.A, f) })
+		}
+		g.evalStepsRun++
 		// compute stats each few steps
 		if step%4 == 0 {
-			mean := 0.0
-			for y := 0; y < gridH; y++ {
-				for x := 0; x < gridW; x++ {
-					mean += g.A[y][x]
-				}
-			}
-			mean /= float64(gridW * gridH)
-			variance := 0.0
-			edge := 0.0
-			for y := 0; y < gridH; y++ {
-				for x := 0; x < gridW; x++ {
-					v := g.A[y][x]
-					variance += (v - mean) * (v - mean)
-					// simple edge metric: gradient magnitude
-					r := g.A[y][wrap(x+1, gridW)] - v
-					b := g.A[wrap(y+1, gridH)][x] - v
-					edge += math.Abs(r) + math.Abs(b)
-				}
-			}
-			variance /= float64(gridW * gridH)
-			edge /= float64(gridW * gridH)
-			activity := mean
+			activity, variance, edge, full := g.fieldStats()
 			activitySum += activity
 			varianceSum += variance
 			edgeSum += edge
+			taken++
+			if activity < extinctLevel || full >= saturatedFrac {
+				rest := float64(samples - taken)
+				activitySum += activity * rest
+				varianceSum += variance * rest
+				edgeSum += edge * rest
+				g.earlyStops++
+				break
+			}
 		}
 	}
 
 	// combine metrics into a fitness score
 	// prefer moderate mean activity (not all-zero, not full), high variance (texture), and decent edges (structure)
-	meanActivity := activitySum / float64(evalSteps/4)
-	meanVar := varianceSum / float64(evalSteps/4)
-	meanEdge := edgeSum / float64(evalSteps/4)
+	meanActivity := activitySum / float64(samples)
+	meanVar := varianceSum / float64(samples)
+	meanEdge := edgeSum / float64(samples)
 
 	// reward mid activity (bell around 0.25)
 	actScore := math.Exp(-math.Pow((meanActivity-0.25)/0.12, 2))
@@ -285,64 +469,245 @@ func (g *Game) evaluateGenome(gen *Genome) float64 {
 	edgeScore := math.Log(1 + meanEdge*50)
 
 	score := 1.2*actScore + 0.9*varScore + 0.8*edgeScore
+	// reward structured textures: fractal dimension of the final field near the target
+	if analysisWeight > 0 {
+		fa := g.analyzer.Analyze(g.A)
+		score += analysisWeight * math.Exp(-math.Pow((fa.FractalDim-fractalTarget)/0.4, 2))
+	}
+	// reward lasting, organised behaviour over dead, saturated or chaotic fields
+	outcome := g.classifier.Result().Outcome
+	score += outcomeBonus[outcome]
 	// small penalty for extreme radius or tiny sigma (to avoid degenerate)
 	score *= 1.0 - 0.05*math.Abs(gen.Radius-6.0)/6.0
 	if score < 0 {
 		score = 0
 	}
-	return score
+	return score, outcome
 }
 
-// ---------- Evolutionary operators ----------
-func crossover(a, b Genome) Genome {
-	child := Genome{
-		Mu:         a.Mu,
-		Sigma:      b.Sigma,
-		Radius:     (a.Radius + b.Radius) * 0.5,
-		ShellSigma: (a.ShellSigma + b.ShellSigma) * 0.5,
-		Dt:         (a.Dt + b.Dt) * 0.5,
-		ColorBias:  (a.ColorBias + b.ColorBias) * 0.5,
+// fieldStats returns the mean, variance and mean gradient magnitude of the field, plus the
+// fraction of cells at or above saturatedLevel
+func (g *Game) fieldStats() (mean, variance, edge, full float64) {
+	for y := 0; y < gridH; y++ {
+		for x := 0; x < gridW; x++ {
+			mean += g.A[y][x]
+		}
 	}
-	// mix some params randomly
-	if rand.Float64() < 0.5 {
-		child.Mu = b.Mu
+	mean /= float64(gridW * gridH)
+	for y := 0; y < gridH; y++ {
+		for x := 0; x < gridW; x++ {
+			v := g.A[y][x]
+			variance += (v - mean) * (v - mean)
+			// simple edge metric: gradient magnitude
+			r := g.A[y][wrap(x+1, gridW)] - v
+			b := g.A[wrap(y+1, gridH)][x] - v
+			edge += math.Abs(r) + math.Abs(b)
+			if v >= saturatedLevel {
+				full++
+			}
+		}
 	}
-	if rand.Float64() < 0.5 {
-		child.Sigma = a.Sigma
+	n := float64(gridW * gridH)
+	return mean, variance / n, edge / n, full / n
+}
+
+// ---------- Evolutionary operators ----------
+// geneSpec gives an evolvable parameter its bounds and base mutation step size
+type geneSpec struct {
+	name   string
+	lo, hi float64
+	step   float64
+}
+
+var genes = [numGenes]geneSpec{
+	{"mu", 0.01, 1.0, 0.03},
+	{"sigma", 0.005, 0.5, 0.01},
+	{"radius", 1.5, 18.0, 1.2},
+	{"shell_sigma", 0.02, 0.6, 0.05},
+	{"dt", 0.005, 0.5, 0.02},
+	{"color_bias", -1.0, 1.0, 0.12},
+}
+
+// gene returns a pointer to the i-th evolvable parameter (order of genes)
+func (gen *Genome) gene(i int) *float64 {
+	switch i {
+	case 0:
+		return &gen.Mu
+	case 1:
+		return &gen.Sigma
+	case 2:
+		return &gen.Radius
+	case 3:
+		return &gen.ShellSigma
+	case 4:
+		return &gen.Dt
+	default:
+		return &gen.ColorBias
 	}
-	return child
 }
-func mutate(g *Genome) {
-	if rand.Float64() < mutationRate {
-		g.Mu += rand.NormFloat64() * 0.03
-		g.Mu = clamp(g.Mu, 0.01, 1.0)
+
+func baseSteps() [numGenes]float64 {
+	var s [numGenes]float64
+	for i := range genes {
+		s[i] = genes[i].step
+	}
+	return s
+}
+
+// crossover combines two parents with the operator selected by crossoverOp
+func crossover(a, b Genome) Genome {
+	var child Genome
+	switch crossoverOp {
+	case "uniform":
+		// every gene (and its step size) from a random parent
+		for i := range genes {
+			src := &a
+			if rand.Float64() < 0.5 {
+				src = &b
+			}
+			*child.gene(i) = *src.gene(i)
+			child.Steps[i] = src.Steps[i]
+		}
+		return child
+	case "blx":
+		// BLX-α: uniform sample from the parents' interval widened by α on both sides
+		for i := range genes {
+			x, y := *a.gene(i), *b.gene(i)
+			lo, d := math.Min(x, y), math.Abs(x-y)
+			v := lo - blxAlpha*d + rand.Float64()*(1+2*blxAlpha)*d
+			*child.gene(i) = clamp(v, genes[i].lo, genes[i].hi)
+		}
+	case "sbx":
+		// simulated binary crossover, spread controlled by sbxEta
+		for i := range genes {
+			x, y := *a.gene(i), *b.gene(i)
+			u := rand.Float64()
+			var beta float64
+			if u <= 0.5 {
+				beta = math.Pow(2*u, 1/(sbxEta+1))
+			} else {
+				beta = math.Pow(1/(2*(1-u)), 1/(sbxEta+1))
+			}
+			if rand.Float64() < 0.5 {
+				beta = -beta
+			}
+			v := 0.5 * ((x + y) + beta*(x-y))
+			*child.gene(i) = clamp(v, genes[i].lo, genes[i].hi)
+		}
+	default: // "legacy"
+		child = Genome{
+			Mu:         a.Mu,
+			Sigma:      b.Sigma,
+			Radius:     (a.Radius + b.Radius) * 0.5,
+			ShellSigma: (a.ShellSigma + b.ShellSigma) * 0.5,
+			Dt:         (a.Dt + b.Dt) * 0.5,
+			ColorBias:  (a.ColorBias + b.ColorBias) * 0.5,
+		}
+		// mix some params randomly
+		if rand.Float64() < 0.5 {
+			child.Mu = b.Mu
+		}
+		if rand.Float64() < 0.5 {
+			child.Sigma = a.Sigma
+		}
 	}
-	if rand.Float64() < mutationRate {
-		g.Sigma += rand.NormFloat64() * 0.01
-		g.Sigma = clamp(g.Sigma, 0.005, 0.5)
+	// blended genes inherit the geometric mean of the parents' step sizes
+	for i := range genes {
+		child.Steps[i] = math.Sqrt(a.Steps[i] * b.Steps[i])
 	}
-	if rand.Float64() < mutationRate {
-		g.Radius += rand.NormFloat64() * 1.2
-		g.Radius = clamp(g.Radius, 1.5, 18.0)
+	return child
+}
+
+// mutate perturbs the genome with the operator selected by mutationOp. scale multiplies
+// the step sizes; it is adapted by the 1/5th success rule when mutationOp is "one-fifth".
+func mutate(g *Genome, scale float64) {
+	switch mutationOp {
+	case "self-adaptive":
+		// log-normal self-adaptation of one step size per gene, then mutate every gene
+		tauGlobal := 1 / math.Sqrt(2*numGenes)
+		tauLocal := 1 / math.Sqrt(2*math.Sqrt(numGenes))
+		common := tauGlobal * rand.NormFloat64()
+		for i, spec := range genes {
+			s := g.Steps[i]
+			if s <= 0 {
+				s = spec.step
+			}
+			s *= math.Exp(common + tauLocal*rand.NormFloat64())
+			g.Steps[i] = clamp(s, spec.step*0.01, (spec.hi-spec.lo)*0.5)
+			v := g.gene(i)
+			*v = clamp(*v+rand.NormFloat64()*g.Steps[i], spec.lo, spec.hi)
+		}
+	case "one-fifth":
+		// every gene with its base step, scaled by the adapted global factor
+		for i, spec := range genes {
+			v := g.gene(i)
+			*v = clamp(*v+rand.NormFloat64()*spec.step*scale, spec.lo, spec.hi)
+		}
+	default: // "legacy"
+		for i, spec := range genes {
+			if rand.Float64() < mutationRate {
+				v := g.gene(i)
+				*v = clamp(*v+rand.NormFloat64()*spec.step*scale, spec.lo, spec.hi)
+			}
+		}
 	}
-	if rand.Float64() < mutationRate {
-		g.ShellSigma += rand.NormFloat64() * 0.05
-		g.ShellSigma = clamp(g.ShellSigma, 0.02, 0.6)
+}
+
+// adaptStepScale applies the 1/5th success rule: widen the steps when more than a fifth
+// of last generation's children beat their better parent, narrow them when fewer did.
+// It returns the observed success rate.
+func (g *Game) adaptStepScale() float64 {
+	bred, better := 0, 0
+	for i := range g.population {
+		if g.population[i].Bred {
+			bred++
+			if g.population[i].Fitness > g.population[i].ParentFitness {
+				better++
+			}
+		}
 	}
-	if rand.Float64() < mutationRate {
-		g.Dt += rand.NormFloat64() * 0.02
-		g.Dt = clamp(g.Dt, 0.005, 0.5)
+	if bred == 0 {
+		return 0
 	}
-	if rand.Float64() < mutationRate {
-		g.ColorBias += rand.NormFloat64() * 0.12
-		g.ColorBias = clamp(g.ColorBias, -1.0, 1.0)
+	rate := float64(better) / float64(bred)
+	if mutationOp == "one-fifth" {
+		if rate > 0.2 {
+			g.stepScale /= 0.82
+		} else if rate < 0.2 {
+			g.stepScale *= 0.82
+		}
+		g.stepScale = clamp(g.stepScale, 0.05, 20)
 	}
+	return rate
 }
 
 // ---------- Keyboard and update ----------
+// webKeyCodes names the keys in the browser viewer
+var webKeyCodes = map[ebiten.Key]string{
+	ebiten.KeySpace: "Space", ebiten.KeyLeft: "ArrowLeft", ebiten.KeyRight: "ArrowRight",
+	ebiten.KeyA: "KeyA", ebiten.KeyB: "KeyB", ebiten.KeyC: "KeyC", ebiten.KeyG: "KeyG",
+	ebiten.KeyI: "KeyI", ebiten.KeyM: "KeyM", ebiten.KeyP: "KeyP", ebiten.KeyX: "KeyX",
+}
+
+// keyDown reports whether k is held in the window or in a browser viewer
+func (g *Game) keyDown(k ebiten.Key) bool {
+	return ebiten.IsKeyPressed(k) || (g.web != nil && g.web.Pressed(webKeyCodes[k]))
+}
+
+// keyJustPressed reports whether k went down since the last frame, in the window or in a
+// browser viewer; toggles use it so they fire once per press without a shared debounce
+func (g *Game) keyJustPressed(k ebiten.Key) bool {
+	return inpututil.IsKeyJustPressed(k) || (g.web != nil && g.web.JustPressed(webKeyCodes[k]))
+}
+
 func (g *Game) Update() error {
+	// browser clicks only rate interactive tiles; outside interactive mode they are dropped
+	var clicks []WebClick
+	if g.web != nil {
+		clicks = g.web.Clicks()
+	}
 	// toggle auto-evolve
-	if ebiten.IsKeyPressed(ebiten.KeySpace) {
+	if g.keyDown(ebiten.KeySpace) {
 		// debounce by time
 		if time.Since(g.lastEvolveTime) > 300*time.Millisecond {
 			g.autoEvolve = !g.autoEvolve
@@ -350,14 +715,39 @@ func (g *Game) Update() error {
 		}
 	}
 	// manual evolve (generate next pop)
-	if ebiten.IsKeyPressed(ebiten.KeyG) {
+	if g.keyDown(ebiten.KeyG) {
 		if time.Since(g.lastEvolveTime) > 300*time.Millisecond {
 			g.evolveOnce()
 			g.lastEvolveTime = time.Now()
 		}
 	}
+	// toggle interactive (user-driven) evolution
+	if g.keyJustPressed(ebiten.KeyI) {
+		g.setInteractive(!g.interactive)
+	}
+	// switch the colormap
+	if g.keyJustPressed(ebiten.KeyP) {
+		g.palettes.Next()
+	}
+	if g.interactive {
+		g.updateInteractive(clicks)
+		return nil
+	}
+	// toggle statistics charts
+	if g.keyJustPressed(ebiten.KeyC) {
+		g.showCharts = !g.showCharts
+	}
+	// toggle the spatial analysis overlay
+	if g.keyJustPressed(ebiten.KeyA) {
+		g.showAnalysis = !g.showAnalysis
+		g.analysis = nil
+	}
+	// export the analysis of the displayed field
+	if g.keyJustPressed(ebiten.KeyX) {
+		g.exportAnalysis()
+	}
 	// switch genome being displayed
-	if ebiten.IsKeyPressed(ebiten.KeyRight) {
+	if g.keyDown(ebiten.KeyRight) {
 		if time.Since(g.lastEvolveTime) > 200*time.Millisecond {
 			g.currentIndex = (g.currentIndex + 1) % len(g.population)
 			g.applyGenomeKernel(&g.population[g.currentIndex])
@@ -366,7 +756,7 @@ func (g *Game) Update() error {
 			g.lastEvolveTime = time.Now()
 		}
 	}
-	if ebiten.IsKeyPressed(ebiten.KeyLeft) {
+	if g.keyDown(ebiten.KeyLeft) {
 		if time.Since(g.lastEvolveTime) > 200*time.Millisecond {
 			g.currentIndex = (g.currentIndex - 1 + len(g.population)) % len(g.population)
 			g.applyGenomeKernel(&g.population[g.currentIndex])
@@ -386,6 +776,9 @@ func (g *Game) Update() error {
 	cur := &g.population[g.currentIndex]
 	g.step(cur)
 	g.stepCount++
+	if g.showAnalysis && (g.analysis == nil || g.frame%analysisEvery == 0) {
+		g.analysis = g.analyzer.Analyze(g.A)
+	}
 	g.frame++
 	if g.frame%30 == 0 {
 		elapsed := time.Since(g.start).Seconds()
@@ -393,44 +786,483 @@ func (g *Game) Update() error {
 			g.lastFPS = int(float64(g.frame) / elapsed)
 		}
 	}
+	g.publishWeb()
 	return nil
 }
 
 // ---------- Evolution procedure ----------
 func (g *Game) evolveOnce() {
+	start := time.Now()
 	// evaluate all genomes
 	for i := range g.population {
-		score := g.evaluateGenome(&g.population[i])
-		g.population[i].Fitness = score
+		g.population[i].Fitness, g.population[i].FitnessStd = g.evaluateGenome(&g.population[i])
 	}
+	g.nextGeneration(start, time.Since(start))
+}
+
+// nextGeneration sorts the scored population, records its statistics and breeds the
+// next generation from it. Shared by automatic and interactive evolution.
+func (g *Game) nextGeneration(start time.Time, evalTime time.Duration) {
 	// sort by fitness desc
 	sort.Slice(g.population, func(i, j int) bool {
 		return g.population[i].Fitness > g.population[j].Fitness
 	})
+	st := computeGenStats(g.generation, g.population)
+	st.EvalMs = float64(evalTime.Microseconds()) / 1000
+	st.EarlyStops, st.StepsRun = g.earlyStops, g.evalStepsRun
+	g.earlyStops, g.evalStepsRun = 0, 0
 
-	// keep some elites
-	newPop := make([]Genome, 0, populationSz)
-	for i := 0; i < elitism && i < len(g.population); i++ {
-		newPop = append(newPop, g.population[i])
-	}
+	st.SuccessRate = g.adaptStepScale()
+	st.StepScale = g.stepScale
 
-	// fill rest with crossover+mutate
-	for len(newPop) < populationSz {
-		// tournament selection
-		a := tournamentSelect(g.population)
-		b := tournamentSelect(g.population)
-		child := crossover(a, b)
-		mutate(&child)
-		newPop = append(newPop, child)
+	var newPop []Genome
+	if speciation {
+		newPop = g.breedSpecies()
+		st.SpeciesCount = len(g.species)
+		for _, sp := range g.species {
+			st.SpeciesSizes = append(st.SpeciesSizes, len(sp.Members))
+		}
+	} else {
+		// keep some elites
+		newPop = make([]Genome, 0, populationSz)
+		for i := 0; i < elitism && i < len(g.population); i++ {
+			newPop = append(newPop, asElite(g.population[i]))
+		}
+		// fill rest with crossover+mutate
+		for len(newPop) < populationSz {
+			newPop = append(newPop, g.makeChild(g.population))
+		}
 	}
 
 	g.population = newPop
+	st.TotalMs = float64(time.Since(start).Microseconds()) / 1000
+	g.recordStats(st)
 	g.generation++
 	// reset viewer to best genome
 	g.currentIndex = 0
 	g.applyGenomeKernel(&g.population[0])
 	g.seedFromGenome(&g.population[0])
 	g.stepCount = 0
+	if g.interactive {
+		g.buildTiles()
+	}
+}
+
+// ---------- Interactive evolution ----------
+// miniSim is a small independent Lenia field shown as one tile of the interactive grid
+type miniSim struct {
+	A, Anext [][]float64
+	kernel   []KernelEntry
+	texture  *ebiten.Image
+	pixels   *FieldPixels
+}
+
+func newMiniSim(gen *Genome) *miniSim {
+	w, h := gridW/tileCols, gridH/tileRows
+	m := &miniSim{
+		A:       make([][]float64, h),
+		Anext:   make([][]float64, h),
+		texture: ebiten.NewImage(w, h),
+		pixels:  newFieldPixels(w, h),
+	}
+	for y := 0; y < h; y++ {
+		m.A[y] = make([]float64, w)
+		m.Anext[y] = make([]float64, w)
+	}
+	m.kernel, _ = buildKernel(gen.Radius, gen.ShellSigma)
+	seedField(m.A, m.Anext, gen, rand.New(rand.NewSource(rand.Int63())))
+	return m
+}
+
+func (m *miniSim) step(gen *Genome) {
+	stepField(m.A, m.Anext, m.kernel, gen)
+	m.A, m.Anext = m.Anext, m.A
+}
+
+func (g *Game) setInteractive(on bool) {
+	g.interactive = on
+	if on {
+		g.autoEvolve = false
+		g.buildTiles()
+		return
+	}
+	g.tiles = nil
+	g.applyGenomeKernel(&g.population[g.currentIndex])
+	g.seedFromGenome(&g.population[g.currentIndex])
+	g.stepCount = 0
+}
+
+// buildTiles starts a fresh mini-simulation for every displayed genome and clears the ratings
+func (g *Game) buildTiles() {
+	n := len(g.population)
+	if n > tileCols*tileRows {
+		n = tileCols * tileRows
+	}
+	g.tiles = make([]*miniSim, n)
+	for i := range g.tiles {
+		g.tiles[i] = newMiniSim(&g.population[i])
+	}
+	g.ratings = make([]int, len(g.population))
+}
+
+// tileAt returns the tile index under screen position (x, y), or -1
+func (g *Game) tileAt(x, y int) int {
+	tw, th := gridW/tileCols*cellSize, gridH/tileRows*cellSize
+	if x < 0 || y < 0 || tw == 0 || th == 0 {
+		return -1
+	}
+	col, row := x/tw, y/th
+	if col >= tileCols || row >= tileRows {
+		return -1
+	}
+	i := row*tileCols + col
+	if i >= len(g.tiles) {
+		return -1
+	}
+	return i
+}
+
+func (g *Game) updateInteractive(clicks []WebClick) {
+	// left click rates a tile one star higher, right click clears its rating
+	mx, my := ebiten.CursorPosition()
+	if i := g.tileAt(mx, my); i >= 0 {
+		if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) && g.ratings[i] < maxStars {
+			g.ratings[i]++
+		}
+		if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonRight) {
+			g.ratings[i] = 0
+		}
+	}
+	for _, c := range clicks {
+		i := g.tileAt(int(c.X*gridW*cellSize), int(c.Y*gridH*cellSize))
+		switch {
+		case i < 0:
+		case c.Button == 0 && g.ratings[i] < maxStars:
+			g.ratings[i]++
+		case c.Button == 2:
+			g.ratings[i] = 0
+		}
+	}
+	// breed the next generation from the ratings
+	if g.keyJustPressed(ebiten.KeyB) {
+		g.breedInteractive()
+	}
+	// cycle how much the automatic fitness is mixed into the ratings
+	if g.keyJustPressed(ebiten.KeyM) {
+		g.userWeight -= 0.25
+		if g.userWeight < 0 {
+			g.userWeight = 1.0
+		}
+	}
+
+	for i, t := range g.tiles {
+		t.step(&g.population[i])
+	}
+	g.frame++
+	if g.frame%30 == 0 {
+		elapsed := time.Since(g.start).Seconds()
+		if elapsed > 0 {
+			g.lastFPS = int(float64(g.frame) / elapsed)
+		}
+	}
+	g.publishWeb()
+}
+
+// breedInteractive scores every genome from its user rating, blended with the automatic
+// fitness according to userWeight, and breeds the next generation from those scores
+func (g *Game) breedInteractive() {
+	start := time.Now()
+	auto := make([]float64, len(g.population))
+	maxAuto := 0.0
+	if g.userWeight < 1 {
+		for i := range g.population {
+			auto[i], _ = g.evaluateGenome(&g.population[i])
+			maxAuto = math.Max(maxAuto, auto[i])
+		}
+	}
+	evalTime := time.Since(start)
+	for i := range g.population {
+		score := g.userWeight * float64(g.ratings[i]) / maxStars
+		if maxAuto > 0 {
+			score += (1 - g.userWeight) * auto[i] / maxAuto
+		}
+		g.population[i].Fitness = score
+	}
+	g.nextGeneration(start, evalTime)
+}
+
+func (g *Game) drawInteractive(screen *ebiten.Image) {
+	tw, th := gridW/tileCols, gridH/tileRows
+	pal := g.palettes.Current()
+	for i, t := range g.tiles {
+		t.pixels.Fill(t.A, pal, g.population[i].ColorBias)
+		t.texture.WritePixels(t.pixels.Pix)
+		ox := float64((i % tileCols) * tw * cellSize)
+		oy := float64((i / tileCols) * th * cellSize)
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(float64(cellSize), float64(cellSize))
+		op.GeoM.Translate(ox, oy)
+		op.Filter = ebiten.FilterNearest
+		screen.DrawImage(t.texture, op)
+
+		border := color.NRGBA{R: 0x40, G: 0x40, B: 0x40, A: 0xff}
+		if g.ratings[i] > 0 {
+			border = chartBest
+		}
+		vector.StrokeRect(screen, float32(ox), float32(oy), float32(tw*cellSize), float32(th*cellSize), float32(1+g.ratings[i]/2), border, false)
+		stars := fmt.Sprintf("#%d %s", i, strings.Repeat("*", g.ratings[i]))
+		text.Draw(screen, stars, basicfont.Face7x13, int(ox)+6, int(oy)+16, color.White)
+	}
+
+	hud := g.interactiveHUD()
+	for k, line := range hud {
+		text.Draw(screen, line, basicfont.Face7x13, 6, gridH*cellSize-8-16*(len(hud)-1-k), color.White)
+	}
+}
+
+func (g *Game) interactiveHUD() []string {
+	return []string{
+		fmt.Sprintf("INTERACTIVE  Gen: %d  user weight: %.2f  auto weight: %.2f",
+			g.generation, g.userWeight, 1-g.userWeight),
+		"Click rate +1   Right-click clear   B breed   M mix auto fitness   I leave",
+	}
+}
+
+// ---------- Generation statistics ----------
+// Map genome parameters into a 5D normalized vector (same bounds as mutate)
+func map5D(gen *Genome) [5]float64 {
+	mu := (gen.Mu - 0.01) / (1.0 - 0.01)
+	sigma := (gen.Sigma - 0.005) / (0.5 - 0.005)
+	radius := (gen.Radius - 1.5) / (18.0 - 1.5)
+	shell := (gen.ShellSigma - 0.02) / (0.6 - 0.02)
+	dt := (gen.Dt - 0.005) / (0.5 - 0.005)
+	return [5]float64{clamp(mu, 0, 1), clamp(sigma, 0, 1), clamp(radius, 0, 1), clamp(shell, 0, 1), clamp(dt, 0, 1)}
+}
+
+// genomeDistance is the euclidean distance between two genomes in map5D space
+func genomeDistance(a, b *Genome) float64 {
+	va, vb := map5D(a), map5D(b)
+	var d float64
+	for i := range va {
+		d += (va[i] - vb[i]) * (va[i] - vb[i])
+	}
+	return math.Sqrt(d)
+}
+
+// computeGenStats expects pop to be sorted by fitness, best first
+func computeGenStats(generation int, pop []Genome) GenStats {
+	st := GenStats{
+		Generation: generation,
+		ParamMean:  map[string]float64{},
+		ParamStd:   map[string]float64{},
+		MeanStep:   map[string]float64{},
+		Outcomes:   map[string]int{},
+		Crossover:  crossoverOp,
+		Mutation:   mutationOp,
+		Time:       time.Now(),
+	}
+	n := len(pop)
+	if n == 0 {
+		return st
+	}
+	st.Best = pop[0].Fitness
+	st.Worst = pop[n-1].Fitness
+	if n%2 == 1 {
+		st.Median = pop[n/2].Fitness
+	} else {
+		st.Median = 0.5 * (pop[n/2-1].Fitness + pop[n/2].Fitness)
+	}
+	var sums, sqs, steps [numGenes]float64
+	for i := range pop {
+		st.Mean += pop[i].Fitness
+		st.MeanStd += pop[i].FitnessStd
+		if pop[i].Outcome != "" {
+			st.Outcomes[pop[i].Outcome]++
+		}
+		for k := range genes {
+			v := *pop[i].gene(k)
+			sums[k] += v
+			sqs[k] += v * v
+			steps[k] += pop[i].Steps[k]
+		}
+	}
+	st.Mean /= float64(n)
+	st.MeanStd /= float64(n)
+	for k, spec := range genes {
+		mean := sums[k] / float64(n)
+		st.ParamMean[spec.name] = mean
+		st.ParamStd[spec.name] = math.Sqrt(math.Max(0, sqs[k]/float64(n)-mean*mean))
+		st.MeanStep[spec.name] = steps[k] / float64(n)
+	}
+	pairs := 0
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			st.Diversity += genomeDistance(&pop[i], &pop[j])
+			pairs++
+		}
+	}
+	if pairs > 0 {
+		st.Diversity /= float64(pairs)
+	}
+	return st
+}
+
+// recordStats keeps st for the charts, appends it to the stats log and prints a summary line
+func (g *Game) recordStats(st GenStats) {
+	g.stats = append(g.stats, st)
+	if len(g.stats) > statsHistoryLen {
+		g.stats = g.stats[len(g.stats)-statsHistoryLen:]
+	}
+	if g.statsLog == nil {
+		return
+	}
+	if err := json.NewEncoder(g.statsLog).Encode(st); err != nil {
+		log.Printf("stats log: %v", err)
+	}
+	log.Printf("gen %4d  best %.3f  mean %.3f  median %.3f  worst %.3f  diversity %.3f  eval %.0fms  early stops %d",
+		st.Generation, st.Best, st.Mean, st.Median, st.Worst, st.Diversity, st.EvalMs, st.EarlyStops)
+}
+
+// makeChild breeds one child from two tournament winners of pool
+func (g *Game) makeChild(pool []Genome) Genome {
+	a := tournamentSelect(pool)
+	b := tournamentSelect(pool)
+	child := crossover(a, b)
+	mutate(&child, g.stepScale)
+	child.Bred = true
+	child.ParentFitness = math.Max(a.Fitness, b.Fitness)
+	return child
+}
+
+func asElite(gen Genome) Genome {
+	gen.Bred = false
+	return gen
+}
+
+// ---------- Speciation ----------
+// Species groups genomes lying within speciesThreshold (map5D distance) of its representative
+type Species struct {
+	ID      int
+	Rep     Genome // representative, carried over between generations
+	Members []int  // population indices, best first
+	Best    float64
+	Shared  float64 // summed shared fitness (fitness / species size)
+}
+
+// speciate assigns every genome of the sorted population to the first species whose
+// representative is close enough, founding new species as needed
+func (g *Game) speciate() {
+	for _, sp := range g.species {
+		sp.Members = sp.Members[:0]
+	}
+	for i := range g.population {
+		gen := &g.population[i]
+		var home *Species
+		for _, sp := range g.species {
+			if genomeDistance(gen, &sp.Rep) < speciesThreshold {
+				home = sp
+				break
+			}
+		}
+		if home == nil {
+			g.nextSpeciesID++
+			home = &Species{ID: g.nextSpeciesID, Rep: *gen}
+			g.species = append(g.species, home)
+		}
+		home.Members = append(home.Members, i)
+	}
+	// drop extinct species, refresh representatives and shared fitness
+	alive := g.species[:0]
+	for _, sp := range g.species {
+		if len(sp.Members) == 0 {
+			continue
+		}
+		sp.Rep = g.population[sp.Members[0]]
+		sp.Best = sp.Rep.Fitness
+		sp.Shared = 0
+		for _, i := range sp.Members {
+			sp.Shared += g.population[i].Fitness / float64(len(sp.Members))
+		}
+		alive = append(alive, sp)
+	}
+	g.species = alive
+	sort.Slice(g.species, func(i, j int) bool {
+		return g.species[i].Best > g.species[j].Best
+	})
+}
+
+// breedSpecies builds the next population: the overall elites plus the best genome of each
+// protected species survive, and the remaining slots are split between species in
+// proportion to their shared fitness, each breeding only within itself
+func (g *Game) breedSpecies() []Genome {
+	g.speciate()
+	newPop := make([]Genome, 0, populationSz)
+	kept := map[int]bool{}
+	for i := 0; i < elitism && i < len(g.population); i++ {
+		kept[i] = true
+	}
+	for k, sp := range g.species {
+		if k < speciesProtected {
+			kept[sp.Members[0]] = true
+		}
+	}
+	for i := range g.population {
+		if kept[i] && len(newPop) < populationSz {
+			newPop = append(newPop, asElite(g.population[i]))
+		}
+	}
+
+	slots := allocateOffspring(g.species, populationSz-len(newPop))
+	for k, sp := range g.species {
+		pool := make([]Genome, len(sp.Members))
+		for j, i := range sp.Members {
+			pool[j] = g.population[i]
+		}
+		for n := 0; n < slots[k]; n++ {
+			newPop = append(newPop, g.makeChild(pool))
+		}
+	}
+	return newPop
+}
+
+// allocateOffspring splits n slots between species by shared fitness (largest remainder);
+// when no species has any fitness the split follows species size
+func allocateOffspring(species []*Species, n int) []int {
+	slots := make([]int, len(species))
+	if n <= 0 || len(species) == 0 {
+		return slots
+	}
+	weights := make([]float64, len(species))
+	var total float64
+	for k, sp := range species {
+		weights[k] = sp.Shared
+		total += sp.Shared
+	}
+	if total <= 0 {
+		total = 0
+		for k, sp := range species {
+			weights[k] = float64(len(sp.Members))
+			total += weights[k]
+		}
+	}
+	type rem struct {
+		k    int
+		frac float64
+	}
+	rems := make([]rem, len(species))
+	given := 0
+	for k := range species {
+		share := weights[k] / total * float64(n)
+		slots[k] = int(share)
+		given += slots[k]
+		rems[k] = rem{k, share - float64(slots[k])}
+	}
+	sort.Slice(rems, func(i, j int) bool { return rems[i].frac > rems[j].frac })
+	for i := 0; given < n; i = (i + 1) % len(rems) {
+		slots[rems[i].k]++
+		given++
+	}
+	return slots
 }
 
 // tournament selection (size 3)
@@ -447,15 +1279,16 @@ func tournamentSelect(pop []Genome) Genome {
 
 // ---------- Draw / display ----------
 func (g *Game) Draw(screen *ebiten.Image) {
-	// map A -> texture using genome color bias
-	bias := g.population[g.currentIndex].ColorBias
-	for y := 0; y < gridH; y++ {
-		for x := 0; x < gridW; x++ {
-			v := clamp(g.A[y][x]+bias*0.08, 0, 1)
-			r, gg, b := colorRamp(v)
-			g.texture.Set(x, y, color.NRGBA{R: r, G: gg, B: b, A: 0xFF})
-		}
+	if g.interactive {
+		g.drawInteractive(screen)
+		return
 	}
+	// map A -> texture using genome color bias
+	start := g.timer.Begin()
+	pal := g.palettes.Current()
+	g.pixels.Fill(g.A, pal, g.population[g.currentIndex].ColorBias)
+	g.texture.WritePixels(g.pixels.Pix)
+	g.timer.End(start)
 
 	op := &ebiten.DrawImageOptions{}
 	op.GeoM.Scale(float64(cellSize), float64(cellSize))
@@ -463,30 +1296,186 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	screen.DrawImage(g.texture, op)
 
 	// overlay info
+	for k, line := range g.hud() {
+		text.Draw(screen, line, basicfont.Face7x13, 6, 16+16*k, color.White)
+	}
+
+	if g.showCharts && len(g.stats) > 0 {
+		g.drawStatsCharts(screen)
+	}
+	if g.showAnalysis && g.analysis != nil {
+		g.drawAnalysis(screen)
+	}
+}
+
+// hud is the overlay text, one string per line
+func (g *Game) hud() []string {
 	cur := &g.population[g.currentIndex]
-	txt := fmt.Sprintf("Gen: %d  Index: %d/%d  Fitness(best): %.3f  μ:%.3f σ:%.3f R:%.2f shell:%.2f Δt:%.3f",
-		g.generation, g.currentIndex, len(g.population), g.population[0].Fitness, cur.Mu, cur.Sigma, cur.Radius, cur.ShellSigma, cur.Dt)
-	text.Draw(screen, txt, basicfont.Face7x13, 6, 16, color.White)
+	txt := fmt.Sprintf("Gen: %d  Index: %d/%d  Fitness(best): %.3f±%.3f  μ:%.3f σ:%.3f R:%.2f shell:%.2f Δt:%.3f",
+		g.generation, g.currentIndex, len(g.population), g.population[0].Fitness, g.population[0].FitnessStd, cur.Mu, cur.Sigma, cur.Radius, cur.ShellSigma, cur.Dt)
+	help := "Keys: ←/→ switch genome   G evolve once   SPACE toggle auto-evolve   I interactive   C charts   A analysis   X export   P palette   (auto delay 3s)    FPS:"
+	fps := fmt.Sprintf("%d    palette: %s    %s", g.lastFPS, g.palettes.Current().Name, &g.timer)
 
-	help := "Keys: ←/→ switch genome   G evolve once   SPACE toggle auto-evolve   (auto delay 3s)    FPS:"
-	text.Draw(screen, help, basicfont.Face7x13, 6, 32, color.White)
-	fps := fmt.Sprintf("%d", g.lastFPS)
-	text.Draw(screen, fps, basicfont.Face7x13, 6, 48, color.White)
+	ops := fmt.Sprintf("crossover: %s  mutation: %s  step scale: %.2f", crossoverOp, mutationOp, g.stepScale)
+	if n := len(g.stats); n > 0 {
+		ops += fmt.Sprintf("  success: %.0f%%", 100*g.stats[n-1].SuccessRate)
+	}
+	if cur.Outcome != "" {
+		ops += "  outcome: " + cur.Outcome
+	}
+	if g.lyapunovWeight > 0 && cur.Outcome != "" {
+		ops += fmt.Sprintf("  λ: %.3f", cur.Lyapunov)
+	}
+	lines := []string{txt, help, fps, ops}
+
+	if speciation && len(g.species) > 0 {
+		sizes := make([]string, len(g.species))
+		for k, sp := range g.species {
+			sizes[k] = fmt.Sprintf("#%d:%d", sp.ID, len(sp.Members))
+		}
+		lines = append(lines, fmt.Sprintf("species: %d  sizes: %s", len(g.species), strings.Join(sizes, " ")))
+	}
+	return lines
 }
 
-func (g *Game) Layout(outW, outH int) (int, int) {
-	return gridW * cellSize, gridH * cellSize
+// ---------- Browser viewer ----------
+// publishWeb sends the displayed field, or the interactive tiles, with the HUD to the
+// browser viewer when a frame is due
+func (g *Game) publishWeb() {
+	if g.web == nil || !g.web.Wanted() {
+		return
+	}
+	// without a window Draw never runs, so the HUD times the published frames instead
+	if g.web.Headless {
+		start := g.timer.Begin()
+		defer g.timer.End(start)
+	}
+	pal := g.palettes.Current()
+	px := g.pixels
+	if g.interactive {
+		g.web.SetHUD(g.interactiveHUD()...)
+		px = g.webPixels
+		for i := range px.Pix {
+			px.Pix[i] = 0
+		}
+		for i, t := range g.tiles {
+			t.pixels.Fill(t.A, pal, g.population[i].ColorBias)
+			ox, oy := (i%tileCols)*t.pixels.W, (i/tileCols)*t.pixels.H
+			for y := 0; y < t.pixels.H; y++ {
+				copy(px.Pix[4*((oy+y)*px.W+ox):], t.pixels.Pix[4*y*t.pixels.W:4*(y+1)*t.pixels.W])
+			}
+		}
+	} else {
+		g.web.SetHUD(g.hud()...)
+		px.Fill(g.A, pal, g.population[g.currentIndex].ColorBias)
+	}
+	g.web.Publish(&image.RGBA{Pix: px.Pix, Stride: 4 * px.W, Rect: image.Rect(0, 0, px.W, px.H)})
 }
 
-// ---------- color ramp ----------
-func colorRamp(v float64) (r, g, b uint8) {
-	v = clamp(v, 0, 1)
-	if v < 0.5 {
-		t := v / 0.5
-		return uint8(20 + 50*t), uint8(50 + 150*t), uint8(200 - 100*t)
+// runHeadless updates the game at headlessTPS without a window, for the browser viewer
+func (g *Game) runHeadless() error {
+	tick := time.NewTicker(time.Second / headlessTPS)
+	defer tick.Stop()
+	for range tick.C {
+		if err := g.Update(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ---------- Spatial analysis ----------
+func (g *Game) exportAnalysis() {
+	fa := g.analyzer.Analyze(g.A)
+	label := fmt.Sprintf("gen%d_genome%d_step%d", g.generation, g.currentIndex, g.stepCount)
+	if err := fa.WriteCSV(analysisCSVPath, analysisSummaryPath, label); err != nil {
+		log.Printf("analysis export failed: %v", err)
+		return
 	}
-	t := (v - 0.5) / 0.5
-	return uint8(70 + 180*t), uint8(200 - 80*t), uint8(100 + 150*t)
+	log.Printf("analysis %s: %s -> %s, %s", label, fa.Summary(), analysisCSVPath, analysisSummaryPath)
+}
+
+// drawAnalysis shows the radial power spectrum (log scale) and autocorrelation curves
+func (g *Game) drawAnalysis(screen *ebiten.Image) {
+	fa := g.analysis
+	text.Draw(screen, "analysis: "+fa.Summary(), basicfont.Face7x13, 6, 96, color.White)
+	if len(fa.Spectrum) < 3 {
+		return
+	}
+	logPower := make([]float64, len(fa.Spectrum)-1)
+	for i, p := range fa.Spectrum[1:] {
+		logPower[i] = math.Log10(p + 1e-12)
+	}
+	const w, h, pad = 240, 72, 8
+	y := float32(gridH*cellSize - 2*(h+pad))
+	drawChart(screen, pad, y, w, h, "log power by wavenumber",
+		[][]float64{logPower}, []color.Color{chartBest})
+	drawChart(screen, pad, y+h+pad, w, h, "radial autocorrelation",
+		[][]float64{fa.AutoRadial}, []color.Color{chartMean})
+}
+
+// ---------- Live statistics charts ----------
+var (
+	chartBest   = color.NRGBA{R: 0xff, G: 0xd0, B: 0x40, A: 0xff}
+	chartMean   = color.NRGBA{R: 0x60, G: 0xe0, B: 0x60, A: 0xff}
+	chartMedian = color.NRGBA{R: 0x60, G: 0xb0, B: 0xff, A: 0xff}
+	chartWorst  = color.NRGBA{R: 0xff, G: 0x60, B: 0x60, A: 0xff}
+)
+
+func (g *Game) drawStatsCharts(screen *ebiten.Image) {
+	n := len(g.stats)
+	best := make([]float64, n)
+	mean := make([]float64, n)
+	median := make([]float64, n)
+	worst := make([]float64, n)
+	diversity := make([]float64, n)
+	for i, st := range g.stats {
+		best[i], mean[i], median[i], worst[i] = st.Best, st.Mean, st.Median, st.Worst
+		diversity[i] = st.Diversity
+	}
+	const w, h, pad = 240, 72, 8
+	x := float32(gridW*cellSize - w - pad)
+	y := float32(gridH*cellSize - 2*(h+pad))
+	drawChart(screen, x, y, w, h, "fitness best/mean/median/worst",
+		[][]float64{worst, median, mean, best}, []color.Color{chartWorst, chartMedian, chartMean, chartBest})
+	drawChart(screen, x, y+h+pad, w, h, "diversity",
+		[][]float64{diversity}, []color.Color{chartMedian})
+}
+
+// drawChart plots the series as polylines inside the given box, scaled to their joint min/max
+func drawChart(screen *ebiten.Image, x, y, w, h float32, title string, series [][]float64, colors []color.Color) {
+	vector.DrawFilledRect(screen, x, y, w, h, color.NRGBA{A: 0xa0}, false)
+	vector.StrokeRect(screen, x, y, w, h, 1, color.NRGBA{R: 0x80, G: 0x80, B: 0x80, A: 0xff}, false)
+
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, s := range series {
+		for _, v := range s {
+			lo = math.Min(lo, v)
+			hi = math.Max(hi, v)
+		}
+	}
+	if hi-lo < 1e-9 {
+		hi = lo + 1e-9
+	}
+	const top = 16 // room for the title
+	plotH := h - top - 4
+	for si, s := range series {
+		if len(s) < 2 {
+			continue
+		}
+		dx := (w - 8) / float32(len(s)-1)
+		for i := 1; i < len(s); i++ {
+			y0 := y + h - 4 - float32((s[i-1]-lo)/(hi-lo))*plotH
+			y1 := y + h - 4 - float32((s[i]-lo)/(hi-lo))*plotH
+			vector.StrokeLine(screen, x+4+dx*float32(i-1), y0, x+4+dx*float32(i), y1, 1, colors[si], true)
+		}
+	}
+	label := fmt.Sprintf("%s  [%.3f..%.3f]", title, lo, hi)
+	text.Draw(screen, label, basicfont.Face7x13, int(x)+4, int(y)+12, color.White)
+}
+
+func (g *Game) Layout(outW, outH int) (int, int) {
+	return gridW * cellSize, gridH * cellSize
 }
 
 // ---------- main ----------
@@ -494,7 +1483,43 @@ func main() {
 	ebiten.SetWindowSize(gridW*cellSize, gridH*cellSize)
 	ebiten.SetWindowTitle("Evolving Lenia-like Artificial Life (Ebiten)")
 
+	paletteSpec := flag.String("palette", "classic", "colormap: classic, viridis, magma, inferno, cividis, twilight, greyscale or a gradient file")
+	lyapunovWeight := flag.Float64("lyapunov-weight", 0, "fitness bonus for a Lyapunov exponent near zero, the edge of chaos (0 skips the twin run)")
+	statsLog := flag.String("stats-log", "", "append one JSON record of evolution statistics per generation to this file and log a summary line")
+	web := newWebViewFlags()
+	flag.Parse()
+	palettes, err := newPaletteCycle(*paletteSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if web.Headless && !web.Enabled() {
+		log.Fatal("-web-headless needs -web")
+	}
+
+	log.Printf("operators: crossover=%s mutation=%s", crossoverOp, mutationOp)
 	game := NewGame()
+	game.palettes = palettes
+	game.lyapunovWeight = *lyapunovWeight
+	if *statsLog != "" {
+		f, err := os.OpenFile(*statsLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		game.statsLog = f
+	}
+	if web.Enabled() {
+		if err := web.Start(); err != nil {
+			log.Fatal(err)
+		}
+		game.web = web
+	}
+	if web.Headless {
+		if err := game.runHeadless(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	if err := ebiten.RunGame(game); err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,278 @@
+// modulator.go
+//
+// Chaotic and periodic signal sources that can drive any numeric simulation parameter.
+// Example flags: -mod "mu=lorenz.x:0.05:0.3,dt=sine@0.002:0.02:0.08".
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Modulator is a signal source advanced once per simulation step. Value is normalized to
+// roughly [-1, 1] so that bindings can use the same scale for every source.
+type Modulator interface {
+	Step()
+	Value() float64
+}
+
+// ---------- Lorenz attractor ----------
+type Lorenz struct {
+	x, y, z float64
+	sigma   float64
+	rho     float64
+	beta    float64
+	dt      float64
+	channel int    // 0=x 1=y 2=z, used by Value
+	method  Method // integration scheme, Euler unless set
+}
+
+func (l *Lorenz) state() vec3       { return vec3{l.x, l.y, l.z} }
+func (l *Lorenz) stepSize() float64 { return l.dt }
+
+func (l *Lorenz) deriv(s vec3) vec3 {
+	return vec3{l.sigma * (s[1] - s[0]), s[0]*(l.rho-s[2]) - s[1], s[0]*s[1] - l.beta*s[2]}
+}
+
+func (l *Lorenz) Step() {
+	s := stepODE(l.method, l.deriv, l.state(), l.dt)
+	l.x, l.y, l.z = s[0], s[1], s[2]
+}
+
+func (l *Lorenz) Value() float64 {
+	switch l.channel {
+	case 1:
+		return l.y / 27
+	case 2:
+		return (l.z - 25) / 25
+	}
+	return l.x / 20
+}
+
+// ---------- Rössler attractor ----------
+type Rossler struct {
+	x, y, z float64
+	a, b, c float64
+	dt      float64
+	channel int
+	method  Method
+}
+
+func (r *Rossler) state() vec3       { return vec3{r.x, r.y, r.z} }
+func (r *Rossler) stepSize() float64 { return r.dt }
+
+func (r *Rossler) deriv(s vec3) vec3 {
+	return vec3{-s[1] - s[2], s[0] + r.a*s[1], r.b + s[2]*(s[0]-r.c)}
+}
+
+func (r *Rossler) Step() {
+	s := stepODE(r.method, r.deriv, r.state(), r.dt)
+	r.x, r.y, r.z = s[0], s[1], s[2]
+}
+
+func (r *Rossler) Value() float64 {
+	switch r.channel {
+	case 1:
+		return r.y / 11
+	case 2:
+		return r.z/11 - 1
+	}
+	return r.x / 11
+}
+
+// ---------- Chua's circuit (double scroll) ----------
+type Chua struct {
+	x, y, z     float64
+	alpha, beta float64
+	m0, m1      float64 // slopes of the piecewise-linear diode
+	dt          float64
+	channel     int
+	method      Method
+}
+
+func (c *Chua) diode(x float64) float64 {
+	return c.m1*x + 0.5*(c.m0-c.m1)*(math.Abs(x+1)-math.Abs(x-1))
+}
+
+func (c *Chua) state() vec3       { return vec3{c.x, c.y, c.z} }
+func (c *Chua) stepSize() float64 { return c.dt }
+
+func (c *Chua) deriv(s vec3) vec3 {
+	return vec3{c.alpha * (s[1] - s[0] - c.diode(s[0])), s[0] - s[1] + s[2], -c.beta * s[1]}
+}
+
+func (c *Chua) Step() {
+	s := stepODE(c.method, c.deriv, c.state(), c.dt)
+	c.x, c.y, c.z = s[0], s[1], s[2]
+}
+
+func (c *Chua) Value() float64 {
+	switch c.channel {
+	case 1:
+		return c.y / 0.5
+	case 2:
+		return c.z / 4
+	}
+	return c.x / 2.5
+}
+
+// ---------- Logistic map ----------
+type LogisticMap struct {
+	x, r float64
+}
+
+func (l *LogisticMap) Step()          { l.x = l.r * l.x * (1 - l.x) }
+func (l *LogisticMap) Value() float64 { return 2*l.x - 1 }
+
+// ---------- Sine LFO ----------
+type SineLFO struct {
+	phase float64
+	freq  float64 // cycles per step
+}
+
+func (s *SineLFO) Step()          { s.phase = math.Mod(s.phase+s.freq, 1) }
+func (s *SineLFO) Value() float64 { return math.Sin(2 * math.Pi * s.phase) }
+
+// ---------- Smoothed noise ----------
+// Noise is an Ornstein-Uhlenbeck process: random kicks pulled back towards zero
+type Noise struct {
+	v     float64
+	theta float64 // pull-back rate per step
+	rng   *rand.Rand
+}
+
+func (n *Noise) Step() {
+	n.v += -n.theta*n.v + math.Sqrt(2*n.theta)*n.rng.NormFloat64()*0.5
+}
+
+func (n *Noise) Value() float64 { return clampModulation(n.v) }
+
+func clampModulation(v float64) float64 {
+	return math.Max(-1, math.Min(1, v))
+}
+
+// newModulator builds a modulator from "kind[.channel][@rate]". rate is the integration
+// step for the attractors, r for the logistic map, cycles per step for sine and the
+// pull-back rate for noise. Attractors are integrated with odeMethod. Every modulator of
+// a kind starts from the same state, so several bindings to lorenz.x/.y/.z follow one
+// shared trajectory.
+func newModulator(src string) (Modulator, error) {
+	kind, rate := src, 0.0
+	if i := strings.Index(src, "@"); i >= 0 {
+		r, err := strconv.ParseFloat(src[i+1:], 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad rate in %q: %v", src, err)
+		}
+		kind, rate = src[:i], r
+	}
+	channel := 0
+	if i := strings.Index(kind, "."); i >= 0 {
+		switch kind[i+1:] {
+		case "x":
+		case "y":
+			channel = 1
+		case "z":
+			channel = 2
+		default:
+			return nil, fmt.Errorf("bad channel in %q (want x, y or z)", src)
+		}
+		kind = kind[:i]
+	}
+	or := func(def float64) float64 {
+		if rate > 0 {
+			return rate
+		}
+		return def
+	}
+	switch kind {
+	case "lorenz":
+		return &Lorenz{x: 0.1, sigma: 10, rho: 28, beta: 8.0 / 3.0, dt: or(0.01), channel: channel, method: odeMethod}, nil
+	case "rossler":
+		return &Rossler{x: 0.1, a: 0.2, b: 0.2, c: 5.7, dt: or(0.02), channel: channel, method: odeMethod}, nil
+	case "chua":
+		return &Chua{x: 0.7, alpha: 15.6, beta: 28, m0: -1.143, m1: -0.714, dt: or(0.005), channel: channel, method: odeMethod}, nil
+	case "logistic":
+		return &LogisticMap{x: 0.3, r: or(3.9)}, nil
+	case "sine":
+		return &SineLFO{freq: or(0.005)}, nil
+	case "noise":
+		return &Noise{theta: or(0.02), rng: rand.New(rand.NewSource(rand.Int63()))}, nil
+	}
+	return nil, fmt.Errorf("unknown modulator %q (want lorenz, rossler, chua, logistic, sine or noise)", kind)
+}
+
+// ---------- Parameter bindings ----------
+// Binding drives one parameter: *target = Offset + Scale*Mod.Value() after every step
+type Binding struct {
+	Param         string
+	Source        string
+	Mod           Modulator
+	Scale, Offset float64
+	target        *float64
+}
+
+// parseBindings reads a comma-separated list of "param=source[:scale[:offset]]" against
+// the parameters a program exposes. A missing offset keeps the parameter's current value
+// as the centre of the modulation.
+func parseBindings(spec string, params map[string]*float64) ([]*Binding, error) {
+	var out []*Binding
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		eq := strings.Index(item, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("binding %q: want param=source[:scale[:offset]]", item)
+		}
+		name := strings.TrimSpace(item[:eq])
+		target, ok := params[name]
+		if !ok {
+			return nil, fmt.Errorf("binding %q: unknown parameter %q (have %s)", item, name, paramList(params))
+		}
+		fields := strings.Split(item[eq+1:], ":")
+		mod, err := newModulator(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("binding %q: %v", item, err)
+		}
+		b := &Binding{Param: name, Source: fields[0], Mod: mod, Scale: 1, Offset: *target, target: target}
+		for i, f := range fields[1:] {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return nil, fmt.Errorf("binding %q: %v", item, err)
+			}
+			if i == 0 {
+				b.Scale = v
+			} else {
+				b.Offset = v
+			}
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+func paramList(params map[string]*float64) string {
+	names := make([]string, 0, len(params))
+	for n := range params {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// stepBindings advances every modulator and writes the bound parameters
+func stepBindings(bs []*Binding) {
+	for _, b := range bs {
+		b.Mod.Step()
+		*b.target = b.Offset + b.Scale*b.Mod.Value()
+	}
+}
+
+func (b *Binding) String() string {
+	return fmt.Sprintf("%s=%s:%g:%g", b.Param, b.Source, b.Scale, b.Offset)
+}
@@ -0,0 +1,325 @@
+// npy.go
+//
+// State exchange with Python notebooks: NumPy .npy files (little-endian float32 or
+// float64 in C order) for fields and particle arrays, CSV for particle tables, a
+// per-frame dump of a program's state and loading a saved state as the starting point.
+// In Python, np.load("dump/field_00001.npy") returns the field as a (rows, cols) array
+// and np.save("start.npy", A) writes one the programs can load with -load start.npy.
+// Example flags: -dump dump -dump-every 10.
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const npyMagic = "\x93NUMPY"
+
+// NPYArray is an n-dimensional array with its values in C (row-major) order
+type NPYArray struct {
+	Shape []int
+	Data  []float64
+}
+
+// fieldArray wraps a field as a (rows, cols) array
+func fieldArray(A [][]float64) NPYArray {
+	a := NPYArray{Shape: []int{len(A), 0}}
+	if len(A) > 0 {
+		a.Shape[1] = len(A[0])
+	}
+	for _, row := range A {
+		a.Data = append(a.Data, row...)
+	}
+	return a
+}
+
+// Field copies a (h, w) array into A, which must have h rows of w cells
+func (a NPYArray) Field(A [][]float64) error {
+	h := len(A)
+	w := 0
+	if h > 0 {
+		w = len(A[0])
+	}
+	if len(a.Shape) != 2 || a.Shape[0] != h || a.Shape[1] != w {
+		return fmt.Errorf("field shape %v, want (%d, %d)", a.Shape, h, w)
+	}
+	for y := range A {
+		copy(A[y], a.Data[y*w:(y+1)*w])
+	}
+	return nil
+}
+
+// ---------- .npy files ----------
+// writeNPY writes a in format version 1.0 as float64, or float32 if f32 is set
+func writeNPY(path string, a NPYArray, f32 bool) error {
+	descr, size := "<f8", 8
+	if f32 {
+		descr, size = "<f4", 4
+	}
+	dims := make([]string, len(a.Shape))
+	for i, n := range a.Shape {
+		dims[i] = strconv.Itoa(n)
+	}
+	shape := strings.Join(dims, ", ")
+	if len(dims) == 1 {
+		shape += ","
+	}
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%s), }", descr, shape)
+	// magic, version and length take 10 bytes; the header is padded with spaces and a
+	// newline so the data starts at a multiple of 64
+	pad := 64 - (10+len(header)+1)%64
+	if pad == 64 {
+		pad = 0
+	}
+	header += strings.Repeat(" ", pad) + "\n"
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	w.WriteString(npyMagic)
+	w.Write([]byte{1, 0})
+	binary.Write(w, binary.LittleEndian, uint16(len(header)))
+	w.WriteString(header)
+	buf := make([]byte, size)
+	for _, v := range a.Data {
+		if f32 {
+			binary.LittleEndian.PutUint32(buf, math.Float32bits(float32(v)))
+		} else {
+			binary.LittleEndian.PutUint64(buf, math.Float64bits(v))
+		}
+		w.Write(buf)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readNPY reads a float32 or float64 array in C order (format versions 1.0 to 3.0)
+func readNPY(path string) (NPYArray, error) {
+	var a NPYArray
+	f, err := os.Open(path)
+	if err != nil {
+		return a, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return a, err
+	}
+	// the header and data sizes are checked against this before anything is allocated
+	remaining := st.Size()
+	r := bufio.NewReader(f)
+
+	pre := make([]byte, 8)
+	if _, err := io.ReadFull(r, pre); err != nil || string(pre[:6]) != npyMagic {
+		return a, fmt.Errorf("%s: not a .npy file", path)
+	}
+	var hlen int
+	switch pre[6] {
+	case 1:
+		var n uint16
+		err = binary.Read(r, binary.LittleEndian, &n)
+		hlen = int(n)
+	case 2, 3:
+		var n uint32
+		err = binary.Read(r, binary.LittleEndian, &n)
+		hlen = int(n)
+	default:
+		return a, fmt.Errorf("%s: unsupported .npy version %d.%d", path, pre[6], pre[7])
+	}
+	if err != nil {
+		return a, fmt.Errorf("%s: %v", path, err)
+	}
+	remaining -= int64(len(pre)) + 2
+	if pre[6] != 1 {
+		remaining -= 2
+	}
+	if int64(hlen) > remaining {
+		return a, fmt.Errorf("%s: header of %d bytes runs past the end of the file", path, hlen)
+	}
+	remaining -= int64(hlen)
+	hb := make([]byte, hlen)
+	if _, err := io.ReadFull(r, hb); err != nil {
+		return a, fmt.Errorf("%s: %v", path, err)
+	}
+	header := string(hb)
+
+	descr := npyHeaderValue(header, "descr")
+	var size int
+	var order binary.ByteOrder = binary.LittleEndian
+	switch strings.Trim(descr, "'\"") {
+	case "<f8":
+		size = 8
+	case "<f4":
+		size = 4
+	case ">f8":
+		size, order = 8, binary.BigEndian
+	case ">f4":
+		size, order = 4, binary.BigEndian
+	default:
+		return a, fmt.Errorf("%s: dtype %s, want float32 or float64 (use A.astype(np.float32))", path, descr)
+	}
+	if npyHeaderValue(header, "fortran_order") != "False" {
+		return a, fmt.Errorf("%s: Fortran order, save np.ascontiguousarray(A) instead", path)
+	}
+	dims := strings.Trim(npyHeaderValue(header, "shape"), "()")
+	n := 1
+	for _, d := range strings.Split(dims, ",") {
+		if d = strings.TrimSpace(d); d == "" {
+			continue
+		}
+		k, err := strconv.Atoi(d)
+		if err != nil || k < 0 {
+			return a, fmt.Errorf("%s: bad shape (%s)", path, dims)
+		}
+		if k > 0 && n > math.MaxInt/size/k {
+			return a, fmt.Errorf("%s: shape (%s) is too large", path, dims)
+		}
+		a.Shape = append(a.Shape, k)
+		n *= k
+	}
+	if int64(n)*int64(size) > remaining {
+		return a, fmt.Errorf("%s: data ends after %d of %d values", path, remaining/int64(size), n)
+	}
+
+	a.Data = make([]float64, n)
+	buf := make([]byte, size)
+	for i := range a.Data {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return a, fmt.Errorf("%s: data ends after %d of %d values", path, i, n)
+		}
+		if size == 4 {
+			a.Data[i] = float64(math.Float32frombits(order.Uint32(buf)))
+		} else {
+			a.Data[i] = math.Float64frombits(order.Uint64(buf))
+		}
+	}
+	return a, nil
+}
+
+// npyHeaderValue returns the raw value of key in the header dict, e.g. "(160, 240)"
+func npyHeaderValue(header, key string) string {
+	i := strings.Index(header, "'"+key+"'")
+	if i < 0 {
+		return ""
+	}
+	v := strings.TrimSpace(header[i+len(key)+2:])
+	v = strings.TrimSpace(strings.TrimPrefix(v, ":"))
+	end := strings.IndexAny(v, ",}")
+	if strings.HasPrefix(v, "(") {
+		end = strings.Index(v, ")") + 1
+	}
+	if end <= 0 {
+		return v
+	}
+	return strings.TrimSpace(v[:end])
+}
+
+// ---------- CSV tables ----------
+// writeTableCSV writes rows of numbers under a header line
+func writeTableCSV(path string, cols []string, rows [][]float64) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, strings.Join(cols, ","))
+	for _, row := range rows {
+		for i, v := range row {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(strconv.FormatFloat(v, 'g', 8, 64))
+		}
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// tableArray wraps rows of equal length as a (rows, cols) array
+func tableArray(rows [][]float64, ncols int) NPYArray {
+	a := NPYArray{Shape: []int{len(rows), ncols}, Data: make([]float64, 0, len(rows)*ncols)}
+	for _, row := range rows {
+		a.Data = append(a.Data, row...)
+	}
+	return a
+}
+
+// ---------- Dumps and loading ----------
+// StateIO loads a program's starting state and dumps its state every few frames
+type StateIO struct {
+	Load  string // .npy file with the starting state, "" for the program's own
+	Dir   string // dump directory, "" for no dumps
+	Every int    // dump every Nth frame
+	F32   bool   // dump float32 instead of float64
+
+	frame int
+	made  bool
+}
+
+// newStateIOFlags registers the load and dump flags and returns the StateIO they fill in
+// once flag.Parse has run
+func newStateIOFlags() *StateIO {
+	s := &StateIO{}
+	flag.StringVar(&s.Load, "load", "", "start from the state in this .npy file")
+	flag.StringVar(&s.Dir, "dump", "", "directory to dump the state to as .npy (and CSV for particles)")
+	flag.IntVar(&s.Every, "dump-every", 1, "dump every Nth frame")
+	flag.BoolVar(&s.F32, "dump-f32", false, "dump float32 instead of float64")
+	return s
+}
+
+// Next counts a frame and reports whether its state should be dumped
+func (s *StateIO) Next() bool {
+	if s.Dir == "" {
+		return false
+	}
+	s.frame++
+	return s.Every < 2 || (s.frame-1)%s.Every == 0
+}
+
+func (s *StateIO) path(name, ext string) (string, error) {
+	if !s.made {
+		if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+			return "", err
+		}
+		s.made = true
+	}
+	return filepath.Join(s.Dir, fmt.Sprintf("%s_%05d.%s", name, s.frame, ext)), nil
+}
+
+// DumpField writes A as field_NNNNN.npy
+func (s *StateIO) DumpField(A [][]float64) error {
+	p, err := s.path("field", "npy")
+	if err != nil {
+		return err
+	}
+	return writeNPY(p, fieldArray(A), s.F32)
+}
+
+// DumpTable writes rows as name_NNNNN.npy and name_NNNNN.csv
+func (s *StateIO) DumpTable(name string, cols []string, rows [][]float64) error {
+	p, err := s.path(name, "npy")
+	if err != nil {
+		return err
+	}
+	if err := writeNPY(p, tableArray(rows, len(cols)), s.F32); err != nil {
+		return err
+	}
+	return writeTableCSV(strings.TrimSuffix(p, ".npy")+".csv", cols, rows)
+}
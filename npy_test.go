@@ -0,0 +1,146 @@
+// test: go test npy_test.go npy.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNPYRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name  string
+		shape []int
+		f32   bool
+	}{
+		{"matrix", []int{3, 4}, false},
+		{"matrix32", []int{3, 4}, true},
+		{"vector", []int{5}, false},
+		{"empty", []int{0}, false},
+		{"cube", []int{2, 3, 4}, true},
+		{"field", []int{160, 240}, false},
+	} {
+		n := 1
+		for _, d := range tc.shape {
+			n *= d
+		}
+		a := NPYArray{Shape: tc.shape, Data: make([]float64, n)}
+		for i := range a.Data {
+			// exact in float32 as well
+			a.Data[i] = float64(i)*0.25 - 3
+		}
+		path := filepath.Join(dir, tc.name+".npy")
+		if err := writeNPY(path, a, tc.f32); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(raw[:6]) != npyMagic || raw[6] != 1 || raw[7] != 0 {
+			t.Errorf("%s: preamble % x, want magic and version 1.0", tc.name, raw[:8])
+		}
+		start := 10 + int(binary.LittleEndian.Uint16(raw[8:10]))
+		if start%64 != 0 || raw[start-1] != '\n' {
+			t.Errorf("%s: data starts at %d, want a multiple of 64 after a newline", tc.name, start)
+		}
+		size := 8
+		if tc.f32 {
+			size = 4
+		}
+		if len(raw)-start != n*size {
+			t.Errorf("%s: %d data bytes, want %d", tc.name, len(raw)-start, n*size)
+		}
+
+		b, err := readNPY(path)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if len(b.Shape) != len(a.Shape) {
+			t.Fatalf("%s: shape %v, want %v", tc.name, b.Shape, a.Shape)
+		}
+		for i := range a.Shape {
+			if b.Shape[i] != a.Shape[i] {
+				t.Errorf("%s: shape %v, want %v", tc.name, b.Shape, a.Shape)
+			}
+		}
+		for i := range a.Data {
+			if b.Data[i] != a.Data[i] {
+				t.Errorf("%s: value %d is %g, want %g", tc.name, i, b.Data[i], a.Data[i])
+				break
+			}
+		}
+	}
+}
+
+// rawNPY builds a .npy file by hand, with the header length field sized for the version
+func rawNPY(version byte, header string, order binary.ByteOrder, values ...float32) []byte {
+	var b bytes.Buffer
+	b.WriteString(npyMagic)
+	b.Write([]byte{version, 0})
+	if version == 1 {
+		binary.Write(&b, binary.LittleEndian, uint16(len(header)))
+	} else {
+		binary.Write(&b, binary.LittleEndian, uint32(len(header)))
+	}
+	b.WriteString(header)
+	for _, v := range values {
+		binary.Write(&b, order, math.Float32bits(v))
+	}
+	return b.Bytes()
+}
+
+func TestReadNPYHeaders(t *testing.T) {
+	dir := t.TempDir()
+	le, be := binary.LittleEndian, binary.BigEndian
+	for _, tc := range []struct {
+		name   string
+		file   []byte
+		shape  []int
+		errMsg string // substring of the expected error, "" for success
+	}{
+		{"v1", rawNPY(1, "{'descr': '<f4', 'fortran_order': False, 'shape': (2,), }\n", le, 1, 2), []int{2}, ""},
+		{"v2", rawNPY(2, "{'descr': '<f4', 'fortran_order': False, 'shape': (1, 2), }\n", le, 1, 2), []int{1, 2}, ""},
+		{"v3", rawNPY(3, "{'descr': '<f4', 'fortran_order': False, 'shape': (2,), }\n", le, 1, 2), []int{2}, ""},
+		{"big endian", rawNPY(1, "{'descr': '>f4', 'fortran_order': False, 'shape': (2,), }\n", be, 1, 2), []int{2}, ""},
+		{"scalar", rawNPY(1, "{'descr': '<f4', 'fortran_order': False, 'shape': (), }\n", le, 1), nil, ""},
+		{"version 4", rawNPY(4, "{}\n", le), nil, "unsupported .npy version"},
+		{"negative dim", rawNPY(1, "{'descr': '<f4', 'fortran_order': False, 'shape': (-1, 2), }\n", le), nil, "bad shape"},
+		{"fortran", rawNPY(1, "{'descr': '<f4', 'fortran_order': True, 'shape': (2,), }\n", le, 1, 2), nil, "Fortran order"},
+		{"int dtype", rawNPY(1, "{'descr': '<i4', 'fortran_order': False, 'shape': (2,), }\n", le, 1, 2), nil, "dtype"},
+		{"truncated", rawNPY(1, "{'descr': '<f4', 'fortran_order': False, 'shape': (3,), }\n", le, 1, 2), nil, "data ends after 2 of 3"},
+		{"huge shape", rawNPY(1, "{'descr': '<f4', 'fortran_order': False, 'shape': (1099511627776,), }\n", le, 1, 2), nil, "data ends after 2 of 1099511627776"},
+		{"overflowing shape", rawNPY(1, "{'descr': '<f8', 'fortran_order': False, 'shape': (4294967296, 4294967296), }\n", le), nil, "too large"},
+		{"wrapping shape", rawNPY(1, "{'descr': '<f4', 'fortran_order': False, 'shape': (4294967296, 4294967296, 2), }\n", le), nil, "too large"},
+		{"long header", []byte(npyMagic + "\x02\x00\xf0\xff\xff\xff{'descr'"), nil, "runs past the end"},
+		{"not npy", []byte("PK\x03\x04 a zip file"), nil, "not a .npy file"},
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(tc.name, " ", "_")+".npy")
+		if err := os.WriteFile(path, tc.file, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		a, err := readNPY(path)
+		if tc.errMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.errMsg) {
+				t.Errorf("%s: error %v, want one containing %q", tc.name, err, tc.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if len(a.Shape) != len(tc.shape) {
+			t.Errorf("%s: shape %v, want %v", tc.name, a.Shape, tc.shape)
+		}
+		if len(a.Data) > 0 && (a.Data[0] != 1 || a.Data[len(a.Data)-1] != float64(len(a.Data))) {
+			t.Errorf("%s: data %v", tc.name, a.Data)
+		}
+	}
+}
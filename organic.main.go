@@ -1,16 +1,25 @@
 // lenia_ebiten.go
+// run: go run organic.main.go tracking.go classify.go sweep.go integrator.go lyapunov.go recorder.go palette.go render.go npy.go imageseed.go control.go
+// sweep: go run organic.main.go tracking.go classify.go sweep.go integrator.go lyapunov.go recorder.go palette.go render.go npy.go imageseed.go control.go -sweep mu=0.1:0.4:24,sigma=0.01:0.1:24
+// headless GIF: go run organic.main.go tracking.go classify.go sweep.go integrator.go lyapunov.go recorder.go palette.go render.go npy.go imageseed.go control.go -headless -steps 600 -gif lenia.gif -gif-frames 300
 package main
 
 import (
+	"flag"
 	"fmt"
+	"image"
 	"image/color"
 	"log"
 	"math"
 	"math/rand"
+	"path/filepath"
+	"runtime"
 	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/hajimehoshi/ebiten/v2/vector"
 	"golang.org/x/image/font/basicfont"
 )
 
@@ -19,18 +28,47 @@ const (
 	gridW      = 240  // lattice width
 	gridH      = 160  // lattice height
 	cellSize   = 4    // display pixel size for each lattice cell
-	radius     = 6.0  // neighborhood radius in grid units (R)
+	radius     = 6.0  // default neighborhood radius in grid units (R)
 	dtDefault  = 0.08 // Δt
 	muDefault  = 0.30 // μ for growth mapping
 	sigDefault = 0.06 // σ for growth mapping
+
+	classifyEvery = 4 // frames between classifier observations
+
+	tracksCSVPath = "tracks.csv"       // per-blob rows while exporting (X key)
+	eventsCSVPath = "track_events.csv" // births, deaths, splits and merges
+
+	sweepSeed = 1 // rand seed of the initial pattern of every sweep run
 )
 
+// sweepParams are the parameters a sweep axis may vary
+var sweepParams = []string{"mu", "sigma", "dt", "R"}
+
 // ---------- Types ----------
 type KernelEntry struct {
 	dx, dy int
 	w      float64
 }
 
+// Params are the rule parameters of a run
+type Params struct {
+	Mu, Sigma, Dt, R float64
+}
+
+// set assigns one of sweepParams by name
+func (p *Params) set(name string, v float64) {
+	switch name {
+	case "mu":
+		p.Mu = v
+	case "sigma":
+		p.Sigma = v
+	case "dt":
+		p.Dt = v
+	case "R":
+		p.R = v
+	}
+}
+
 type Game struct {
 	A       [][]float64 // current state grid [y][x]
 	Anext   [][]float64 // next state grid
@@ -39,7 +77,27 @@ type Game struct {
 	dt      float64
 	mu      float64
 	sigma   float64
+	R       float64
 	texture *ebiten.Image // gridW x gridH image we write pixels into and scale up
+	pixels  *FieldPixels  // colour buffer uploaded to texture each frame
+	timer   FrameTimer
+
+	tracker    *Tracker
+	showTracks bool
+
+	classifier   *Classifier
+	classifiedAt [4]float64 // μ, σ, Δt, R the classifier has been observing
+
+	// Lyapunov exponent from a perturbed twin of the field (Y key), nil when off
+	lyap *Lyapunov
+	twin *Game
+
+	rec      *Recorder     // R key, or from launch with -record-frames
+	palettes *PaletteCycle // P key
+	state    *StateIO      // -load and -dump
+	img      *ImageSeed    // -image, also used when reseeding
+	ctl      *Control      // -control
+
 	frame   int
 	start   time.Time
 	lastFPS int
@@ -121,9 +179,9 @@ func growth(u, mu, sigma float64) float64 {
 }
 
 // ---------- Initialize ----------
-func NewGame() *Game {
-	rand.Seed(time.Now().UnixNano())
-
+// newSimulation allocates the grids, seeds the initial pattern from rng and builds the
+// kernel; it needs no window, so sweeps use it directly
+func newSimulation(p Params, rng *rand.Rand) *Game {
 	// allocate grids
 	A := make([][]float64, gridH)
 	Anext := make([][]float64, gridH)
@@ -132,7 +190,23 @@ func NewGame() *Game {
 		Anext[y] = make([]float64, gridW)
 	}
 
-	// initial pattern: a blob in the center + a few random specks
+	seedPattern(A, rng)
+	kernel, knorm := buildKernel(p.R)
+
+	return &Game{
+		A:      A,
+		Anext:  Anext,
+		kernel: kernel,
+		Knorm:  knorm,
+		dt:     p.Dt,
+		mu:     p.Mu,
+		sigma:  p.Sigma,
+		R:      p.R,
+	}
+}
+
+// seedPattern draws the initial pattern: a blob in the center + a few random specks
+func seedPattern(A [][]float64, rng *rand.Rand) {
 	cx, cy := gridW/2, gridH/2
 	for y := 0; y < gridH; y++ {
 		for x := 0; x < gridW; x++ {
@@ -143,27 +217,21 @@ func NewGame() *Game {
 				A[y][x] = 0.8 * math.Exp(-d*d/(2*8*8))
 			}
 			// sprinkle random noise
-			if rand.Float64() < 0.001618033 {
-				A[y][x] = rand.Float64()*0.8 + 0.1618033
+			if rng.Float64() < 0.001618033 {
+				A[y][x] = rng.Float64()*0.8 + 0.1618033
 			}
 		}
 	}
+}
 
-	kernel, knorm := buildKernel(radius)
-
-	tex := ebiten.NewImage(gridW, gridH)
-
-	g := &Game{
-		A:       A,
-		Anext:   Anext,
-		kernel:  kernel,
-		Knorm:   knorm,
-		dt:      dtDefault,
-		mu:      muDefault,
-		sigma:   sigDefault,
-		texture: tex,
-		start:   time.Now(),
-	}
+func NewGame(p Params) *Game {
+	g := newSimulation(p, rand.New(rand.NewSource(time.Now().UnixNano())))
+	g.texture = ebiten.NewImage(gridW, gridH)
+	g.pixels = newFieldPixels(gridW, gridH)
+	g.tracker = newTracker(gridW, gridH)
+	g.classifier = newClassifier(gridW, gridH)
+	g.classifier.Every = classifyEvery
+	g.start = time.Now()
 	return g
 }
 
@@ -193,6 +261,10 @@ func (g *Game) step() {
 
 // ---------- Ebiten game interface ----------
 func (g *Game) Update() error {
+	if g.rec.Done() {
+		return ebiten.Termination
+	}
+	g.ctl.Apply()
 	// keyboard controls for parameters (optional)
 	if ebiten.IsKeyPressed(ebiten.KeyU) { // increase mu
 		g.mu += 0.002
@@ -221,11 +293,59 @@ func (g *Game) Update() error {
 			g.dt = 0.001
 		}
 	}
+	// creature tracking overlay and CSV export
+	if inpututil.IsKeyJustPressed(ebiten.KeyT) {
+		g.showTracks = !g.showTracks
+		if !g.showTracks && !g.tracker.Recording() {
+			g.tracker.Reset()
+		}
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyX) {
+		g.toggleTrackExport()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyR) {
+		g.rec.Toggle()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyP) {
+		g.palettes.Next()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyY) {
+		if g.lyap == nil {
+			g.startLyapunov(rand.New(rand.NewSource(time.Now().UnixNano())))
+		} else {
+			g.lyap, g.twin = nil, nil
+		}
+	}
+	// a control client may have paused the run
+	if !g.ctl.ShouldStep() {
+		return nil
+	}
 	// run a few simulation steps per frame for stability if dt is small
 	stepsPerFrame := 1
 	for i := 0; i < stepsPerFrame; i++ {
 		g.step()
+		if g.lyap != nil {
+			g.stepTwin()
+		}
 	}
+	if g.showTracks || g.tracker.Recording() {
+		g.tracker.Update(g.A)
+	}
+	// a parameter change starts a new run for the classifier and the exponent estimate
+	if params := [4]float64{g.mu, g.sigma, g.dt, g.R}; params != g.classifiedAt {
+		g.classifier.Reset()
+		g.classifiedAt = params
+		if g.lyap != nil {
+			g.startLyapunov(rand.New(rand.NewSource(time.Now().UnixNano())))
+		}
+	}
+	g.classifier.Observe(g.A)
+	if g.state.Next() {
+		if err := g.state.DumpField(g.A); err != nil {
+			log.Printf("dump: %v", err)
+		}
+	}
+	g.ctl.Stats(g.controlStats)
 	g.frame++
 	// FPS estimate every ~30 frames
 	if g.frame%30 == 0 {
@@ -238,17 +358,12 @@ func (g *Game) Update() error {
 }
 
 func (g *Game) Draw(screen *ebiten.Image) {
-	// write A into texture (gridW x gridH) as colored pixels
-	// map value to color (e.g. bluish -> green -> yellow)
-	for y := 0; y < gridH; y++ {
-		for x := 0; x < gridW; x++ {
-			v := g.A[y][x]
-			// map v in [0,1] to a color gradient
-			// -> simple viridis-like ramp approximation:
-			r, gg, b := colorRamp(v)
-			g.texture.Set(x, y, color.NRGBA{R: r, G: gg, B: b, A: 0xFF})
-		}
-	}
+	// colour A into the pixel buffer and upload it to the texture in one call
+	start := g.timer.Begin()
+	pal := g.palettes.Current()
+	g.pixels.Fill(g.A, pal, 0)
+	g.texture.WritePixels(g.pixels.Pix)
+	g.timer.End(start)
 	// draw scaled to window
 	op := &ebiten.DrawImageOptions{}
 	op.GeoM.Scale(float64(cellSize), float64(cellSize))
@@ -256,37 +371,453 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	screen.DrawImage(g.texture, op)
 
 	// overlay text for parameters and instructions
-	txt := fmt.Sprintf("μ: %.3f  σ: %.3f  Δt: %.3f  R: %.1f    FPS(est): %d", g.mu, g.sigma, g.dt, radius, g.lastFPS)
+	txt := fmt.Sprintf("μ: %.3f  σ: %.3f  Δt: %.3f  R: %.1f    FPS(est): %d    palette: %s    %s", g.mu, g.sigma, g.dt, g.R, g.lastFPS, pal.Name, &g.timer)
+	if g.ctl.Paused() {
+		txt += "    PAUSED (control)"
+	}
 	text.Draw(screen, txt, basicfont.Face7x13, 6, 18, color.White)
 
-	help := "Keys: U/J μ+/-   I/K σ+/-   O/L Δt+/-   (wrap boundary, gaussian shell, growth=gaussian)"
+	help := "Keys: U/J μ+/-   I/K σ+/-   O/L Δt+/-   T tracks   X export tracks   Y lyapunov   R record   P palette   (wrap boundary, gaussian shell, growth=gaussian)"
 	text.Draw(screen, help, basicfont.Face7x13, 6, 34, color.White)
+
+	if g.showTracks {
+		g.drawTracks(screen)
+	}
+	if g.showTracks || g.tracker.Recording() {
+		status := fmt.Sprintf("creatures: %d", len(g.tracker.Blobs))
+		if g.tracker.Recording() {
+			status += "   exporting " + tracksCSVPath
+		}
+		text.Draw(screen, status, basicfont.Face7x13, 6, 50, color.White)
+	}
+	text.Draw(screen, "outcome: "+g.classifier.Result().String(), basicfont.Face7x13, 6, 66, color.White)
+	if g.lyap != nil {
+		text.Draw(screen, g.lyap.String(), basicfont.Face7x13, 6, 82, color.White)
+	}
+
+	// capture before the recording indicator so it stays out of the frames
+	if g.rec.Next() {
+		g.captureFrame(screen)
+	}
+	if g.rec.Recording() {
+		text.Draw(screen, fmt.Sprintf("REC %d frames", g.rec.Frames()), basicfont.Face7x13, 6, 98, color.NRGBA{R: 0xff, G: 0x40, B: 0x40, A: 0xff})
+	}
+}
+
+// ---------- Recording ----------
+// captureFrame hands the finished screen to the recorder
+func (g *Game) captureFrame(screen *ebiten.Image) {
+	b := screen.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	screen.ReadPixels(img.Pix)
+	if err := g.rec.Capture(img); err != nil {
+		log.Printf("recorder: %v", err)
+	}
+}
+
+// renderField draws A with pal, scale pixels per cell, for headless output
+func renderField(A [][]float64, pal *Palette, scale int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, gridW*scale, gridH*scale))
+	for y := 0; y < gridH*scale; y++ {
+		for x := 0; x < gridW*scale; x++ {
+			r, gg, b := pal.At(A[y/scale][x/scale])
+			img.SetNRGBA(x, y, color.NRGBA{R: r, G: gg, B: b, A: 0xFF})
+		}
+	}
+	return img
+}
+
+// runHeadless simulates steps steps without a window, recording the rendered field,
+// dumping the field and serving the control API as configured
+func runHeadless(p Params, steps int, rec *Recorder, state *StateIO, img *ImageSeed, pal *Palette, ctl *Control) {
+	if !rec.Enabled() && state.Dir == "" && !ctl.Enabled() {
+		log.Fatal("-headless needs -record, -gif, -dump or -control")
+	}
+	g := newSimulation(p, rand.New(rand.NewSource(time.Now().UnixNano())))
+	g.state, g.img, g.ctl = state, img, ctl
+	if err := g.seedField(img, state); err != nil {
+		log.Fatal(err)
+	}
+	if err := g.startControl(); err != nil {
+		log.Fatal(err)
+	}
+	defer ctl.Close()
+	if rec.Enabled() {
+		if err := rec.Start(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// with a control client steering the run, steps <= 0 runs until the process is stopped
+	for s := 0; (s < steps || steps <= 0 && ctl.Enabled()) && !rec.Done(); {
+		ctl.Apply()
+		if !ctl.ShouldStep() {
+			time.Sleep(10 * time.Millisecond) // paused by a control client
+			continue
+		}
+		s++
+		g.step()
+		if rec.Next() {
+			if err := rec.Capture(renderField(g.A, pal, cellSize)); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if state.Next() {
+			if err := state.DumpField(g.A); err != nil {
+				log.Fatal(err)
+			}
+		}
+		ctl.Stats(g.controlStats)
+	}
+	if err := rec.Stop(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// seedField replaces the initial pattern with the -image picture or the -load field
+func (g *Game) seedField(img *ImageSeed, state *StateIO) error {
+	if state.Load != "" {
+		return g.loadField(state.Load)
+	}
+	if !img.Enabled() {
+		return nil
+	}
+	A, err := img.Field(gridW, gridH)
+	if err != nil {
+		return err
+	}
+	for y := range A {
+		copy(g.A[y], A[y])
+	}
+	return nil
+}
+
+// loadField replaces the field with the (gridH, gridW) array in a .npy file
+func (g *Game) loadField(path string) error {
+	a, err := readNPY(path)
+	if err != nil {
+		return err
+	}
+	if err := a.Field(g.A); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for y := range g.A {
+		for x := range g.A[y] {
+			g.A[y][x] = clamp(g.A[y][x], 0, 1)
+		}
+	}
+	return nil
+}
+
+// ---------- Control API ----------
+// startControl registers the rule parameters and actions with g.ctl and starts its server
+func (g *Game) startControl() error {
+	if !g.ctl.Enabled() {
+		return nil
+	}
+	g.ctl.Param(ControlParam{Name: "mu", Min: 0, Max: 1, Doc: "μ of the growth mapping",
+		Get: func() float64 { return g.mu }, Set: func(v float64) { g.mu = v }})
+	g.ctl.Param(ControlParam{Name: "sigma", Min: 0.0001, Max: 0.5, Doc: "σ of the growth mapping",
+		Get: func() float64 { return g.sigma }, Set: func(v float64) { g.sigma = v }})
+	g.ctl.Param(ControlParam{Name: "dt", Min: 0.001, Max: 1, Doc: "time step Δt",
+		Get: func() float64 { return g.dt }, Set: func(v float64) { g.dt = v }})
+	g.ctl.Param(ControlParam{Name: "R", Min: 1, Max: 30, Doc: "kernel radius in cells",
+		Get: func() float64 { return g.R }, Set: g.setRadius})
+	g.ctl.Action("snapshot", "write the field as .npy and .png (into the -dump directory if set)", g.snapshot)
+	g.ctl.Action("reseed", "restart from the initial pattern, or the -image / -load field", g.reseed)
+	return g.ctl.Start()
+}
+
+// setRadius rebuilds the kernel for radius R
+func (g *Game) setRadius(R float64) {
+	g.R = R
+	g.kernel, g.Knorm = buildKernel(R)
+}
+
+// snapshot writes the current field as snapshot_<step>.npy and .png
+func (g *Game) snapshot() (any, error) {
+	dir := "."
+	if g.state != nil && g.state.Dir != "" {
+		dir = g.state.Dir
+	}
+	base := filepath.Join(dir, fmt.Sprintf("snapshot_%06d", g.ctl.Steps()))
+	if err := writeNPY(base+".npy", fieldArray(g.A), false); err != nil {
+		return nil, err
+	}
+	pal := builtinPalettes[0]
+	if g.palettes != nil {
+		pal = g.palettes.Current()
+	}
+	if err := writePNG(base+".png", renderField(g.A, pal, cellSize)); err != nil {
+		return nil, err
+	}
+	return map[string]string{"npy": base + ".npy", "png": base + ".png"}, nil
+}
+
+// reseed restarts the field and the measurements observing it
+func (g *Game) reseed() (any, error) {
+	seedPattern(g.A, rand.New(rand.NewSource(time.Now().UnixNano())))
+	if g.img != nil && g.state != nil {
+		if err := g.seedField(g.img, g.state); err != nil {
+			return nil, err
+		}
+	}
+	if g.classifier != nil {
+		g.classifier.Reset()
+	}
+	if g.tracker != nil && !g.tracker.Recording() {
+		g.tracker.Reset()
+	}
+	if g.lyap != nil {
+		g.startLyapunov(rand.New(rand.NewSource(time.Now().UnixNano())))
+	}
+	return map[string]any{"mass": fieldMass(g.A)}, nil
+}
+
+// controlStats is the record published to control clients
+func (g *Game) controlStats() map[string]any {
+	st := map[string]any{"mu": g.mu, "sigma": g.sigma, "dt": g.dt, "R": g.R, "mass": fieldMass(g.A)}
+	if g.classifier != nil {
+		c := g.classifier.Result()
+		st["outcome"], st["period"], st["creatures"] = c.Outcome.String(), c.Period, c.Creatures
+	}
+	if g.showTracks || (g.tracker != nil && g.tracker.Recording()) {
+		st["tracked"] = len(g.tracker.Blobs)
+	}
+	if g.lyap != nil && g.lyap.Renorms > 0 && !g.lyap.Collapsed {
+		st["lyapunov"] = g.lyap.Exponent
+	}
+	if g.lastFPS > 0 {
+		st["fps"] = g.lastFPS
+	}
+	return st
+}
+
+// fieldMass is the mean activity per cell
+func fieldMass(A [][]float64) float64 {
+	var sum float64
+	for _, row := range A {
+		for _, v := range row {
+			sum += v
+		}
+	}
+	return sum / float64(gridW*gridH)
+}
+
+// ---------- Lyapunov exponent ----------
+// startLyapunov starts a twin of the current field, perturbed by fieldD0 in a direction
+// drawn from rng
+func (g *Game) startLyapunov(rng *rand.Rand) {
+	g.twin = &Game{
+		A:      newLattice(gridH, gridW),
+		Anext:  newLattice(gridH, gridW),
+		kernel: g.kernel,
+		Knorm:  g.Knorm,
+		R:      g.R,
+	}
+	perturbField(g.twin.A, g.A, fieldD0, rng)
+	g.lyap = newLyapunov(fieldD0, g.dt, lyapunovEvery)
+}
+
+// stepTwin advances the twin with the current parameters after a step of the field
+func (g *Game) stepTwin() {
+	t := g.twin
+	t.mu, t.sigma, t.dt = g.mu, g.sigma, g.dt
+	t.step()
+	g.lyap.Advance(func() float64 { return fieldDistance(t.A, g.A) },
+		func(f float64) { fieldRescale(t.A, g.A, f) })
+}
+
+// ---------- Creature tracks ----------
+func (g *Game) toggleTrackExport() {
+	if g.tracker.Recording() {
+		if err := g.tracker.StopCSV(); err != nil {
+			log.Printf("track export: %v", err)
+		}
+		log.Printf("track export stopped: %s, %s", tracksCSVPath, eventsCSVPath)
+		return
+	}
+	if err := g.tracker.StartCSV(tracksCSVPath, eventsCSVPath); err != nil {
+		log.Printf("track export: %v", err)
+		return
+	}
+	log.Printf("track export started: %s, %s", tracksCSVPath, eventsCSVPath)
+}
+
+// trackColor gives every track ID a stable hue
+func trackColor(id int) color.NRGBA {
+	h := math.Mod(float64(id)*0.618033*360, 360)
+	x := 1 - math.Abs(math.Mod(h/60, 2)-1)
+	var r, gg, b float64
+	switch {
+	case h < 60:
+		r, gg = 1, x
+	case h < 120:
+		r, gg = x, 1
+	case h < 180:
+		gg, b = 1, x
+	case h < 240:
+		gg, b = x, 1
+	case h < 300:
+		r, b = x, 1
+	default:
+		r, b = 1, x
+	}
+	return color.NRGBA{R: uint8(80 + 175*r), G: uint8(80 + 175*gg), B: uint8(80 + 175*b), A: 0xff}
+}
+
+// drawTracks outlines every blob with its bounding box, major axis and ID, and draws the
+// recent centroid trail, broken where it wraps around an edge
+func (g *Game) drawTracks(screen *ebiten.Image) {
+	const cs = float32(cellSize)
+	for id, trail := range g.tracker.Trails {
+		c := trackColor(id)
+		for i := 1; i < len(trail); i++ {
+			a, b := trail[i-1], trail[i]
+			if math.Abs(b.CX-a.CX) > gridW/2 || math.Abs(b.CY-a.CY) > gridH/2 {
+				continue
+			}
+			vector.StrokeLine(screen, float32(a.CX)*cs, float32(a.CY)*cs, float32(b.CX)*cs, float32(b.CY)*cs, 1, c, true)
+		}
+	}
+	for _, b := range g.tracker.Blobs {
+		c := trackColor(b.ID)
+		vector.StrokeRect(screen, float32(b.BX)*cs, float32(b.BY)*cs, float32(b.BW)*cs, float32(b.BH)*cs, 1, c, false)
+		cx, cy := float32(b.CX)*cs, float32(b.CY)*cs
+		l := float32(math.Max(float64(b.BW), float64(b.BH))) * cs / 2
+		dx, dy := float32(math.Cos(b.Angle))*l, float32(math.Sin(b.Angle))*l
+		vector.StrokeLine(screen, cx-dx, cy-dy, cx+dx, cy+dy, 1, c, true)
+		text.Draw(screen, fmt.Sprintf("#%d", b.ID), basicfont.Face7x13, int(cx)+4, int(cy)-4, c)
+	}
 }
 
 func (g *Game) Layout(outW, outH int) (int, int) {
 	return gridW * cellSize, gridH * cellSize
 }
 
-// ---------- simple color ramp mapping ----------
-// ---- Color map ----
-func colorRamp(v float64) (r, g, b uint8) {
-	v = clamp(v, 0, 1)
-	if v < 0.5 {
-		t := v / 0.5
-		return uint8(20 + 50*t), uint8(50 + 150*t), uint8(200 - 100*t)
+// ---------- Parameter sweep ----------
+// runParameterSweep simulates every grid point of spec for the given number of steps
+// from the same initial pattern, with the other parameters fixed at base, and writes
+// out+".csv" and out+".png"
+func runParameterSweep(spec string, base Params, steps, workers int, lyapunov bool, out string) {
+	xa, ya, err := parseSweep(spec, sweepParams)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("sweep %s × %s: %d runs of %d steps on %d workers", xa.Param, ya.Param, xa.N*ya.N, steps, workers)
+	cells := runSweep(xa, ya, workers, func(c *SweepCell) {
+		p := base
+		p.set(xa.Param, c.X)
+		p.set(ya.Param, c.Y)
+		classifyRun(p, steps, lyapunov, c)
+	})
+	if err := writeSweepCSV(out+".csv", xa, ya, cells); err != nil {
+		log.Fatal(err)
+	}
+	if err := writeSweepPNG(out+".png", xa, ya, cells); err != nil {
+		log.Fatal(err)
+	}
+	counts := map[Outcome]int{}
+	for _, c := range cells {
+		counts[c.Result.Outcome]++
+	}
+	for o := range outcomeNames {
+		if n := counts[Outcome(o)]; n > 0 {
+			log.Printf("  %-14s %d", Outcome(o), n)
+		}
+	}
+	log.Printf("sweep written to %s.csv and %s.png", out, out)
+}
+
+// classifyRun simulates one headless run into cell, classifies it and, if lyapunov is
+// set, estimates its Lyapunov exponent from a perturbed twin. Extinct runs stop early,
+// since an empty field stays empty.
+func classifyRun(p Params, steps int, lyapunov bool, cell *SweepCell) {
+	g := newSimulation(p, rand.New(rand.NewSource(sweepSeed)))
+	c := newClassifier(gridW, gridH)
+	if lyapunov {
+		g.startLyapunov(rand.New(rand.NewSource(sweepSeed)))
+	}
+	cell.Steps = steps
+	for s := 1; s <= steps; s++ {
+		g.step()
+		c.Observe(g.A)
+		if g.lyap != nil {
+			g.stepTwin()
+		}
+		if c.Result().Outcome == Extinct {
+			cell.Steps = s
+			break
+		}
+	}
+	cell.Result = c.Result()
+	if g.lyap != nil {
+		cell.Lyapunov = g.lyap.Exponent
 	}
-	t := (v - 0.5) / 0.5
-	return uint8(70 + 180*t), uint8(200 - 80*t), uint8(100 + 150*t)
 }
 
 // ---------- main ----------
 func main() {
+	mu := flag.Float64("mu", muDefault, "μ of the growth mapping")
+	sigma := flag.Float64("sigma", sigDefault, "σ of the growth mapping")
+	dt := flag.Float64("dt", dtDefault, "time step Δt")
+	R := flag.Float64("R", radius, "kernel radius in cells")
+	sweepSpec := flag.String("sweep", "", "headless phase diagram over two parameters, param=min:max:n,param=min:max:n (params: mu, sigma, dt, R; the others stay at their flag values)")
+	steps := flag.Int("steps", 400, "simulation steps per sweep or headless run (0 with -headless -control runs until stopped)")
+	workers := flag.Int("workers", runtime.NumCPU(), "parallel sweep runs")
+	lyapunov := flag.Bool("lyapunov", false, "also estimate the Lyapunov exponent of every sweep run (doubles the cost)")
+	out := flag.String("out", "sweep", "sweep output prefix, writes <out>.csv and <out>.png")
+	headless := flag.Bool("headless", false, "simulate -steps steps without a window (needs -record, -gif, -dump or -control)")
+	paletteSpec := flag.String("palette", "classic", "colormap: classic, viridis, magma, inferno, cividis, twilight, greyscale or a gradient file")
+	rec := newRecorderFlags()
+	state := newStateIOFlags()
+	img := newImageSeedFlags()
+	ctl := newControlFlags()
+	flag.Parse()
+	if state.Load != "" && img.Enabled() {
+		log.Fatal("-load and -image both set the starting field, use one")
+	}
+
+	palettes, err := newPaletteCycle(*paletteSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	params := Params{Mu: *mu, Sigma: *sigma, Dt: *dt, R: *R}
+	if *sweepSpec != "" {
+		runParameterSweep(*sweepSpec, params, *steps, *workers, *lyapunov, *out)
+		return
+	}
+	if *headless {
+		runHeadless(params, *steps, rec, state, img, palettes.Current(), ctl)
+		return
+	}
+	if rec.MaxFrames > 0 {
+		if err := rec.Start(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	ebiten.SetWindowSize(gridW*cellSize, gridH*cellSize)
 	ebiten.SetWindowTitle("Lenia-like Artificial Cell (Ebiten)")
 
-	game := NewGame()
+	game := NewGame(params)
+	game.rec = rec
+	game.palettes = palettes
+	game.state = state
+	game.img = img
+	game.ctl = ctl
+	if err := game.seedField(img, state); err != nil {
+		log.Fatal(err)
+	}
+	if err := game.startControl(); err != nil {
+		log.Fatal(err)
+	}
+	defer ctl.Close()
 
 	if err := ebiten.RunGame(game); err != nil {
 		log.Fatal(err)
 	}
+	// closing the window ends a recording that is still running
+	if err := rec.Stop(); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,270 @@
+// palette.go
+//
+// Colormaps for Lenia fields: the classic blue-green-pink ramp, the perceptually uniform
+// viridis, magma, inferno and cividis (cividis is also safe for red-green colour
+// blindness), the cyclic twilight and greyscale. Further palettes are read from gradient
+// files, and a PaletteCycle switches between them at runtime.
+// Example flags: -palette viridis.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	paletteLUTSize = 1024 // precomputed colours per palette
+	colorBiasShift = 0.08 // field offset per unit of a genome's ColorBias
+)
+
+// Palette maps field values in [0, 1] to colours
+type Palette struct {
+	Name   string
+	Cyclic bool // values wrap around instead of being clamped, e.g. for phases
+
+	lut [paletteLUTSize][3]uint8
+}
+
+// PaletteStop is a colour at a position of a gradient
+type PaletteStop struct {
+	Pos     float64
+	R, G, B uint8
+}
+
+// newPalette interpolates the stops, sorted by position, linearly in RGB. Positions are
+// rescaled so the first stop is at 0 and the last at 1.
+func newPalette(name string, cyclic bool, stops []PaletteStop) *Palette {
+	p := &Palette{Name: name, Cyclic: cyclic}
+	lo, hi := stops[0].Pos, stops[len(stops)-1].Pos
+	k := 0
+	for i := range p.lut {
+		v := lo + (hi-lo)*float64(i)/float64(paletteLUTSize-1)
+		for k < len(stops)-2 && v > stops[k+1].Pos {
+			k++
+		}
+		a, b := stops[k], stops[k+1]
+		t := 0.0
+		if b.Pos > a.Pos {
+			t = math.Max(0, math.Min(1, (v-a.Pos)/(b.Pos-a.Pos)))
+		}
+		mix := func(x, y uint8) uint8 { return uint8(math.Round(float64(x) + t*(float64(y)-float64(x)))) }
+		p.lut[i] = [3]uint8{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B)}
+	}
+	return p
+}
+
+// At is the colour of v. Values outside [0, 1] are clamped, or wrapped for cyclic palettes.
+func (p *Palette) At(v float64) (r, g, b uint8) {
+	if p.Cyclic {
+		v -= math.Floor(v)
+	} else {
+		v = math.Max(0, math.Min(1, v))
+	}
+	c := p.lut[int(v*(paletteLUTSize-1)+0.5)]
+	return c[0], c[1], c[2]
+}
+
+// Biased is the colour of v shifted by a genome's ColorBias. The shift is the same for
+// every palette, so a genome keeps its look relative to the others when switching.
+func (p *Palette) Biased(v, bias float64) (r, g, b uint8) {
+	return p.At(v + bias*colorBiasShift)
+}
+
+// ---------- Built-in palettes ----------
+// evenStops spreads "#rrggbb" colours evenly over [0, 1]
+func evenStops(hex ...string) []PaletteStop {
+	stops := make([]PaletteStop, len(hex))
+	for i, h := range hex {
+		r, g, b, err := parseHexColor(h)
+		if err != nil {
+			panic(err)
+		}
+		stops[i] = PaletteStop{float64(i) / float64(len(hex)-1), r, g, b}
+	}
+	return stops
+}
+
+// builtinPalettes lists the palettes in the order the palette key cycles through them.
+// The scientific maps are matplotlib's, sampled at eleven points.
+var builtinPalettes = []*Palette{
+	newPalette("classic", false, []PaletteStop{{0, 20, 50, 200}, {0.5, 70, 200, 100}, {1, 250, 120, 250}}),
+	newPalette("viridis", false, evenStops("#440154", "#482475", "#414487", "#355f8d", "#2a788e", "#21918c", "#22a884", "#44bf70", "#7ad151", "#bddf26", "#fde725")),
+	newPalette("magma", false, evenStops("#000004", "#140e36", "#3b0f70", "#641a80", "#8c2981", "#b73779", "#de4968", "#f7705c", "#fe9f6d", "#fecf92", "#fcfdbf")),
+	newPalette("inferno", false, evenStops("#000004", "#160b39", "#420a68", "#6a176e", "#932667", "#bc3754", "#dd513a", "#f37819", "#fca50a", "#f6d746", "#fcffa4")),
+	newPalette("cividis", false, evenStops("#00224e", "#123570", "#3b496c", "#575d6d", "#707173", "#8a8779", "#a69d75", "#c4b56c", "#e4cf5b", "#f6e14f", "#fee838")),
+	newPalette("twilight", true, evenStops("#e2d9e2", "#a6bfd0", "#7496c5", "#6163b7", "#5a3496", "#2f1436", "#6e1f57", "#a33c4f", "#c46b5a", "#d6a38f", "#e2d9e2")),
+	newPalette("greyscale", false, evenStops("#000000", "#ffffff")),
+}
+
+// findPalette returns the built-in palette called name, or loads name as a gradient file
+func findPalette(name string) (*Palette, error) {
+	for _, p := range builtinPalettes {
+		if strings.EqualFold(p.Name, name) {
+			return p, nil
+		}
+	}
+	if _, err := os.Stat(name); err != nil {
+		names := make([]string, len(builtinPalettes))
+		for i, p := range builtinPalettes {
+			names[i] = p.Name
+		}
+		return nil, fmt.Errorf("palette %q: neither a gradient file nor one of %s", name, strings.Join(names, ", "))
+	}
+	return loadPalette(name)
+}
+
+// ---------- Gradient files ----------
+// loadPalette reads a gradient file: one stop per line as "position #rrggbb" or
+// "position r g b" with positions ascending, a line "cyclic" for a cyclic palette, and
+// lines starting with # as comments. The palette is named after the file.
+//
+//	# sunset
+//	0    #1a0533
+//	0.6  230 80 40
+//	1    #ffe9a8
+func loadPalette(path string) (*Palette, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var stops []PaletteStop
+	cyclic := false
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Fields(sc.Text())
+		switch {
+		case len(fields) == 0 || strings.HasPrefix(fields[0], "#"):
+			continue
+		case len(fields) == 1 && fields[0] == "cyclic":
+			cyclic = true
+			continue
+		}
+		s, err := parseStop(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		if len(stops) > 0 && s.Pos < stops[len(stops)-1].Pos {
+			return nil, fmt.Errorf("%s:%d: positions must ascend", path, line)
+		}
+		stops = append(stops, s)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(stops) < 2 || stops[0].Pos == stops[len(stops)-1].Pos {
+		return nil, fmt.Errorf("%s: need at least two stops at different positions", path)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return newPalette(name, cyclic, stops), nil
+}
+
+func parseStop(fields []string) (PaletteStop, error) {
+	var s PaletteStop
+	pos, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return s, fmt.Errorf("bad position %q", fields[0])
+	}
+	s.Pos = pos
+	switch len(fields) {
+	case 2:
+		s.R, s.G, s.B, err = parseHexColor(fields[1])
+		return s, err
+	case 4:
+		var c [3]uint8
+		for i, f := range fields[1:] {
+			v, err := strconv.ParseUint(f, 10, 8)
+			if err != nil {
+				return s, fmt.Errorf("bad colour component %q", f)
+			}
+			c[i] = uint8(v)
+		}
+		s.R, s.G, s.B = c[0], c[1], c[2]
+		return s, nil
+	}
+	return s, fmt.Errorf("want \"position #rrggbb\" or \"position r g b\"")
+}
+
+func parseHexColor(h string) (r, g, b uint8, err error) {
+	if len(h) != 7 || h[0] != '#' {
+		return 0, 0, 0, fmt.Errorf("bad colour %q, want #rrggbb", h)
+	}
+	v, err := strconv.ParseUint(h[1:], 16, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("bad colour %q, want #rrggbb", h)
+	}
+	return uint8(v >> 16), uint8(v >> 8), uint8(v), nil
+}
+
+// ---------- Runtime switching ----------
+// PaletteCycle is the built-in palettes plus a loaded gradient, switched with a key
+type PaletteCycle struct {
+	list []*Palette
+	i    int
+}
+
+// newPaletteCycle starts at the palette named by spec, a built-in name or a gradient
+// file; a file is added to the cycle after the built-ins
+func newPaletteCycle(spec string) (*PaletteCycle, error) {
+	p, err := findPalette(spec)
+	if err != nil {
+		return nil, err
+	}
+	c := &PaletteCycle{list: append([]*Palette(nil), builtinPalettes...)}
+	for i, q := range c.list {
+		if q == p {
+			c.i = i
+			return c, nil
+		}
+	}
+	c.list = append(c.list, p)
+	c.i = len(c.list) - 1
+	return c, nil
+}
+
+// Current is the palette in use
+func (c *PaletteCycle) Current() *Palette { return c.list[c.i] }
+
+// Next switches to the following palette and returns it
+func (c *PaletteCycle) Next() *Palette {
+	c.i = (c.i + 1) % len(c.list)
+	return c.list[c.i]
+}
+
+// ---------- HSV ----------
+// hsvToRGB converts a hue in degrees (wrapped into [0, 360)), saturation and value to
+// RGB components in [0, v]
+func hsvToRGB(h, s, v float64) (r, g, b float64) {
+	h = math.Mod(math.Mod(h, 360)+360, 360)
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := v - c
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return r + m, g + m, b + m
+}
+
+// hsvToHex is the "#RRGGBB" of an HSV colour, as canvas fill styles take it; saturation
+// and value are clamped to [0, 1]
+func hsvToHex(h, s, v float64) string {
+	r, g, b := hsvToRGB(h, math.Max(0, math.Min(1, s)), math.Max(0, math.Min(1, v)))
+	return fmt.Sprintf("#%02X%02X%02X", int(r*255), int(g*255), int(b*255))
+}
@@ -0,0 +1,289 @@
+// poster.go
+//
+// Offline poster rendering for the particle art programs: the simulation runs headless at
+// its usual world size while every step is splatted into a floating-point (HDR)
+// accumulation buffer at an arbitrary output resolution. Particles are drawn as
+// anti-aliased discs by supersampling their edge pixels, and their light adds up into
+// long-exposure trails (or fading ones with -poster-decay). At the end the buffer is tone
+// mapped and written as an 8- or 16-bit PNG for print.
+// The buffer holds 12 bytes per output pixel, so 4320×5760 needs about 300 MB.
+// Example flags: -poster poster.png -poster-width 4320 -poster-steps 1500.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"math"
+	"os"
+	"sort"
+)
+
+const (
+	posterRenorm      = 1e6  // the decay weight is folded into the buffer when it grows past this
+	posterAutoPercent = 99.5 // auto exposure maps this percentile of lit pixels to white
+	posterLogRange    = 64.0 // input value the log operator maps to 1
+)
+
+// Poster accumulates particle light at print resolution
+type Poster struct {
+	Path     string  // output PNG, "" for no poster
+	Width    int     // output width in pixels; the height follows the world's aspect ratio
+	Steps    int     // simulation steps to accumulate
+	SS       int     // subsamples per axis for disc edges
+	Decay    float64 // fraction of the trail light lost per step, 0 for a long exposure
+	Exposure float64 // multiplier before tone mapping, 0 for automatic
+	Tone     string  // tone mapping operator: aces, reinhard or log
+	Deep     bool    // write 16 bits per channel
+
+	w, h   int
+	scale  float64   // output pixels per world unit
+	buf    []float32 // linear RGB, 3 per pixel
+	weight float64   // weight of light added now relative to the buffer, grows with decay
+	step   int
+}
+
+// newPosterFlags registers the poster flags and returns the Poster they fill in once
+// flag.Parse has run
+func newPosterFlags() *Poster {
+	p := &Poster{}
+	flag.StringVar(&p.Path, "poster", "", "render headless into this PNG instead of opening a window")
+	flag.IntVar(&p.Width, "poster-width", 4320, "poster width in pixels")
+	flag.IntVar(&p.Steps, "poster-steps", 1000, "simulation steps accumulated into the poster")
+	flag.IntVar(&p.SS, "poster-ss", 4, "supersampling per axis for anti-aliased particle edges")
+	flag.Float64Var(&p.Decay, "poster-decay", 0, "trail fade per step like the on-screen trails, 0 keeps all light")
+	flag.Float64Var(&p.Exposure, "poster-exposure", 0, "exposure multiplier, 0 for automatic")
+	flag.StringVar(&p.Tone, "poster-tone", "aces", "tone mapping: aces, reinhard or log")
+	flag.BoolVar(&p.Deep, "poster-16bit", false, "write a 16-bit PNG")
+	return p
+}
+
+// Enabled reports whether a poster was asked for
+func (p *Poster) Enabled() bool { return p.Path != "" }
+
+// Begin allocates the buffer for a worldW×worldH world
+func (p *Poster) Begin(worldW, worldH float64) error {
+	switch p.Tone {
+	case "aces", "reinhard", "log":
+	default:
+		return fmt.Errorf("poster tone %q, want aces, reinhard or log", p.Tone)
+	}
+	if p.Width < 1 || p.Steps < 1 {
+		return fmt.Errorf("poster needs a positive -poster-width and -poster-steps")
+	}
+	if p.SS < 1 {
+		p.SS = 1
+	}
+	p.scale = float64(p.Width) / worldW
+	p.w, p.h = p.Width, int(math.Round(worldH*p.scale))
+	p.buf = make([]float32, 3*p.w*p.h)
+	p.weight, p.step = 1, 0
+	log.Printf("poster %dx%d, %d steps", p.w, p.h, p.Steps)
+	return nil
+}
+
+// Done reports whether all steps have been accumulated
+func (p *Poster) Done() bool { return p.step >= p.Steps }
+
+// Splat adds a particle of diameter size at world position x, y (its top-left corner, as
+// drawn on screen) with a hue in degrees and brightness v
+func (p *Poster) Splat(x, y, size, hue, v float64) {
+	c := posterColor(hue, v)
+	r := size * p.scale / 2
+	cx, cy := (x+size/2)*p.scale, (y+size/2)*p.scale
+	// a disc smaller than a pixel keeps its total light, spread over one pixel's area
+	gain := float32(p.weight)
+	if r < 0.5 {
+		gain *= float32(math.Pi * r * r / (math.Pi * 0.25))
+		r = 0.5
+	}
+	x0, x1 := int(math.Floor(cx-r)), int(math.Ceil(cx+r))
+	y0, y1 := int(math.Floor(cy-r)), int(math.Ceil(cy+r))
+	if x0 < 0 {
+		x0 = 0
+	}
+	if y0 < 0 {
+		y0 = 0
+	}
+	if x1 > p.w {
+		x1 = p.w
+	}
+	if y1 > p.h {
+		y1 = p.h
+	}
+	inner, outer := r-math.Sqrt2/2, r+math.Sqrt2/2
+	for py := y0; py < y1; py++ {
+		for px := x0; px < x1; px++ {
+			d := math.Hypot(float64(px)+0.5-cx, float64(py)+0.5-cy)
+			var cov float64
+			switch {
+			case d <= inner:
+				cov = 1
+			case d >= outer:
+				continue
+			default:
+				cov = p.coverage(float64(px)-cx, float64(py)-cy, r)
+			}
+			k := cov * float64(gain)
+			i := 3 * (py*p.w + px)
+			p.buf[i] += float32(k) * c[0]
+			p.buf[i+1] += float32(k) * c[1]
+			p.buf[i+2] += float32(k) * c[2]
+		}
+	}
+}
+
+// coverage is the fraction of the pixel at offset dx, dy from the disc centre inside it
+func (p *Poster) coverage(dx, dy, r float64) float64 {
+	in := 0
+	for sy := 0; sy < p.SS; sy++ {
+		oy := dy + (float64(sy)+0.5)/float64(p.SS)
+		for sx := 0; sx < p.SS; sx++ {
+			ox := dx + (float64(sx)+0.5)/float64(p.SS)
+			if ox*ox+oy*oy <= r*r {
+				in++
+			}
+		}
+	}
+	return float64(in) / float64(p.SS*p.SS)
+}
+
+// Step ends a simulation step. With decay, older light is dimmed by weighting new light
+// more, which saves a pass over the buffer every step.
+func (p *Poster) Step() {
+	p.step++
+	if p.step%(p.Steps/10+1) == 0 {
+		log.Printf("poster step %d/%d", p.step, p.Steps)
+	}
+	if p.Decay <= 0 {
+		return
+	}
+	p.weight /= 1 - p.Decay
+	if p.weight > posterRenorm {
+		p.fold()
+	}
+}
+
+// fold scales the buffer to the current weight so light is added at weight 1 again
+func (p *Poster) fold() {
+	k := float32(1 / p.weight)
+	for i := range p.buf {
+		p.buf[i] *= k
+	}
+	p.weight = 1
+}
+
+// ---------- Tone mapping ----------
+// Write tone maps the buffer and writes the PNG
+func (p *Poster) Write() error {
+	p.fold()
+	exposure := p.Exposure
+	if exposure <= 0 {
+		exposure = p.autoExposure()
+	}
+	var img image.Image
+	var set func(x, y int, c [3]float64)
+	if p.Deep {
+		m := image.NewRGBA64(image.Rect(0, 0, p.w, p.h))
+		set = func(x, y int, c [3]float64) {
+			m.SetRGBA64(x, y, color.RGBA64{uint16(c[0]*0xffff + 0.5), uint16(c[1]*0xffff + 0.5), uint16(c[2]*0xffff + 0.5), 0xffff})
+		}
+		img = m
+	} else {
+		m := image.NewRGBA(image.Rect(0, 0, p.w, p.h))
+		set = func(x, y int, c [3]float64) {
+			m.SetRGBA(x, y, color.RGBA{uint8(c[0]*0xff + 0.5), uint8(c[1]*0xff + 0.5), uint8(c[2]*0xff + 0.5), 0xff})
+		}
+		img = m
+	}
+	for y := 0; y < p.h; y++ {
+		for x := 0; x < p.w; x++ {
+			i := 3 * (y*p.w + x)
+			var c [3]float64
+			for k := range c {
+				c[k] = srgbEncode(p.toneMap(float64(p.buf[i+k]) * exposure))
+			}
+			set(x, y, c)
+		}
+	}
+	f, err := os.Create(p.Path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	log.Printf("wrote %s (exposure %.3g, %s)", p.Path, exposure, p.Tone)
+	return f.Close()
+}
+
+// autoExposure maps a high percentile of the lit pixels' brightest channel to near white, so a
+// few hot spots where many trails cross saturate instead of darkening the whole poster
+func (p *Poster) autoExposure() float64 {
+	var lit []float32
+	stride := len(p.buf)/3/(1<<20) + 1 // a sample of about a million pixels is enough
+	for i := 0; i < len(p.buf); i += 3 * stride {
+		m := p.buf[i]
+		if p.buf[i+1] > m {
+			m = p.buf[i+1]
+		}
+		if p.buf[i+2] > m {
+			m = p.buf[i+2]
+		}
+		if m > 0 {
+			lit = append(lit, m)
+		}
+	}
+	if len(lit) == 0 {
+		return 1
+	}
+	sort.Slice(lit, func(i, j int) bool { return lit[i] < lit[j] })
+	white := float64(lit[int(float64(len(lit)-1)*posterAutoPercent/100)])
+	// the operators reach 1 only asymptotically; place white where they give about 0.9
+	switch p.Tone {
+	case "reinhard":
+		return 9 / white
+	case "log":
+		return (math.Exp(0.9*math.Log(1+posterLogRange)) - 1) / white
+	}
+	return 2.5 / white
+}
+
+// toneMap compresses linear light in [0, ∞) to [0, 1]
+func (p *Poster) toneMap(v float64) float64 {
+	switch p.Tone {
+	case "reinhard":
+		v = v / (1 + v)
+	case "log":
+		v = math.Log(1+v) / math.Log(1+posterLogRange)
+	default:
+		// Narkowicz's fit of the ACES filmic curve
+		v = (v * (2.51*v + 0.03)) / (v*(2.43*v+0.59) + 0.14)
+	}
+	return math.Max(0, math.Min(1, v))
+}
+
+// ---------- Colour ----------
+// posterColor is the linear RGB of a fully saturated sRGB hue at brightness v
+func posterColor(h, v float64) [3]float32 {
+	r, g, b := hsvToRGB(h, 1, v)
+	return [3]float32{float32(srgbDecode(r)), float32(srgbDecode(g)), float32(srgbDecode(b))}
+}
+
+func srgbDecode(c float64) float64 {
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func srgbEncode(c float64) float64 {
+	if c <= 0.0031308 {
+		return c * 12.92
+	}
+	return 1.055*math.Pow(c, 1/2.4) - 0.055
+}
@@ -1,6 +1,8 @@
+// run: go run ras.main.go svgtrail.go poster.go palette.go
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"math"
@@ -30,6 +32,12 @@ type Particle struct {
 	BaseHue float64
 }
 
+// Color is the particle's hue in degrees and brightness, shifting smoothly with its speed
+func (p *Particle) Color() (hue, val float64) {
+	speed := math.Sqrt(p.VX*p.VX + p.VY*p.VY)
+	return math.Mod(p.BaseHue+speed*90, 360), 0.6 + 0.4*(speed/MaxSpeed)
+}
+
 // ---------------- Simulation ----------------
 type Simulation struct {
 	Particles []*Particle
@@ -58,31 +66,6 @@ func NewSimulation(cv *canvas.Canvas) *Simulation {
 	return sim
 }
 
-// ---------------- Color Conversion ----------------
-func HSVtoHex(h, s, v float64) string {
-	h = math.Mod(h, 360)
-	c := v * s
-	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
-	m := v - c
-	var r, g, b float64
-
-	switch {
-	case h < 60:
-		r, g, b = c, x, 0
-	case h < 120:
-		r, g, b = x, c, 0
-	case h < 180:
-		r, g, b = 0, c, x
-	case h < 240:
-		r, g, b = 0, x, c
-	case h < 300:
-		r, g, b = x, 0, c
-	default:
-		r, g, b = c, 0, x
-	}
-	return fmt.Sprintf("#%02X%02X%02X", int((r+m)*255), int((g+m)*255), int((b+m)*255))
-}
-
 // ---------------- Simulation Step ----------------
 func (sim *Simulation) Update() {
 	for _, p := range sim.Particles {
@@ -116,6 +99,18 @@ func (sim *Simulation) Update() {
 	}
 }
 
+// RecordTrails adds the particles' positions to a running SVG capture
+func (sim *Simulation) RecordTrails(svg *TrailSVG) {
+	if !svg.Recording() {
+		return
+	}
+	for i, p := range sim.Particles {
+		hue, val := p.Color()
+		svg.Add(i, p.X, p.Y, hue, val)
+	}
+	svg.Step()
+}
+
 // ---------------- Drawing ----------------
 func (sim *Simulation) Draw() {
 	cv := sim.Canvas
@@ -126,30 +121,71 @@ func (sim *Simulation) Draw() {
 
 	// Draw each particle
 	for _, p := range sim.Particles {
-		speed := math.Sqrt(p.VX*p.VX + p.VY*p.VY)
-		hue := math.Mod(p.BaseHue+speed*90, 360) // Smooth color transition
-		color := HSVtoHex(hue, 1, 0.6+0.4*(speed/MaxSpeed))
-		cv.SetFillStyle(color)
+		hue, val := p.Color()
+		cv.SetFillStyle(hsvToHex(hue, 1, val))
 		cv.FillRect(p.X, p.Y, p.Size, p.Size)
 	}
 }
 
+// ---------------- Poster ----------------
+// RenderPoster runs the simulation headless and accumulates every step into the poster
+func (sim *Simulation) RenderPoster(pst *Poster) error {
+	if err := pst.Begin(Width, Height); err != nil {
+		return err
+	}
+	for !pst.Done() {
+		sim.Update()
+		for _, p := range sim.Particles {
+			hue, val := p.Color()
+			pst.Splat(p.X, p.Y, p.Size, hue, val)
+		}
+		pst.Step()
+	}
+	return pst.Write()
+}
+
 // ---------------- Main ----------------
 func main() {
+	svg := newTrailSVGFlags()
+	pst := newPosterFlags()
+	flag.Parse()
+
+	rand.Seed(time.Now().UnixNano())
+
+	// -poster renders a still without opening a window
+	if pst.Enabled() {
+		if err := NewSimulation(nil).RenderPoster(pst); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	wnd, cv, err := sdlcanvas.CreateWindow(Width, Height, "Perlin Cosmic Swirl")
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	rand.Seed(time.Now().UnixNano())
 	sim := NewSimulation(cv)
 
+	// V captures the particle trails as SVG; with -svg the first capture starts at once
+	if svg.Path != "" {
+		svg.Start(len(sim.Particles), Width, Height)
+	}
+	wnd.KeyDown = func(scancode int, rn rune, name string) {
+		if rn == 'v' {
+			svg.Toggle(len(sim.Particles), Width, Height)
+		}
+	}
+
 	wnd.MainLoop(func() {
 
 		sim.Update()
+		sim.RecordTrails(svg)
 		sim.Draw()
 
 		// FPS display
 
 	})
+	if err := svg.Stop(); err != nil {
+		log.Printf("svg: %v", err)
+	}
 }
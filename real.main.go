@@ -1,3 +1,4 @@
+// run: go run real.main.go palette.go
 package main
 
 import (
@@ -29,34 +30,6 @@ func randomY() float64 {
 	return (rand.Float64() * (float64(cv.Height()) - padding*2)) + padding
 }
 
-// --------- HSV to HEX Conversion ---------
-func hsvToHex(h, s, v float64) string {
-	h = math.Mod(h, 360)
-	c := v * s
-	x := c * (1 - math.Abs(math.Mod(h/60.0, 2)-1))
-	m := v - c
-	var r, g, b float64
-
-	switch {
-	case 0 <= h && h < 60:
-		r, g, b = c, x, 0
-	case 60 <= h && h < 120:
-		r, g, b = x, c, 0
-	case 120 <= h && h < 180:
-		r, g, b = 0, c, x
-	case 180 <= h && h < 240:
-		r, g, b = 0, x, c
-	case 240 <= h && h < 300:
-		r, g, b = x, 0, c
-	default:
-		r, g, b = c, 0, x
-	}
-	R := int((r + m) * 255)
-	G := int((g + m) * 255)
-	B := int((b + m) * 255)
-	return fmt.Sprintf("#%02X%02X%02X", R, G, B)
-}
-
 // --------- Dynamic Color (velocity + density) ---------
 type cluster struct {
 	particles []*particle
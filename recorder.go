@@ -0,0 +1,275 @@
+// recorder.go
+//
+// Frame recording for sharing runs: every Nth frame a program offers is written as a
+// numbered PNG and/or collected into an animated GIF. Every GIF frame is dithered onto its
+// own median-cut palette (a local colour table), so colours that only appear later in a
+// run are not lost. GIF frames are kept in memory until the recording stops, so their
+// number is capped by -gif-frames; a GIF-only recording stops when the cap is reached.
+// Example flags: -gif swirl.gif -record-every 2 -record-frames 300 -gif-frames 300.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	recordPaletteSize  = 256     // GIF colours per frame
+	recordPaletteProbe = 1 << 16 // pixels sampled for a frame's palette
+	recordGIFFrames    = 250     // default cap on the GIF frames kept in memory
+)
+
+// Recorder captures frames while recording is active
+type Recorder struct {
+	Dir       string // PNG sequence directory, "" for no sequence
+	GIFPath   string // animated GIF path, "" for no GIF
+	Every     int    // record every Nth offered frame
+	MaxFrames int    // record this many frames from launch, then finish (batch runs); 0 for hotkey use
+	GIFScale  int    // GIF frames are downscaled by this factor
+	GIFFrames int    // most GIF frames kept; a PNG sequence goes on past it, a GIF alone stops
+	Delay     int    // GIF frame delay in 1/100 s
+
+	active  bool
+	done    bool
+	offered int
+	count   int
+	frames  []*image.Paletted
+}
+
+// newRecorderFlags registers the recording flags and returns the recorder they fill in
+// once flag.Parse has run
+func newRecorderFlags() *Recorder {
+	r := &Recorder{}
+	flag.StringVar(&r.Dir, "record", "", "directory for a PNG frame sequence while recording")
+	flag.StringVar(&r.GIFPath, "gif", "", "animated GIF written when recording stops")
+	flag.IntVar(&r.Every, "record-every", 2, "record every Nth frame")
+	flag.IntVar(&r.MaxFrames, "record-frames", 0, "record this many frames from launch, then write the files and exit")
+	flag.IntVar(&r.GIFScale, "gif-scale", 2, "downscale factor of GIF frames")
+	flag.IntVar(&r.GIFFrames, "gif-frames", recordGIFFrames, "most frames in the GIF (each is held in memory until recording stops)")
+	flag.IntVar(&r.Delay, "gif-delay", 4, "GIF frame delay in 1/100 s")
+	return r
+}
+
+// Enabled reports whether any output is configured
+func (r *Recorder) Enabled() bool { return r.Dir != "" || r.GIFPath != "" }
+
+// Recording reports whether frames are being captured
+func (r *Recorder) Recording() bool { return r.active }
+
+// Done reports whether a MaxFrames recording has finished and its files are written
+func (r *Recorder) Done() bool { return r.done }
+
+// Frames is the number of frames captured so far
+func (r *Recorder) Frames() int { return r.count }
+
+// Start begins a new recording
+func (r *Recorder) Start() error {
+	if !r.Enabled() {
+		return fmt.Errorf("recording needs -record or -gif")
+	}
+	if r.Dir != "" {
+		if err := os.MkdirAll(r.Dir, 0o755); err != nil {
+			return err
+		}
+	}
+	if r.Every < 1 {
+		r.Every = 1
+	}
+	if r.GIFScale < 1 {
+		r.GIFScale = 1
+	}
+	if r.GIFFrames < 1 {
+		r.GIFFrames = recordGIFFrames
+	}
+	r.active, r.offered, r.count = true, 0, 0
+	r.frames = nil
+	log.Printf("recording started (every %d frames)", r.Every)
+	return nil
+}
+
+// Stop ends the recording and writes the GIF
+func (r *Recorder) Stop() error {
+	if !r.active {
+		return nil
+	}
+	r.active = false
+	if r.Dir != "" {
+		log.Printf("recorded %d frames to %s", r.count, r.Dir)
+	}
+	if r.GIFPath == "" || len(r.frames) == 0 {
+		return nil
+	}
+	anim := &gif.GIF{Image: r.frames, Delay: make([]int, len(r.frames))}
+	for i := range anim.Delay {
+		anim.Delay[i] = r.Delay
+	}
+	f, err := os.Create(r.GIFPath)
+	if err != nil {
+		return err
+	}
+	if err := gif.EncodeAll(f, anim); err != nil {
+		f.Close()
+		return err
+	}
+	r.frames = nil
+	log.Printf("wrote %s (%d frames)", r.GIFPath, len(anim.Image))
+	return f.Close()
+}
+
+// Toggle starts or stops recording, logging failures
+func (r *Recorder) Toggle() {
+	var err error
+	if r.active {
+		err = r.Stop()
+	} else {
+		err = r.Start()
+	}
+	if err != nil {
+		log.Printf("recorder: %v", err)
+	}
+}
+
+// Next counts an offered frame and reports whether it should be captured, so programs
+// only read back the pixels they need
+func (r *Recorder) Next() bool {
+	if !r.active {
+		return false
+	}
+	r.offered++
+	return (r.offered-1)%r.Every == 0
+}
+
+// Capture records img. When MaxFrames is reached, or the GIF is full and there is no PNG
+// sequence, the recording stops and Done turns true for a MaxFrames recording.
+func (r *Recorder) Capture(img image.Image) error {
+	r.count++
+	if r.Dir != "" {
+		if err := writePNG(filepath.Join(r.Dir, fmt.Sprintf("frame_%05d.png", r.count)), img); err != nil {
+			return err
+		}
+	}
+	if r.GIFPath != "" && len(r.frames) < r.GIFFrames {
+		src := downscale(img, r.GIFScale)
+		frame := image.NewPaletted(src.Bounds(), medianCut(src, recordPaletteSize))
+		draw.FloydSteinberg.Draw(frame, frame.Bounds(), src, src.Bounds().Min)
+		r.frames = append(r.frames, frame)
+		if len(r.frames) == r.GIFFrames && (r.MaxFrames == 0 || r.count < r.MaxFrames) {
+			if r.Dir == "" {
+				log.Printf("recorder: GIF is full at %d frames, stopping (raise -gif-frames for more)", r.GIFFrames)
+				r.done = r.MaxFrames > 0
+				return r.Stop()
+			}
+			log.Printf("recorder: GIF is full at %d frames, the PNG sequence goes on", r.GIFFrames)
+		}
+	}
+	if r.MaxFrames > 0 && r.count >= r.MaxFrames {
+		r.done = true
+		return r.Stop()
+	}
+	return nil
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// downscale averages s×s blocks
+func downscale(img image.Image, s int) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx()/s, b.Dy()/s))
+	for y := 0; y < out.Rect.Dy(); y++ {
+		for x := 0; x < out.Rect.Dx(); x++ {
+			var sr, sg, sb uint32
+			for dy := 0; dy < s; dy++ {
+				for dx := 0; dx < s; dx++ {
+					cr, cg, cb, _ := img.At(b.Min.X+x*s+dx, b.Min.Y+y*s+dy).RGBA()
+					sr += cr >> 8
+					sg += cg >> 8
+					sb += cb >> 8
+				}
+			}
+			n := uint32(s * s)
+			out.SetRGBA(x, y, color.RGBA{uint8(sr / n), uint8(sg / n), uint8(sb / n), 0xff})
+		}
+	}
+	return out
+}
+
+// medianCut builds a palette of up to n colours: the sampled pixels are split at the
+// median of the widest channel of the widest box until there are n boxes, and each box
+// contributes its mean colour
+func medianCut(img image.Image, n int) color.Palette {
+	b := img.Bounds()
+	step := 1
+	for (b.Dx()/step)*(b.Dy()/step) > recordPaletteProbe {
+		step++
+	}
+	var px [][3]uint8
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			cr, cg, cb, _ := img.At(x, y).RGBA()
+			px = append(px, [3]uint8{uint8(cr >> 8), uint8(cg >> 8), uint8(cb >> 8)})
+		}
+	}
+	boxes := [][][3]uint8{px}
+	for len(boxes) < n {
+		// widest box and channel
+		bi, ch, width := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			for c := 0; c < 3; c++ {
+				lo, hi := box[0][c], box[0][c]
+				for _, p := range box {
+					if p[c] < lo {
+						lo = p[c]
+					}
+					if p[c] > hi {
+						hi = p[c]
+					}
+				}
+				if int(hi-lo) > width {
+					bi, ch, width = i, c, int(hi-lo)
+				}
+			}
+		}
+		if bi < 0 {
+			break // every box holds a single colour
+		}
+		box := boxes[bi]
+		sort.Slice(box, func(i, j int) bool { return box[i][ch] < box[j][ch] })
+		mid := len(box) / 2
+		boxes[bi] = box[:mid]
+		boxes = append(boxes, box[mid:])
+	}
+	pal := make(color.Palette, 0, len(boxes))
+	for _, box := range boxes {
+		var sr, sg, sb int
+		for _, p := range box {
+			sr += int(p[0])
+			sg += int(p[1])
+			sb += int(p[2])
+		}
+		k := len(box)
+		pal = append(pal, color.RGBA{uint8(sr / k), uint8(sg / k), uint8(sb / k), 0xff})
+	}
+	return pal
+}
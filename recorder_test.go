@@ -0,0 +1,145 @@
+// test: go test recorder_test.go recorder.go
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func solidImage(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+// a colour that first appears in a late frame keeps its exact value in the GIF
+func TestRecorderGIFLateColours(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.gif")
+	r := &Recorder{GIFPath: path, Every: 1, MaxFrames: 3, GIFScale: 1, Delay: 4}
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	colours := []color.RGBA{{0, 0, 0, 0xff}, {20, 50, 200, 0xff}, {250, 120, 250, 0xff}}
+	for _, c := range colours {
+		if err := r.Capture(solidImage(16, 8, c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !r.Done() {
+		t.Fatal("recording did not finish after MaxFrames")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	anim, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != len(colours) {
+		t.Fatalf("%d frames, want %d", len(anim.Image), len(colours))
+	}
+	for i, frame := range anim.Image {
+		got := color.RGBAModel.Convert(frame.At(3, 3)).(color.RGBA)
+		if got != colours[i] {
+			t.Errorf("frame %d: pixel %v, want %v", i, got, colours[i])
+		}
+	}
+}
+
+func TestMedianCut(t *testing.T) {
+	red, blue := color.RGBA{255, 0, 0, 0xff}, color.RGBA{0, 0, 255, 0xff}
+	halves := solidImage(64, 32, red)
+	for y := 16; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			halves.SetRGBA(x, y, blue)
+		}
+	}
+	grey := image.NewRGBA(image.Rect(0, 0, 256, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 256; x++ {
+			grey.SetRGBA(x, y, color.RGBA{uint8(x), uint8(x), uint8(x), 0xff})
+		}
+	}
+	big := image.NewRGBA(image.Rect(0, 0, 600, 600)) // more pixels than recordPaletteProbe
+	for y := 0; y < 600; y++ {
+		for x := 0; x < 600; x++ {
+			big.SetRGBA(x, y, color.RGBA{uint8(x * 255 / 599), uint8(y * 255 / 599), 128, 0xff})
+		}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		img     image.Image
+		n       int
+		size    int     // palette length
+		maxDist float64 // largest channel distance from a pixel to its palette colour
+	}{
+		{"one colour", solidImage(8, 8, red), 256, 1, 0},
+		{"two colours", halves, 256, 2, 0},
+		{"two colours, one slot", halves, 1, 1, 128},
+		{"grey ramp", grey, 16, 16, 8},
+		{"grey ramp, all levels", grey, 256, 256, 0},
+		{"sampled", big, 64, 64, 24},
+	} {
+		pal := medianCut(tc.img, tc.n)
+		if len(pal) != tc.size {
+			t.Errorf("%s: %d colours, want %d", tc.name, len(pal), tc.size)
+		}
+		b := tc.img.Bounds()
+		worst := 0.0
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := color.RGBAModel.Convert(tc.img.At(x, y)).(color.RGBA)
+				p := pal[pal.Index(c)].(color.RGBA)
+				for _, d := range []float64{float64(c.R) - float64(p.R), float64(c.G) - float64(p.G), float64(c.B) - float64(p.B)} {
+					if d < 0 {
+						d = -d
+					}
+					if d > worst {
+						worst = d
+					}
+				}
+			}
+		}
+		if worst > tc.maxDist {
+			t.Errorf("%s: a pixel is %g from its palette colour, want at most %g", tc.name, worst, tc.maxDist)
+		}
+	}
+}
+
+// a GIF-only recording stops, and a batch one finishes, once the GIF is full
+func TestRecorderGIFFull(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "full.gif")
+	r := &Recorder{GIFPath: path, Every: 1, MaxFrames: 5, GIFScale: 1, GIFFrames: 2, Delay: 4}
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := r.Capture(solidImage(8, 8, color.RGBA{uint8(i * 100), 0, 0, 0xff})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r.Recording() || !r.Done() {
+		t.Fatalf("recording %v, done %v after filling the GIF, want stopped and done", r.Recording(), r.Done())
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	anim, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 2 {
+		t.Errorf("%d frames, want 2", len(anim.Image))
+	}
+}
@@ -0,0 +1,124 @@
+// render.go
+//
+// Fast field rendering for the ebiten programs: field values are mapped through a
+// 256-entry colour table into a reusable RGBA buffer, split across cores for large grids,
+// and the buffer is uploaded with a single WritePixels instead of one Set call per cell.
+// FrameTimer keeps smoothed frame and render times for the HUD.
+// It needs palette.go.
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	renderLUTSize       = 256     // field levels of the colour table
+	renderParallelCells = 1 << 16 // grids with at least this many cells are filled on all cores
+	frameTimeSmoothing  = 0.05    // weight of the newest frame in the smoothed times
+)
+
+// FieldPixels is the RGBA image of a field, ready for ebiten's WritePixels
+type FieldPixels struct {
+	W, H int
+	Pix  []byte // row-major RGBA, 4 bytes per cell
+
+	lut     [renderLUTSize][4]byte
+	lutPal  *Palette
+	lutBias float64
+}
+
+func newFieldPixels(w, h int) *FieldPixels {
+	return &FieldPixels{W: w, H: h, Pix: make([]byte, 4*w*h)}
+}
+
+// Fill colours A with pal shifted by bias. The colour table is rebuilt only when the
+// palette or the bias changed since the last call.
+func (f *FieldPixels) Fill(A [][]float64, pal *Palette, bias float64) {
+	if pal != f.lutPal || bias != f.lutBias {
+		for i := range f.lut {
+			r, g, b := pal.Biased(float64(i)/(renderLUTSize-1), bias)
+			f.lut[i] = [4]byte{r, g, b, 0xff}
+		}
+		f.lutPal, f.lutBias = pal, bias
+	}
+	if f.W*f.H < renderParallelCells {
+		f.fillRows(A, 0, f.H)
+		return
+	}
+	n := runtime.NumCPU()
+	rows := (f.H + n - 1) / n
+	var wg sync.WaitGroup
+	for y0 := 0; y0 < f.H; y0 += rows {
+		y1 := y0 + rows
+		if y1 > f.H {
+			y1 = f.H
+		}
+		wg.Add(1)
+		go func(y0, y1 int) {
+			defer wg.Done()
+			f.fillRows(A, y0, y1)
+		}(y0, y1)
+	}
+	wg.Wait()
+}
+
+func (f *FieldPixels) fillRows(A [][]float64, y0, y1 int) {
+	for y := y0; y < y1; y++ {
+		row := f.Pix[4*y*f.W : 4*(y+1)*f.W]
+		for x, v := range A[y][:f.W] {
+			i := int(v*(renderLUTSize-1) + 0.5)
+			if i < 0 {
+				i = 0
+			} else if i >= renderLUTSize {
+				i = renderLUTSize - 1
+			}
+			copy(row[4*x:4*x+4], f.lut[i][:])
+		}
+	}
+}
+
+// SetRGB overwrites one cell, e.g. for overlays coloured differently from the field
+func (f *FieldPixels) SetRGB(x, y int, r, g, b uint8) {
+	i := 4 * (y*f.W + x)
+	f.Pix[i], f.Pix[i+1], f.Pix[i+2], f.Pix[i+3] = r, g, b, 0xff
+}
+
+// ---------- Frame timing ----------
+// FrameTimer smooths the time between frames and the time spent rendering the field
+type FrameTimer struct {
+	Frame  float64 // ms between Begin calls
+	Render float64 // ms from Begin to End
+
+	last time.Time
+}
+
+// Begin marks the start of rendering a frame and returns the time to pass to End
+func (t *FrameTimer) Begin() time.Time {
+	now := time.Now()
+	if !t.last.IsZero() {
+		t.Frame = smoothMs(t.Frame, now.Sub(t.last))
+	}
+	t.last = now
+	return now
+}
+
+// End marks the end of rendering the frame begun at start
+func (t *FrameTimer) End(start time.Time) {
+	t.Render = smoothMs(t.Render, time.Since(start))
+}
+
+func smoothMs(avg float64, d time.Duration) float64 {
+	ms := float64(d) / float64(time.Millisecond)
+	if avg == 0 {
+		return ms
+	}
+	return avg + frameTimeSmoothing*(ms-avg)
+}
+
+// String is a HUD line
+func (t *FrameTimer) String() string {
+	return fmt.Sprintf("frame %.1f ms  render %.2f ms", t.Frame, t.Render)
+}
@@ -0,0 +1,267 @@
+// svgtrail.go
+//
+// Vector export of particle trails for pen plotters and vector editors: while capturing,
+// every particle's path is recorded for a number of steps, split where it wraps around
+// the torus, simplified with Ramer–Douglas–Peucker and written as SVG polylines coloured
+// by the particle's mean hue. With -svg-pens the hues are quantised to a few pens and each
+// pen gets its own layer, so a plotter can draw one colour at a time.
+// Example flags: -svg flow.svg -svg-steps 600 -svg-pens 4.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TrailSVG records particle paths and writes them as SVG
+type TrailSVG struct {
+	Path       string  // output file; the first capture starts at launch if set
+	Steps      int     // steps per capture
+	Epsilon    float64 // simplification tolerance in pixels, 0 keeps every point
+	Stroke     float64 // stroke width in pixels
+	Pens       int     // quantise hues to this many pens, 0 for the continuous colours
+	Background string  // background fill, "" for none (paper)
+
+	active   bool
+	step     int
+	captures int
+	w, h     float64
+	paths    [][]trailPoint
+}
+
+type trailPoint struct {
+	X, Y, Hue, Val float32
+}
+
+// newTrailSVGFlags registers the SVG flags and returns the TrailSVG they fill in once
+// flag.Parse has run
+func newTrailSVGFlags() *TrailSVG {
+	s := &TrailSVG{}
+	flag.StringVar(&s.Path, "svg", "", "capture particle trails from launch and write them to this SVG file")
+	flag.IntVar(&s.Steps, "svg-steps", 400, "simulation steps per SVG capture")
+	flag.Float64Var(&s.Epsilon, "svg-epsilon", 0.75, "path simplification tolerance in pixels")
+	flag.Float64Var(&s.Stroke, "svg-stroke", 0.6, "SVG stroke width in pixels")
+	flag.IntVar(&s.Pens, "svg-pens", 0, "quantise trail colours to this many pens, one layer each (0 for continuous colours)")
+	flag.StringVar(&s.Background, "svg-background", "", "SVG background colour, e.g. #000000 (none by default, for plotting)")
+	return s
+}
+
+// Recording reports whether paths are being captured
+func (s *TrailSVG) Recording() bool { return s.active }
+
+// Start begins capturing n particle paths on a w×h torus
+func (s *TrailSVG) Start(n int, w, h float64) {
+	if s.Steps < 2 {
+		s.Steps = 2
+	}
+	s.active, s.step, s.w, s.h = true, 0, w, h
+	s.paths = make([][]trailPoint, n)
+	for i := range s.paths {
+		s.paths[i] = make([]trailPoint, 0, s.Steps)
+	}
+	s.captures++
+	log.Printf("capturing trails for %d steps", s.Steps)
+}
+
+// Stop ends the capture and writes the SVG
+func (s *TrailSVG) Stop() error {
+	if !s.active {
+		return nil
+	}
+	s.active = false
+	path := s.outPath()
+	err := s.write(path)
+	s.paths = nil
+	return err
+}
+
+// Toggle starts or stops a capture, logging failures
+func (s *TrailSVG) Toggle(n int, w, h float64) {
+	if s.active {
+		if err := s.Stop(); err != nil {
+			log.Printf("svg: %v", err)
+		}
+		return
+	}
+	s.Start(n, w, h)
+}
+
+// Add records the position of particle i in the current step, with its hue in degrees
+// and brightness in [0, 1]
+func (s *TrailSVG) Add(i int, x, y, hue, val float64) {
+	if s.active && i < len(s.paths) {
+		s.paths[i] = append(s.paths[i], trailPoint{float32(x), float32(y), float32(hue), float32(val)})
+	}
+}
+
+// Step ends a simulation step; after Steps steps the capture stops and is written
+func (s *TrailSVG) Step() {
+	if !s.active {
+		return
+	}
+	s.step++
+	if s.step >= s.Steps {
+		if err := s.Stop(); err != nil {
+			log.Printf("svg: %v", err)
+		}
+	}
+}
+
+// outPath is Path, or trails.svg without one; later captures are numbered
+func (s *TrailSVG) outPath() string {
+	path := s.Path
+	if path == "" {
+		path = "trails.svg"
+	}
+	if s.captures > 1 {
+		ext := filepath.Ext(path)
+		path = fmt.Sprintf("%s_%03d%s", strings.TrimSuffix(path, ext), s.captures, ext)
+	}
+	return path
+}
+
+// ---------- Paths ----------
+// splitWraps cuts a path where it jumps across the edge of the torus
+func (s *TrailSVG) splitWraps(p []trailPoint) [][]trailPoint {
+	var out [][]trailPoint
+	start := 0
+	for i := 1; i < len(p); i++ {
+		if math.Abs(float64(p[i].X-p[i-1].X)) > s.w/2 || math.Abs(float64(p[i].Y-p[i-1].Y)) > s.h/2 {
+			out = append(out, p[start:i])
+			start = i
+		}
+	}
+	return append(out, p[start:])
+}
+
+// simplifyRDP keeps the points of p that deviate more than eps from the chord between
+// the points kept around them (Ramer–Douglas–Peucker)
+func simplifyRDP(p []trailPoint, eps float64) []trailPoint {
+	if len(p) < 3 || eps <= 0 {
+		return p
+	}
+	keep := make([]bool, len(p))
+	keep[0], keep[len(p)-1] = true, true
+	stack := [][2]int{{0, len(p) - 1}}
+	for len(stack) > 0 {
+		a, b := stack[len(stack)-1][0], stack[len(stack)-1][1]
+		stack = stack[:len(stack)-1]
+		ax, ay := float64(p[a].X), float64(p[a].Y)
+		dx, dy := float64(p[b].X)-ax, float64(p[b].Y)-ay
+		l := math.Hypot(dx, dy)
+		far, farD := -1, eps
+		for i := a + 1; i < b; i++ {
+			px, py := float64(p[i].X)-ax, float64(p[i].Y)-ay
+			d := math.Hypot(px, py)
+			if l > 0 {
+				d = math.Abs(px*dy-py*dx) / l
+			}
+			if d > farD {
+				far, farD = i, d
+			}
+		}
+		if far >= 0 {
+			keep[far] = true
+			stack = append(stack, [2]int{a, far}, [2]int{far, b})
+		}
+	}
+	out := make([]trailPoint, 0, len(p)/4+2)
+	for i, k := range keep {
+		if k {
+			out = append(out, p[i])
+		}
+	}
+	return out
+}
+
+// meanColor is the circular mean hue and the mean brightness along p
+func meanColor(p []trailPoint) (hue, val float64) {
+	var sx, sy float64
+	for _, q := range p {
+		a := float64(q.Hue) * math.Pi / 180
+		sx += math.Cos(a)
+		sy += math.Sin(a)
+		val += float64(q.Val)
+	}
+	hue = math.Mod(math.Atan2(sy, sx)*180/math.Pi+360, 360)
+	return hue, val / float64(len(p))
+}
+
+// ---------- Output ----------
+// write simplifies the captured paths and writes them to path
+func (s *TrailSVG) write(path string) error {
+	// polylines per layer: one layer per pen, or a single one with per-line colours
+	layers := 1
+	if s.Pens > 0 {
+		layers = s.Pens
+	}
+	lines := make([][]string, layers)
+	points, kept := 0, 0
+	for _, p := range s.paths {
+		for _, seg := range s.splitWraps(p) {
+			if len(seg) < 2 {
+				continue
+			}
+			hue, val := meanColor(seg)
+			simple := simplifyRDP(seg, s.Epsilon)
+			points += len(seg)
+			kept += len(simple)
+
+			var b strings.Builder
+			b.WriteString(`<polyline points="`)
+			for i, q := range simple {
+				if i > 0 {
+					b.WriteByte(' ')
+				}
+				fmt.Fprintf(&b, "%.1f,%.1f", q.X, q.Y)
+			}
+			b.WriteByte('"')
+			layer := 0
+			if s.Pens > 0 {
+				layer = int(math.Round(hue/360*float64(s.Pens))) % s.Pens
+			} else {
+				fmt.Fprintf(&b, ` stroke="%s"`, hsvToHex(hue, 1, val))
+			}
+			b.WriteString("/>")
+			lines[layer] = append(lines[layer], b.String())
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape" width="%g" height="%g" viewBox="0 0 %g %g">
+`, s.w, s.h, s.w, s.h)
+	if s.Background != "" {
+		fmt.Fprintf(w, "<rect width=\"100%%\" height=\"100%%\" fill=\"%s\"/>\n", s.Background)
+	}
+	for i, ls := range lines {
+		attrs := ""
+		if s.Pens > 0 {
+			attrs = fmt.Sprintf(` id="pen-%d" inkscape:label="pen %d" inkscape:groupmode="layer" stroke="%s"`,
+				i+1, i+1, hsvToHex(float64(i)*360/float64(s.Pens), 1, 1))
+		}
+		fmt.Fprintf(w, "<g%s fill=\"none\" stroke-width=\"%g\" stroke-linecap=\"round\" stroke-linejoin=\"round\">\n", attrs, s.Stroke)
+		for _, l := range ls {
+			w.WriteString(l)
+			w.WriteByte('\n')
+		}
+		w.WriteString("</g>\n")
+	}
+	w.WriteString("</svg>\n")
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	log.Printf("wrote %s (%d steps, %d of %d points kept)", path, s.step, kept, points)
+	return f.Close()
+}
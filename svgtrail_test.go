@@ -0,0 +1,85 @@
+// test: go test svgtrail_test.go svgtrail.go palette.go
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func pts(xy ...float32) []trailPoint {
+	p := make([]trailPoint, len(xy)/2)
+	for i := range p {
+		p[i] = trailPoint{X: xy[2*i], Y: xy[2*i+1]}
+	}
+	return p
+}
+
+func TestSimplifyRDP(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   []trailPoint
+		eps  float64
+		want []trailPoint
+	}{
+		{"empty", nil, 1, nil},
+		{"two points", pts(0, 0, 5, 5), 1, pts(0, 0, 5, 5)},
+		{"straight line", pts(0, 0, 1, 0, 2, 0, 3, 0, 4, 0), 0.5, pts(0, 0, 4, 0)},
+		{"small wobble", pts(0, 0, 1, 0.2, 2, -0.2, 3, 0.1, 4, 0), 0.5, pts(0, 0, 4, 0)},
+		{"corner", pts(0, 0, 1, 0, 2, 0, 2, 1, 2, 2), 0.5, pts(0, 0, 2, 0, 2, 2)},
+		{"zigzag", pts(0, 0, 1, 2, 2, 0, 3, 2, 4, 0), 0.5, pts(0, 0, 1, 2, 2, 0, 3, 2, 4, 0)},
+		{"zero epsilon", pts(0, 0, 1, 0, 2, 0), 0, pts(0, 0, 1, 0, 2, 0)},
+		{"closed loop", pts(0, 0, 3, 0, 3, 3, 0, 0), 0.5, pts(0, 0, 3, 0, 3, 3, 0, 0)},
+	} {
+		got := simplifyRDP(tc.in, tc.eps)
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+				break
+			}
+		}
+	}
+}
+
+// every dropped point of a random walk lies within eps of the simplified polyline
+func TestSimplifyRDPTolerance(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	walk := make([]trailPoint, 2000)
+	for i := 1; i < len(walk); i++ {
+		walk[i] = trailPoint{X: walk[i-1].X + float32(rng.NormFloat64()), Y: walk[i-1].Y + float32(rng.NormFloat64())}
+	}
+	const eps = 0.75
+	simple := simplifyRDP(walk, eps)
+	if len(simple) >= len(walk) || simple[0] != walk[0] || simple[len(simple)-1] != walk[len(walk)-1] {
+		t.Fatalf("kept %d of %d points, endpoints %v %v", len(simple), len(walk), simple[0], simple[len(simple)-1])
+	}
+	j := 0
+	for _, p := range walk {
+		if p == simple[j] {
+			if j < len(simple)-1 {
+				j++
+			}
+			continue
+		}
+		a, b := simple[j-1], simple[j]
+		if d := segmentDistance(p, a, b); d > eps+1e-6 {
+			t.Fatalf("point %v is %g from segment %v-%v, more than %g", p, d, a, b, eps)
+		}
+	}
+}
+
+func segmentDistance(p, a, b trailPoint) float64 {
+	ax, ay := float64(a.X), float64(a.Y)
+	dx, dy := float64(b.X)-ax, float64(b.Y)-ay
+	px, py := float64(p.X)-ax, float64(p.Y)-ay
+	l := math.Hypot(dx, dy)
+	if l == 0 {
+		return math.Hypot(px, py)
+	}
+	// RDP measures the distance to the chord's line, not the clamped segment
+	return math.Abs(px*dy-py*dx) / l
+}
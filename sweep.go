@@ -0,0 +1,212 @@
+// sweep.go
+//
+// Headless parameter sweeps: a grid over two parameters is simulated cell by cell on all
+// cores, each run is labelled by the outcome classifier, and the results are written as
+// a CSV table and a coloured phase diagram PNG.
+// It needs classify.go and tracking.go. Example flags: -sweep mu=0.1:0.4:24,sigma=0.01:0.1:24.
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// SweepAxis is one swept parameter with N evenly spaced values from Min to Max
+type SweepAxis struct {
+	Param    string
+	Min, Max float64
+	N        int
+}
+
+// Value is the parameter value of grid index i
+func (a SweepAxis) Value(i int) float64 {
+	if a.N < 2 {
+		return a.Min
+	}
+	return a.Min + (a.Max-a.Min)*float64(i)/float64(a.N-1)
+}
+
+// parseSweep reads "param=min:max:n,param=min:max:n" for two of the given parameters
+func parseSweep(spec string, params []string) (x, y SweepAxis, err error) {
+	parts := strings.Split(spec, ",")
+	if len(parts) != 2 {
+		return x, y, fmt.Errorf("sweep %q: want two axes param=min:max:n,param=min:max:n", spec)
+	}
+	var axes [2]SweepAxis
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		eq := strings.Index(part, "=")
+		if eq < 0 {
+			return x, y, fmt.Errorf("sweep axis %q: want param=min:max:n", part)
+		}
+		name := strings.TrimSpace(part[:eq])
+		known := false
+		for _, p := range params {
+			known = known || p == name
+		}
+		if !known {
+			return x, y, fmt.Errorf("sweep axis %q: unknown parameter (have %s)", name, strings.Join(params, ", "))
+		}
+		f := strings.Split(part[eq+1:], ":")
+		if len(f) != 3 {
+			return x, y, fmt.Errorf("sweep axis %q: want min:max:n", part)
+		}
+		a := SweepAxis{Param: name}
+		if a.Min, err = strconv.ParseFloat(f[0], 64); err != nil {
+			return x, y, fmt.Errorf("sweep axis %q: %v", part, err)
+		}
+		if a.Max, err = strconv.ParseFloat(f[1], 64); err != nil {
+			return x, y, fmt.Errorf("sweep axis %q: %v", part, err)
+		}
+		if a.N, err = strconv.Atoi(f[2]); err != nil || a.N < 1 {
+			return x, y, fmt.Errorf("sweep axis %q: bad count %q", part, f[2])
+		}
+		axes[i] = a
+	}
+	if axes[0].Param == axes[1].Param {
+		return x, y, fmt.Errorf("sweep %q: both axes sweep %s", spec, axes[0].Param)
+	}
+	return axes[0], axes[1], nil
+}
+
+// SweepCell is the result of one grid point
+type SweepCell struct {
+	I, J     int // x and y index
+	X, Y     float64
+	Result   Classification
+	Steps    int     // steps simulated, fewer than requested when the run died early
+	Lyapunov float64 // largest Lyapunov exponent, NaN when not measured
+}
+
+// SweepRun simulates the grid point c.X, c.Y and fills in the rest of c
+type SweepRun func(c *SweepCell)
+
+// runSweep evaluates every grid point with the given number of workers and returns the
+// cells in row-major order (x fastest)
+func runSweep(xa, ya SweepAxis, workers int, run SweepRun) []SweepCell {
+	if workers < 1 {
+		workers = 1
+	}
+	cells := make([]SweepCell, xa.N*ya.N)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+	start := time.Now()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range jobs {
+				c := &cells[k]
+				c.I, c.J = k%xa.N, k/xa.N
+				c.X, c.Y = xa.Value(c.I), ya.Value(c.J)
+				c.Lyapunov = math.NaN()
+				run(c)
+
+				mu.Lock()
+				done++
+				if done%xa.N == 0 || done == len(cells) {
+					log.Printf("sweep: %d/%d cells (%s)", done, len(cells), time.Since(start).Round(time.Second))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for k := range cells {
+		jobs <- k
+	}
+	close(jobs)
+	wg.Wait()
+	return cells
+}
+
+// ---------- Output ----------
+var outcomeColors = [...]color.NRGBA{
+	Undetermined:  {128, 128, 128, 255},
+	Extinct:       {20, 20, 24, 255},
+	Saturated:     {240, 236, 220, 255},
+	Static:        {60, 100, 210, 255},
+	Oscillator:    {60, 180, 100, 255},
+	Glider:        {245, 160, 40, 255},
+	Chaotic:       {210, 50, 60, 255},
+	MultiCreature: {160, 90, 210, 255},
+}
+
+// writeSweepCSV writes one row per grid point
+func writeSweepCSV(path string, xa, ya SweepAxis, cells []SweepCell) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(f, "%s,%s,outcome,period,speed,creatures,mean_mass,steps,lyapunov\n", xa.Param, ya.Param)
+	for _, c := range cells {
+		r := c.Result
+		fmt.Fprintf(f, "%.6g,%.6g,%s,%d,%.4f,%d,%.5f,%d,%.5g\n", c.X, c.Y, r.Outcome, r.Period, r.Speed, r.Creatures, r.MeanMass, c.Steps, c.Lyapunov)
+	}
+	return f.Close()
+}
+
+// writeSweepPNG draws the phase diagram with the y axis pointing up, axis labels and a
+// legend of the outcomes
+func writeSweepPNG(path string, xa, ya SweepAxis, cells []SweepCell) error {
+	const cellPx, left, bottom, top, legendW = 12, 70, 40, 16, 140
+	plotW, plotH := xa.N*cellPx, ya.N*cellPx
+	height := top + plotH + bottom
+	if legend := top + len(outcomeColors)*18 + bottom; legend > height {
+		height = legend
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, left+plotW+legendW, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{255, 255, 255, 255}), image.Point{}, draw.Src)
+	for _, c := range cells {
+		x0 := left + c.I*cellPx
+		y0 := top + (ya.N-1-c.J)*cellPx
+		r := image.Rect(x0, y0, x0+cellPx, y0+cellPx)
+		draw.Draw(img, r, image.NewUniform(outcomeColors[c.Result.Outcome]), image.Point{}, draw.Src)
+	}
+
+	d := &font.Drawer{Dst: img, Src: image.NewUniform(color.Black), Face: basicfont.Face7x13}
+	label := func(s string, x, y int) {
+		d.Dot = fixed.P(x, y)
+		d.DrawString(s)
+	}
+	right := func(s string, x, y int) { label(s, x-d.MeasureString(s).Round(), y) }
+	base := top + plotH
+	label(fmt.Sprintf("%.4g", xa.Min), left, base+14)
+	right(fmt.Sprintf("%.4g", xa.Max), left+plotW, base+14)
+	label(xa.Param, left+plotW/2-d.MeasureString(xa.Param).Round()/2, base+30)
+	right(fmt.Sprintf("%.4g", ya.Max), left-4, top+10)
+	right(fmt.Sprintf("%.4g", ya.Min), left-4, base)
+	right(ya.Param, left-4, top+plotH/2+4)
+
+	for o := range outcomeColors {
+		y := top + o*18
+		x := left + plotW + 12
+		draw.Draw(img, image.Rect(x, y, x+12, y+12), image.NewUniform(outcomeColors[o]), image.Point{}, draw.Src)
+		label(Outcome(o).String(), x+18, y+11)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
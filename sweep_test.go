@@ -0,0 +1,61 @@
+// test: go test sweep_test.go sweep.go classify.go tracking.go
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSweep(t *testing.T) {
+	params := []string{"mu", "sigma", "dt", "R"}
+	for _, tc := range []struct {
+		spec   string
+		x, y   SweepAxis
+		errMsg string // substring of the expected error, "" for success
+	}{
+		{"mu=0.1:0.4:24,sigma=0.01:0.1:12", SweepAxis{"mu", 0.1, 0.4, 24}, SweepAxis{"sigma", 0.01, 0.1, 12}, ""},
+		{" dt=0.5:0.05:3 , R=4:16:1", SweepAxis{"dt", 0.5, 0.05, 3}, SweepAxis{"R", 4, 16, 1}, ""},
+		{"mu=0.1:0.4:24", SweepAxis{}, SweepAxis{}, "want two axes"},
+		{"mu=0.1:0.4:2,sigma=0:1:2,dt=0:1:2", SweepAxis{}, SweepAxis{}, "want two axes"},
+		{"mu:0.1:0.4:2,sigma=0:1:2", SweepAxis{}, SweepAxis{}, "want param=min:max:n"},
+		{"kappa=0:1:2,sigma=0:1:2", SweepAxis{}, SweepAxis{}, "unknown parameter"},
+		{"mu=0:1,sigma=0:1:2", SweepAxis{}, SweepAxis{}, "want min:max:n"},
+		{"mu=a:1:2,sigma=0:1:2", SweepAxis{}, SweepAxis{}, "invalid syntax"},
+		{"mu=0:1:0,sigma=0:1:2", SweepAxis{}, SweepAxis{}, "bad count"},
+		{"mu=0:1:2.5,sigma=0:1:2", SweepAxis{}, SweepAxis{}, "bad count"},
+		{"mu=0:1:2,mu=0:1:3", SweepAxis{}, SweepAxis{}, "both axes sweep mu"},
+	} {
+		x, y, err := parseSweep(tc.spec, params)
+		if tc.errMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.errMsg) {
+				t.Errorf("%q: error %v, want one containing %q", tc.spec, err, tc.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.spec, err)
+			continue
+		}
+		if x != tc.x || y != tc.y {
+			t.Errorf("%q: axes %+v %+v, want %+v %+v", tc.spec, x, y, tc.x, tc.y)
+		}
+	}
+}
+
+func TestSweepAxisValue(t *testing.T) {
+	for _, tc := range []struct {
+		axis SweepAxis
+		i    int
+		want float64
+	}{
+		{SweepAxis{"mu", 0.1, 0.4, 4}, 0, 0.1},
+		{SweepAxis{"mu", 0.1, 0.4, 4}, 3, 0.4},
+		{SweepAxis{"mu", 0.1, 0.4, 4}, 1, 0.2},
+		{SweepAxis{"dt", 1, 0, 3}, 1, 0.5},
+		{SweepAxis{"R", 7, 9, 1}, 0, 7},
+	} {
+		if got := tc.axis.Value(tc.i); got < tc.want-1e-12 || got > tc.want+1e-12 {
+			t.Errorf("%+v.Value(%d) = %g, want %g", tc.axis, tc.i, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+// tracking.go
+//
+// Creature segmentation and tracking on a toroidal Lenia field: connected components
+// above a threshold become blobs with mass, centroid, bounding box and orientation, and
+// blobs are matched frame to frame so their IDs persist. Births, deaths, splits and
+// merges are recorded as events.
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+const (
+	trackThreshold = 0.1 // cells above this belong to a creature
+	trackMinCells  = 6   // smaller components are ignored as debris
+	trackMaxJump   = 8.0 // extra matching distance, in cells, beyond a blob's own radius
+	trackTrailLen  = 120 // centroid history kept per track for drawing
+)
+
+// Blob is one connected creature in one frame
+type Blob struct {
+	ID     int
+	Parent int // ID of the blob it split from, 0 if none
+	Age    int // frames since the track started
+
+	Cells  int
+	Mass   float64
+	CX, CY float64 // mass centroid, wrapped into the grid
+
+	// bounding box around the centroid; X, Y may be negative or the box may extend past
+	// the grid edge when the blob straddles the wrap-around
+	BX, BY, BW, BH int
+
+	Angle      float64 // major axis orientation in radians
+	Elongation float64 // ratio of major to minor axis, 1 for round blobs
+	VX, VY     float64 // centroid velocity in cells per frame
+}
+
+// TrackPoint is a centroid sample of a track
+type TrackPoint struct {
+	Frame  int
+	CX, CY float64
+}
+
+// TrackEvent records a birth, death, split or merge
+type TrackEvent struct {
+	Frame int
+	Kind  string // birth, death, split, merge
+	ID    int
+	Other int // parent for splits, absorbing blob for merges
+}
+
+// Tracker segments fields and keeps blob identities across frames
+type Tracker struct {
+	W, H   int
+	Blobs  []*Blob // current frame
+	Trails map[int][]TrackPoint
+	Events []TrackEvent // events of the current frame
+
+	frame  int
+	nextID int
+	label  []int // component label per cell, reused between frames
+
+	tracksCSV *os.File
+	eventsCSV *os.File
+}
+
+func newTracker(w, h int) *Tracker {
+	return &Tracker{W: w, H: h, Trails: map[int][]TrackPoint{}, nextID: 1, label: make([]int, w*h)}
+}
+
+// segment labels the 8-connected components of A above trackThreshold. Coordinates are
+// unwrapped along the flood fill, so blobs crossing an edge keep a continuous shape.
+func (t *Tracker) segment(A [][]float64) []*Blob {
+	w, h := t.W, t.H
+	for i := range t.label {
+		t.label[i] = 0
+	}
+	type cell struct{ x, y, ux, uy int }
+	var blobs []*Blob
+	var stack []cell
+	for sy := 0; sy < h; sy++ {
+		for sx := 0; sx < w; sx++ {
+			if t.label[sy*w+sx] != 0 || A[sy][sx] <= trackThreshold {
+				continue
+			}
+			id := len(blobs) + 1
+			t.label[sy*w+sx] = id
+			stack = append(stack[:0], cell{sx, sy, sx, sy})
+			var mass, mx, my, mxx, myy, mxy float64
+			minX, minY, maxX, maxY := sx, sy, sx, sy
+			cells := 0
+			for len(stack) > 0 {
+				c := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				v := A[c.y][c.x]
+				cells++
+				mass += v
+				fx, fy := float64(c.ux), float64(c.uy)
+				mx += v * fx
+				my += v * fy
+				mxx += v * fx * fx
+				myy += v * fy * fy
+				mxy += v * fx * fy
+				minX, maxX = min2(minX, c.ux), max2(maxX, c.ux)
+				minY, maxY = min2(minY, c.uy), max2(maxY, c.uy)
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						nx, ny := (c.x+dx+w)%w, (c.y+dy+h)%h
+						if t.label[ny*w+nx] != 0 || A[ny][nx] <= trackThreshold {
+							continue
+						}
+						t.label[ny*w+nx] = id
+						stack = append(stack, cell{nx, ny, c.ux + dx, c.uy + dy})
+					}
+				}
+			}
+			b := &Blob{Cells: cells, Mass: mass, BX: minX, BY: minY, BW: maxX - minX + 1, BH: maxY - minY + 1}
+			cx, cy := mx/mass, my/mass
+			cxx := mxx/mass - cx*cx
+			cyy := myy/mass - cy*cy
+			cxy := mxy/mass - cx*cy
+			b.Angle = 0.5 * math.Atan2(2*cxy, cxx-cyy)
+			// eigenvalues of the covariance give the axis lengths
+			tr, det := cxx+cyy, cxx*cyy-cxy*cxy
+			disc := math.Sqrt(math.Max(0, tr*tr/4-det))
+			l1, l2 := tr/2+disc, tr/2-disc
+			b.Elongation = 1
+			if l2 > 1e-9 {
+				b.Elongation = math.Sqrt(l1 / l2)
+			}
+			b.CX = math.Mod(cx+float64(w), float64(w))
+			b.CY = math.Mod(cy+float64(h), float64(h))
+			// move the box by whole grid sizes so it surrounds the wrapped centroid
+			b.BX += int(math.Round(b.CX - cx))
+			b.BY += int(math.Round(b.CY - cy))
+			blobs = append(blobs, b)
+		}
+	}
+	kept := blobs[:0]
+	for _, b := range blobs {
+		if b.Cells >= trackMinCells {
+			kept = append(kept, b)
+		}
+	}
+	return kept
+}
+
+func min2(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max2(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// torusDist returns the shortest offset from (x0, y0) to (x1, y1) on the grid
+func (t *Tracker) torusDist(x0, y0, x1, y1 float64) (dx, dy float64) {
+	dx = math.Mod(x1-x0+1.5*float64(t.W), float64(t.W)) - 0.5*float64(t.W)
+	dy = math.Mod(y1-y0+1.5*float64(t.H), float64(t.H)) - 0.5*float64(t.H)
+	return dx, dy
+}
+
+// gate is how far a blob may move between frames and still be matched
+func gate(b *Blob) float64 {
+	return 0.5*math.Hypot(float64(b.BW), float64(b.BH)) + trackMaxJump
+}
+
+// Update segments A and matches the new blobs to the previous frame. Pairs are matched
+// greedily by distance from each old blob's predicted position. New blobs left over near
+// a matched old blob are splits, old blobs left over near a matched new blob are merges;
+// the rest are births and deaths.
+func (t *Tracker) Update(A [][]float64) {
+	t.frame++
+	prev := t.Blobs
+	next := t.segment(A)
+	t.Events = t.Events[:0]
+
+	type pair struct {
+		i, j int
+		d    float64
+	}
+	var pairs []pair
+	for i, p := range prev {
+		px, py := p.CX+p.VX, p.CY+p.VY
+		for j, n := range next {
+			dx, dy := t.torusDist(px, py, n.CX, n.CY)
+			if d := math.Hypot(dx, dy); d <= gate(p) {
+				pairs = append(pairs, pair{i, j, d})
+			}
+		}
+	}
+	sort.Slice(pairs, func(a, b int) bool { return pairs[a].d < pairs[b].d })
+	prevTo := make([]int, len(prev))
+	nextFrom := make([]int, len(next))
+	for i := range prevTo {
+		prevTo[i] = -1
+	}
+	for j := range nextFrom {
+		nextFrom[j] = -1
+	}
+	for _, pr := range pairs {
+		if prevTo[pr.i] >= 0 || nextFrom[pr.j] >= 0 {
+			continue
+		}
+		prevTo[pr.i], nextFrom[pr.j] = pr.j, pr.i
+		p, n := prev[pr.i], next[pr.j]
+		n.ID, n.Parent, n.Age = p.ID, p.Parent, p.Age+1
+		n.VX, n.VY = t.torusDist(p.CX, p.CY, n.CX, n.CY)
+	}
+
+	// leftovers: a gated partner (pairs are sorted, so the first is the nearest) tells a
+	// split or merge from a birth or death
+	for j, n := range next {
+		if nextFrom[j] >= 0 {
+			continue
+		}
+		n.ID = t.nextID
+		t.nextID++
+		i := -1
+		for _, pr := range pairs {
+			if pr.j == j {
+				i = pr.i
+				break
+			}
+		}
+		if i >= 0 {
+			n.Parent = prev[i].ID
+			t.Events = append(t.Events, TrackEvent{t.frame, "split", n.ID, prev[i].ID})
+		} else {
+			t.Events = append(t.Events, TrackEvent{t.frame, "birth", n.ID, 0})
+		}
+	}
+	for i, p := range prev {
+		if prevTo[i] >= 0 {
+			continue
+		}
+		j := -1
+		for _, pr := range pairs {
+			if pr.i == i {
+				j = pr.j
+				break
+			}
+		}
+		if j >= 0 {
+			t.Events = append(t.Events, TrackEvent{t.frame, "merge", p.ID, next[j].ID})
+		} else {
+			t.Events = append(t.Events, TrackEvent{t.frame, "death", p.ID, 0})
+		}
+		delete(t.Trails, p.ID)
+	}
+
+	for _, n := range next {
+		trail := append(t.Trails[n.ID], TrackPoint{t.frame, n.CX, n.CY})
+		if len(trail) > trackTrailLen {
+			trail = trail[len(trail)-trackTrailLen:]
+		}
+		t.Trails[n.ID] = trail
+	}
+	t.Blobs = next
+	t.writeCSV()
+}
+
+// Reset forgets all tracks, e.g. after the field was reseeded
+func (t *Tracker) Reset() {
+	t.Blobs = nil
+	t.Events = t.Events[:0]
+	t.Trails = map[int][]TrackPoint{}
+}
+
+// ---------- CSV export ----------
+// StartCSV begins writing one row per blob per frame to tracksPath and one row per event
+// to eventsPath
+func (t *Tracker) StartCSV(tracksPath, eventsPath string) error {
+	tf, err := os.Create(tracksPath)
+	if err != nil {
+		return err
+	}
+	ef, err := os.Create(eventsPath)
+	if err != nil {
+		tf.Close()
+		return err
+	}
+	fmt.Fprintln(tf, "frame,id,parent,age,cells,mass,cx,cy,bbox_x,bbox_y,bbox_w,bbox_h,angle,elongation,vx,vy")
+	fmt.Fprintln(ef, "frame,event,id,other")
+	t.tracksCSV, t.eventsCSV = tf, ef
+	return nil
+}
+
+// StopCSV closes the export files
+func (t *Tracker) StopCSV() error {
+	if t.tracksCSV == nil {
+		return nil
+	}
+	err := t.tracksCSV.Close()
+	if e := t.eventsCSV.Close(); err == nil {
+		err = e
+	}
+	t.tracksCSV, t.eventsCSV = nil, nil
+	return err
+}
+
+// Recording reports whether CSV export is active
+func (t *Tracker) Recording() bool { return t.tracksCSV != nil }
+
+func (t *Tracker) writeCSV() {
+	if t.tracksCSV == nil {
+		return
+	}
+	for _, b := range t.Blobs {
+		fmt.Fprintf(t.tracksCSV, "%d,%d,%d,%d,%d,%.4f,%.3f,%.3f,%d,%d,%d,%d,%.4f,%.3f,%.4f,%.4f\n",
+			t.frame, b.ID, b.Parent, b.Age, b.Cells, b.Mass, b.CX, b.CY, b.BX, b.BY, b.BW, b.BH,
+			b.Angle, b.Elongation, b.VX, b.VY)
+	}
+	for _, e := range t.Events {
+		fmt.Fprintf(t.eventsCSV, "%d,%s,%d,%d\n", e.Frame, e.Kind, e.ID, e.Other)
+	}
+}
@@ -0,0 +1,154 @@
+// test: go test tracking_test.go tracking.go
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+const (
+	testTrackW = 20
+	testTrackH = 16
+)
+
+// rectField returns a testTrackW×testTrackH field with the w×h rectangles at the given
+// corners set to 1, wrapping around the edges
+func rectField(rects ...[4]int) [][]float64 {
+	A := make([][]float64, testTrackH)
+	for y := range A {
+		A[y] = make([]float64, testTrackW)
+	}
+	for _, r := range rects {
+		for y := r[1]; y < r[1]+r[3]; y++ {
+			for x := r[0]; x < r[0]+r[2]; x++ {
+				A[(y%testTrackH+testTrackH)%testTrackH][(x%testTrackW+testTrackW)%testTrackW] = 1
+			}
+		}
+	}
+	return A
+}
+
+func TestTrackerSegment(t *testing.T) {
+	type box struct{ x, y, w, h int }
+	for _, tc := range []struct {
+		name   string
+		A      [][]float64
+		blobs  int
+		cells  int
+		cx, cy float64
+		box    box
+	}{
+		{"inside", rectField([4]int{5, 6, 3, 2}), 1, 6, 6, 6.5, box{5, 6, 3, 2}},
+		{"across x", rectField([4]int{18, 3, 4, 3}), 1, 12, 19.5, 4, box{18, 3, 4, 3}},
+		{"across y", rectField([4]int{7, 14, 2, 5}), 1, 10, 7.5, 0, box{7, -2, 2, 5}}, // centred on row 0
+		{"across both", rectField([4]int{18, 14, 4, 4}), 1, 16, 19.5, 15.5, box{18, 14, 4, 4}},
+		{"debris", rectField([4]int{5, 5, 2, 2}), 0, 0, 0, 0, box{}},
+		{"two", rectField([4]int{2, 2, 3, 3}, [4]int{10, 10, 3, 3}), 2, 9, 3, 3, box{2, 2, 3, 3}},
+	} {
+		tr := newTracker(testTrackW, testTrackH)
+		blobs := tr.segment(tc.A)
+		if len(blobs) != tc.blobs {
+			t.Errorf("%s: %d blobs, want %d", tc.name, len(blobs), tc.blobs)
+			continue
+		}
+		if tc.blobs == 0 {
+			continue
+		}
+		b := blobs[0]
+		if b.Cells != tc.cells || math.Abs(b.Mass-float64(tc.cells)) > 1e-9 {
+			t.Errorf("%s: %d cells of mass %g, want %d", tc.name, b.Cells, b.Mass, tc.cells)
+		}
+		if math.Abs(b.CX-tc.cx) > 1e-9 || math.Abs(b.CY-tc.cy) > 1e-9 {
+			t.Errorf("%s: centroid (%g, %g), want (%g, %g)", tc.name, b.CX, b.CY, tc.cx, tc.cy)
+		}
+		if got := (box{b.BX, b.BY, b.BW, b.BH}); got != tc.box {
+			t.Errorf("%s: box %+v, want %+v", tc.name, got, tc.box)
+		}
+	}
+}
+
+// a square gliding one cell per frame keeps its ID across the wrap-around
+func TestTrackerGliderWraps(t *testing.T) {
+	tr := newTracker(testTrackW, testTrackH)
+	id := 0
+	for f := 0; f < 12; f++ {
+		tr.Update(rectField([4]int{14 + f, 6, 3, 3}))
+		if len(tr.Blobs) != 1 {
+			t.Fatalf("frame %d: %d blobs, want 1", f, len(tr.Blobs))
+		}
+		b := tr.Blobs[0]
+		if f == 0 {
+			id = b.ID
+			if len(tr.Events) != 1 || tr.Events[0].Kind != "birth" {
+				t.Fatalf("frame 0: events %v, want one birth", tr.Events)
+			}
+			continue
+		}
+		if b.ID != id || b.Age != f {
+			t.Errorf("frame %d: ID %d age %d, want ID %d age %d", f, b.ID, b.Age, id, f)
+		}
+		if len(tr.Events) != 0 {
+			t.Errorf("frame %d: events %v, want none", f, tr.Events)
+		}
+		if math.Abs(b.VX-1) > 1e-9 || math.Abs(b.VY) > 1e-9 {
+			t.Errorf("frame %d: velocity (%g, %g), want (1, 0)", f, b.VX, b.VY)
+		}
+	}
+}
+
+func TestTrackerSplitMerge(t *testing.T) {
+	tr := newTracker(testTrackW, testTrackH)
+	tr.Update(rectField([4]int{4, 5, 6, 3}))
+	parent := tr.Blobs[0].ID
+
+	// one blob becomes two: one keeps the track, the other splits from it
+	tr.Update(rectField([4]int{2, 5, 3, 3}, [4]int{9, 5, 3, 3}))
+	if len(tr.Blobs) != 2 || len(tr.Events) != 1 {
+		t.Fatalf("split: %d blobs, events %v, want 2 blobs and one event", len(tr.Blobs), tr.Events)
+	}
+	e := tr.Events[0]
+	var kept, split *Blob
+	for _, b := range tr.Blobs {
+		if b.ID == parent {
+			kept = b
+		} else {
+			split = b
+		}
+	}
+	if kept == nil || e.Kind != "split" || e.ID != split.ID || e.Other != parent || split.Parent != parent {
+		t.Fatalf("split: event %+v, blobs %+v %+v, want %d to split from %d", e, kept, split, split.ID, parent)
+	}
+
+	// and back into one: the survivor is matched, the other merges into it
+	tr.Update(rectField([4]int{4, 5, 6, 3}))
+	if len(tr.Blobs) != 1 || len(tr.Events) != 1 {
+		t.Fatalf("merge: %d blobs, events %v, want 1 blob and one event", len(tr.Blobs), tr.Events)
+	}
+	e = tr.Events[0]
+	survivor := tr.Blobs[0].ID
+	if e.Kind != "merge" || e.Other != survivor || (e.ID != parent && e.ID != split.ID) || e.ID == survivor {
+		t.Errorf("merge: event %+v with survivor %d, want one of %d and %d to merge into it", e, survivor, parent, split.ID)
+	}
+	if _, ok := tr.Trails[e.ID]; ok {
+		t.Errorf("merge: trail of %d kept after it merged", e.ID)
+	}
+}
+
+// a blob that vanishes dies and one that appears far from any other is born
+func TestTrackerBirthDeath(t *testing.T) {
+	tr := newTracker(testTrackW, testTrackH)
+	tr.Update(rectField([4]int{1, 1, 3, 3}))
+	old := tr.Blobs[0].ID
+	tr.Update(rectField([4]int{11, 9, 3, 3}))
+	if len(tr.Events) != 2 {
+		t.Fatalf("events %v, want a birth and a death", tr.Events)
+	}
+	for _, e := range tr.Events {
+		switch {
+		case e.Kind == "birth" && e.ID == tr.Blobs[0].ID && e.ID != old:
+		case e.Kind == "death" && e.ID == old:
+		default:
+			t.Errorf("unexpected event %+v", e)
+		}
+	}
+}
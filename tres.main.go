@@ -1,18 +1,23 @@
 // lenia_evolve_extended.go
+// run: go run tres.main.go modulator.go integrator.go fftplan.go spectral.go lyapunov.go palette.go render.go
 package main
 
 import (
+	"flag"
 	"fmt"
 	"image/color"
 	"log"
 	"math"
-	"math/cmplx"
 	"math/rand"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/hajimehoshi/ebiten/v2/vector"
 	"golang.org/x/image/font/basicfont"
 )
 
@@ -34,6 +39,18 @@ const (
 	// ANOMALY MOVEMENT PARAMETERS (NEW)
 	anomalySearchRadius = 51  // Radius to search for the nearest population peak
 	anomalyMoveSpeed    = 1.0 // Distance the anomaly moves per step (in grid units)
+
+	// ANOMALY CO-EVOLUTION - the constants above seed the first anomaly genome
+	anomalyPopSz        = 8   // anomaly population size
+	anomalyElitism      = 2   // keep top N anomalies as-is
+	anomalyMutationRate = 0.3 // per-parameter mutation probability for anomalies
+	anomalyMaxRadius    = 40.0
+	anomalyMaxStrength  = 5.0
+	anomalyMaxSpeed     = 6.0
+	anomalySizeCost     = 0.3 // fitness cost of the largest, strongest anomaly (strength·radius²)
+	anomalySpeedCost    = 0.1 // fitness cost of the fastest anomaly
+
+	lyapunovODESteps = 20000 // Lorenz steps per exponent estimate (Y key)
 )
 
 // ---------- Types ----------
@@ -52,22 +69,60 @@ type Genome struct {
 	Fitness    float64 // cached after evaluation
 }
 
-type Lorenz struct {
-	x, y, z float64
-	sigma   float64
-	rho     float64
-	beta    float64
-	dt      float64
+// AnomalyGenome parameterizes the devouring anomaly. A population of them co-evolves
+// against the Lenia genomes: anomalies are scored by the share of mass they devour, less
+// an upkeep for their size, strength and speed, so bigger and faster is not free.
+type AnomalyGenome struct {
+	Radius       float64 // radius of the devouring influence
+	Strength     float64 // activity devoured per step at the centre
+	SearchRadius float64 // radius searched for the next activity peak
+	Speed        float64 // base distance moved per step
+	LorenzCouple float64 // how strongly the Lorenz attractor drives speed and swirl
+	Fitness      float64 // mean share of mass devoured per encounter, less upkeep
+
+	devouredSum float64 // shares accumulated over the current generation's encounters
+	encounters  int
+}
+
+func defaultAnomalyGenome() AnomalyGenome {
+	return AnomalyGenome{
+		Radius:       anomalyRadius,
+		Strength:     anomalyStrength,
+		SearchRadius: anomalySearchRadius,
+		Speed:        anomalyMoveSpeed,
+		LorenzCouple: 1.0,
+	}
 }
 
-func (l *Lorenz) Step() {
-	// classic Lorenz attractor integration (RK4 could be used but simple Euler suffices here)
-	dx := l.sigma * (l.y - l.x)
-	dy := l.x*(l.rho-l.z) - l.y
-	dz := l.x*l.y - l.beta*l.z
-	l.x += dx * l.dt
-	l.y += dy * l.dt
-	l.z += dz * l.dt
+// upkeep is the fitness cost of the anomaly's reach and pace, 0 for a point that stands
+// still and anomalySizeCost+anomalySpeedCost at the mutation limits
+func (a *AnomalyGenome) upkeep() float64 {
+	size := a.Strength * a.Radius * a.Radius / (anomalyMaxStrength * anomalyMaxRadius * anomalyMaxRadius)
+	return anomalySizeCost*size + anomalySpeedCost*a.Speed/anomalyMaxSpeed
+}
+
+func randomAnomalyGenome() AnomalyGenome {
+	return AnomalyGenome{
+		Radius:       4.0 + rand.Float64()*20.0,  // 4..24
+		Strength:     0.1 + rand.Float64()*3.5,   // 0.1..3.6
+		SearchRadius: 10.0 + rand.Float64()*70.0, // 10..80
+		Speed:        0.2 + rand.Float64()*2.0,   // 0.2..2.2
+		LorenzCouple: rand.Float64() * 2.0,       // 0..2
+	}
+}
+
+// defaultModulation approximates the old filter cutoff gain 0.5+0.5·tanh(0.02·z), about
+// 0.5 to 0.88 over the attractor's z range, by the linear 0.7±0.15. The old gain read the
+// Lorenz attractor that also steers the anomaly; the binding drives its own Lorenz
+// modulator, started from the same state with the same Δt but stepped separately, so the
+// filter and the anomaly no longer follow one trajectory. Override with -mod.
+const defaultModulation = "cutoff=lorenz.z@0.005:0.15:0.7"
+
+// modParams are the values modulator bindings can drive. Offsets are added to the
+// genome being simulated, gains multiply the anomaly genome and the filter cutoff.
+type modParams struct {
+	mu, sigma, dt           float64 // offsets
+	strength, speed, cutoff float64 // gains
 }
 
 type Game struct {
@@ -76,14 +131,30 @@ type Game struct {
 	kernel  []KernelEntry
 	Knorm   float64
 	texture *ebiten.Image
+	pixels  *FieldPixels
 
 	// Anomaly State (NEW)
-	anomalyX float64
-	anomalyY float64
-	lorenz   Lorenz
+	agents     []*Agent
+	lorenz     Lorenz
+	lorenzLyap float64 // largest Lyapunov exponent of the Lorenz attractor (Y key)
+	showLyap   bool
+
+	// Parameter modulation
+	mod      modParams
+	bindings []*Binding
+	stepper  *fieldStepper
+	filter   *SpectralFilter
+
+	// Anomaly co-evolution
+	anomaly           AnomalyGenome   // genome currently driving the anomaly
+	anomalies         []AnomalyGenome // anomaly population, best first after each generation
+	anomalyGeneration int
+	anomalyMean       float64 // mean anomaly fitness of the last generation
+	devoured          float64 // mass devoured since the field was last seeded
 
 	// runtime
 	generation      int
+	leniaMean       float64 // mean Lenia fitness of the last generation
 	population      []Genome
 	currentIndex    int
 	stepCount       int
@@ -92,9 +163,11 @@ type Game struct {
 	lastEvolveTime  time.Time
 
 	// visualization
-	frame   int
-	start   time.Time
-	lastFPS int
+	palettes *PaletteCycle
+	timer    FrameTimer
+	frame    int
+	start    time.Time
+	lastFPS  int
 }
 
 // ---------- Utility ----------
@@ -192,91 +265,6 @@ func fib(n int) uint64 {
 	return b
 }
 
-// ---------- FFT (Cooley-Tukey, power-of-two) ----------
-func nextPow2(n int) int {
-	p := 1
-	for p < n {
-		p <<= 1
-	}
-	return p
-}
-
-func fft(a []complex128) []complex128 {
-	n := len(a)
-	if n == 1 {
-		return []complex128{a[0]}
-	}
-	if n%2 != 0 {
-		// pad to next pow2 (shouldn't reach here in recursion if we start with pow2)
-		np := nextPow2(n)
-		b := make([]complex128, np)
-		copy(b, a)
-		return fft(b)
-	}
-	// split
-	even := make([]complex128, n/2)
-	odd := make([]complex128, n/2)
-	for i := 0; i < n/2; i++ {
-		even[i] = a[2*i]
-		odd[i] = a[2*i+1]
-	}
-	even = fft(even)
-	odd = fft(odd)
-	res := make([]complex128, n)
-	for k := 0; k < n/2; k++ {
-		t := cmplx.Exp(complex(0, -2*math.Pi*float64(k)/float64(n))) * odd[k]
-		res[k] = even[k] + t
-		res[k+n/2] = even[k] - t
-	}
-	return res
-}
-
-func ifft(A []complex128) []complex128 {
-	n := len(A)
-	conj := make([]complex128, n)
-	for i := 0; i < n; i++ {
-		conj[i] = cmplx.Conj(A[i])
-	}
-	y := fft(conj)
-	res := make([]complex128, n)
-	for i := 0; i < n; i++ {
-		res[i] = cmplx.Conj(y[i]) / complex(float64(n), 0)
-	}
-	return res
-}
-
-// Apply a simple FFT-based filter across each row: low-pass with cutoff ratio
-func (g *Game) applyFFTFilter(cutoffRatio float64) {
-	// cutoffRatio between 0..1
-	L := gridW
-	np := nextPow2(L)
-	buf := make([]complex128, np)
-	for y := 0; y < gridH; y++ {
-		// fill
-		for x := 0; x < np; x++ {
-			if x < L {
-				buf[x] = complex(g.A[y][x], 0)
-			} else {
-				buf[x] = 0
-			}
-		}
-		// fft
-		F := fft(buf)
-		// zero high freq
-		cut := int(cutoffRatio * float64(len(F)) / 2.0)
-		for k := cut; k < len(F)-cut; k++ {
-			F[k] = 0
-		}
-		// inverse
-		inv := ifft(F)
-		// write back real parts (normalize/clamp)
-		for x := 0; x < L; x++ {
-			v := real(inv[x])
-			g.A[y][x] = clamp(v, 0, 1)
-		}
-	}
-}
-
 // ---------- Five-dimensional mapping ----------
 // Map genome parameters into a 5D normalized vector for downstream modulation
 func map5D(gen *Genome) [5]float64 {
@@ -289,64 +277,128 @@ func map5D(gen *Genome) [5]float64 {
 	return [5]float64{clamp(mu, 0, 1), clamp(sigma, 0, 1), clamp(radius, 0, 1), clamp(shell, 0, 1), clamp(dt, 0, 1)}
 }
 
-// ---------- Modified: Implements the devouring effect using dynamic anomalyX/Y ----------
-func (g *Game) applyAnomalyEffect() {
-	ax, ay := g.anomalyX, g.anomalyY
-	Ri := int(math.Ceil(anomalyRadius))
-	for dy := -Ri; dy <= Ri; dy++ {
-		for dx := -Ri; dx <= Ri; dx++ {
-			x := wrap(int(ax)+dx, gridW)
-			y := wrap(int(ay)+dy, gridH)
-			// shortest toroidal distance approx
-			dxF := float64(x) - ax
-			dyF := float64(y) - ay
-			if dxF > float64(gridW/2) {
-				dxF -= float64(gridW)
-			} else if dxF < float64(-gridW/2) {
-				dxF += float64(gridW)
-			}
-			if dyF > float64(gridH/2) {
-				dyF -= float64(gridH)
-			} else if dyF < float64(-gridH/2) {
-				dyF += float64(gridH)
+// ---------- Anomaly agents ----------
+// Agent is one devouring anomaly on the field. All agents share the current anomaly
+// genome; how each one moves is decided by its steering behaviour.
+type Agent struct {
+	X, Y      float64
+	VX, VY    float64 // last displacement, used for flocking alignment
+	Behaviour Steering
+
+	startX, startY float64 // position restored when the field is reseeded
+	heading        float64 // random walker direction
+	waypoint       int     // patrol path progress
+}
+
+// Steering picks the direction an agent wants to move in. ok=false keeps it in place
+// for this step.
+type Steering interface {
+	Name() string
+	Color() color.NRGBA
+	Steer(g *Game, a *Agent) (dx, dy float64, ok bool)
+}
+
+// parseAgents builds agents from a spec like "greedy,flock*4,patrol"
+func parseAgents(spec string) ([]*Agent, error) {
+	var agents []*Agent
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, count := item, 1
+		if i := strings.Index(item, "*"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("bad agent count in %q", item)
 			}
-			dist := math.Hypot(dxF, dyF)
-			if dist < anomalyRadius {
-				factor := 1.0 - (dist / anomalyRadius)
-				devour := anomalyStrength * factor
-				g.A[y][x] = clamp(g.A[y][x]-devour, 0.0, 1.0)
+			name, count = item[:i], n
+		}
+		for c := 0; c < count; c++ {
+			var b Steering
+			switch name {
+			case "greedy":
+				b = greedySeeker{}
+			case "gradient":
+				b = gradientFollower{}
+			case "random":
+				b = randomWalker{}
+			case "patrol":
+				b = patrolPath{}
+			case "flock":
+				b = flocking{}
+			default:
+				return nil, fmt.Errorf("unknown agent behaviour %q (want greedy, gradient, random, patrol or flock)", name)
 			}
+			agents = append(agents, &Agent{Behaviour: b})
 		}
 	}
+	if len(agents) == 0 {
+		return nil, fmt.Errorf("no agents in %q", spec)
+	}
+	// first agent starts in the center as before, the rest on a ring around it
+	for i, a := range agents {
+		a.startX, a.startY = float64(gridW/2), float64(gridH/2)
+		if i > 0 {
+			angle := 2 * math.Pi * float64(i) / float64(len(agents))
+			a.startX += math.Cos(angle) * gridW / 4
+			a.startY += math.Sin(angle) * gridH / 4
+		}
+		a.heading = rand.Float64() * 2 * math.Pi
+	}
+	return agents, nil
 }
 
-// NEW FUNCTION: Implements the shortest path movement towards highest local activity
-// and also influenced by Lorenz attractor and Fibonacci-modulated speed
-func (g *Game) findTargetAndMoveAnomaly() {
-	ax, ay := int(g.anomalyX), int(g.anomalyY)
-	searchRi := int(anomalySearchRadius)
+func (g *Game) resetAgents() {
+	for _, a := range g.agents {
+		a.X, a.Y = a.startX, a.startY
+		a.VX, a.VY = 0, 0
+		a.waypoint = 0
+	}
+}
 
-	var maxActivity float64 = -1.0
-	var targetX, targetY int = ax, ay
+// torusDelta maps a coordinate difference onto the shortest toroidal offset
+func torusDelta(d float64, size int) float64 {
+	if d > float64(size/2) {
+		d -= float64(size)
+	} else if d < float64(-size/2) {
+		d += float64(size)
+	}
+	return d
+}
 
-	for dy := -searchRi; dy <= searchRi; dy++ {
-		for dx := -searchRi; dx <= searchRi; dx++ {
-			x := wrap(ax+dx, gridW)
-			y := wrap(ay+dy, gridH)
-			activity := g.A[y][x]
-			if activity > maxActivity {
-				maxActivity = activity
-				targetX = ax + dx
-				targetY = ay + dy
+// Implements the devouring effect around every agent
+func (g *Game) applyAnomalyEffect() {
+	radius := g.anomaly.Radius
+	Ri := int(math.Ceil(radius))
+	for _, a := range g.agents {
+		ax, ay := a.X, a.Y
+		for dy := -Ri; dy <= Ri; dy++ {
+			for dx := -Ri; dx <= Ri; dx++ {
+				x := wrap(int(ax)+dx, gridW)
+				y := wrap(int(ay)+dy, gridH)
+				// shortest toroidal distance approx
+				dist := math.Hypot(torusDelta(float64(x)-ax, gridW), torusDelta(float64(y)-ay, gridH))
+				if dist < radius {
+					factor := 1.0 - (dist / radius)
+					devour := g.anomaly.Strength * g.mod.strength * factor
+					before := g.A[y][x]
+					g.A[y][x] = clamp(before-devour, 0.0, 1.0)
+					g.devoured += before - g.A[y][x]
+				}
 			}
 		}
 	}
+}
 
-	// Lorenz influence: step and map to a small offset
+// moveAgents steps the Lorenz attractor once and moves every agent along its steering
+// direction, with speed influenced by Lorenz and Fibonacci modulation
+func (g *Game) moveAgents() {
 	g.lorenz.Step()
 	lorX := g.lorenz.x
 	lorY := g.lorenz.y
 	lorZ := g.lorenz.z
+	couple := g.anomaly.LorenzCouple
 
 	// Fibonacci-modulated speed: pick an index from lorenz z
 	fibIdx := 10 + int(math.Abs(lorZ))%20 // safe small index
@@ -354,58 +406,152 @@ func (g *Game) findTargetAndMoveAnomaly() {
 	// normalize fibVal to a reasonable multiplier
 	fibMul := 0.0005 * (1.0 + math.Mod(fibVal, 1000.0)/1000.0)
 
-	// If a significant target is found
-	if maxActivity > 0.01 {
-		dx := float64(targetX) - g.anomalyX
-		dy := float64(targetY) - g.anomalyY
-		// adjust for toroidal shortest path
-		if dx > float64(gridW/2) {
-			dx -= float64(gridW)
-		} else if dx < float64(-gridW/2) {
-			dx += float64(gridW)
-		}
-		if dy > float64(gridH/2) {
-			dy -= float64(gridH)
-		} else if dy < float64(-gridH/2) {
-			dy += float64(gridH)
-		}
+	for _, a := range g.agents {
+		dx, dy, ok := a.Behaviour.Steer(g, a)
 		dist := math.Hypot(dx, dy)
-		if dist > 1e-6 {
-			dx /= dist
-			dy /= dist
-		} else {
-			return
+		if !ok || dist <= 1e-6 {
+			a.VX, a.VY = 0, 0
+			continue
 		}
+		dx /= dist
+		dy /= dist
 
-		// base speed influenced by anomalyMoveSpeed, Lorenz x/y, and fibMul
-		speed := anomalyMoveSpeed*(1.0+0.2*lorX+0.2*lorY) + fibMul*float64(fibIdx)
+		// base speed influenced by the genome speed, Lorenz x/y, and fibMul
+		speed := g.anomaly.Speed*g.mod.speed*(1.0+0.2*couple*lorX+0.2*couple*lorY) + fibMul*float64(fibIdx)
 		// small randomness
 		speed += (rand.Float64() - 0.5) * 0.3
+		speed = clamp(speed, 0.1, 8.0)
+
+		// move, plus a small Lorenz swirl
+		a.VX = dx*speed + lorX*0.05*couple
+		a.VY = dy*speed + lorY*0.05*couple
+		a.X = math.Mod(a.X+a.VX+gridW, gridW)
+		a.Y = math.Mod(a.Y+a.VY+gridH, gridH)
+	}
+}
 
-		// limit
-		if speed < 0.1 {
-			speed = 0.1
+// peakNear returns the toroidal offset to the most active cell within radius of (x, y)
+func (g *Game) peakNear(x, y float64, radius int) (dx, dy, activity float64) {
+	ax, ay := int(x), int(y)
+	activity = -1.0
+	for oy := -radius; oy <= radius; oy++ {
+		for ox := -radius; ox <= radius; ox++ {
+			v := g.A[wrap(ay+oy, gridH)][wrap(ax+ox, gridW)]
+			if v > activity {
+				activity = v
+				dx, dy = float64(ax+ox)-x, float64(ay+oy)-y
+			}
 		}
-		if speed > 8.0 {
-			speed = 8.0
+	}
+	return dx, dy, activity
+}
+
+// greedySeeker heads for the local activity maximum within the genome's search radius
+type greedySeeker struct{}
+
+func (greedySeeker) Name() string       { return "greedy" }
+func (greedySeeker) Color() color.NRGBA { return color.NRGBA{R: 0xff, G: 0x30, B: 0x30, A: 0xff} }
+func (greedySeeker) Steer(g *Game, a *Agent) (float64, float64, bool) {
+	dx, dy, activity := g.peakNear(a.X, a.Y, int(g.anomaly.SearchRadius))
+	return dx, dy, activity > 0.01
+}
+
+// gradientFollower climbs the locally smoothed activity gradient
+type gradientFollower struct{}
+
+func (gradientFollower) Name() string       { return "gradient" }
+func (gradientFollower) Color() color.NRGBA { return color.NRGBA{R: 0xff, G: 0xa0, B: 0x20, A: 0xff} }
+func (gradientFollower) Steer(g *Game, a *Agent) (float64, float64, bool) {
+	h := int(math.Max(2, g.anomaly.Radius/2))
+	box := func(cx, cy int) float64 {
+		var sum float64
+		for oy := -1; oy <= 1; oy++ {
+			for ox := -1; ox <= 1; ox++ {
+				sum += g.A[wrap(cy+oy, gridH)][wrap(cx+ox, gridW)]
+			}
 		}
+		return sum
+	}
+	x, y := int(a.X), int(a.Y)
+	gx := box(x+h, y) - box(x-h, y)
+	gy := box(x, y+h) - box(x, y-h)
+	return gx, gy, math.Hypot(gx, gy) > 1e-3
+}
+
+// randomWalker wanders with a slowly drifting heading
+type randomWalker struct{}
 
-		// move anomaly
-		g.anomalyX += dx * speed
-		g.anomalyY += dy * speed
+func (randomWalker) Name() string       { return "random" }
+func (randomWalker) Color() color.NRGBA { return color.NRGBA{R: 0x30, G: 0xe0, B: 0xff, A: 0xff} }
+func (randomWalker) Steer(g *Game, a *Agent) (float64, float64, bool) {
+	a.heading += rand.NormFloat64() * 0.4
+	return math.Cos(a.heading), math.Sin(a.heading), true
+}
 
-		// also add a small Lorenz swirl
-		g.anomalyX += lorX * 0.05
-		g.anomalyY += lorY * 0.05
+// patrolPath loops through fixed waypoints on a ring around the field center
+type patrolPath struct{}
+
+const patrolPoints = 8
+
+func (patrolPath) Name() string       { return "patrol" }
+func (patrolPath) Color() color.NRGBA { return color.NRGBA{R: 0xf0, G: 0xf0, B: 0xf0, A: 0xff} }
+func (patrolPath) Steer(g *Game, a *Agent) (float64, float64, bool) {
+	angle := 2 * math.Pi * float64(a.waypoint) / patrolPoints
+	tx := float64(gridW/2) + math.Cos(angle)*gridW/3
+	ty := float64(gridH/2) + math.Sin(angle)*gridH/3
+	dx := torusDelta(tx-a.X, gridW)
+	dy := torusDelta(ty-a.Y, gridH)
+	if math.Hypot(dx, dy) < 3 {
+		a.waypoint = (a.waypoint + 1) % patrolPoints
+	}
+	return dx, dy, true
+}
 
-		// wrap
-		g.anomalyX = math.Mod(g.anomalyX+gridW, gridW)
-		g.anomalyY = math.Mod(g.anomalyY+gridH, gridH)
+// flocking hunts as a group: boids-style cohesion, separation and alignment with the
+// other flocking agents, plus a pull towards the nearest activity peak
+type flocking struct{}
+
+func (flocking) Name() string       { return "flock" }
+func (flocking) Color() color.NRGBA { return color.NRGBA{R: 0xe0, G: 0x40, B: 0xff, A: 0xff} }
+func (flocking) Steer(g *Game, a *Agent) (float64, float64, bool) {
+	var cx, cy, sx, sy, vx, vy float64
+	mates := 0
+	for _, o := range g.agents {
+		if o == a || o.Behaviour.Name() != "flock" {
+			continue
+		}
+		dx := torusDelta(o.X-a.X, gridW)
+		dy := torusDelta(o.Y-a.Y, gridH)
+		cx += dx
+		cy += dy
+		vx += o.VX
+		vy += o.VY
+		if d := math.Hypot(dx, dy); d < 2*g.anomaly.Radius && d > 1e-6 {
+			sx -= dx / d
+			sy -= dy / d
+		}
+		mates++
+	}
+	tx, ty, activity := g.peakNear(a.X, a.Y, int(g.anomaly.SearchRadius))
+	if d := math.Hypot(tx, ty); d > 1e-6 && activity > 0.01 {
+		tx, ty = tx/d, ty/d
+	} else {
+		tx, ty = 0, 0
+	}
+	if mates == 0 {
+		return tx, ty, activity > 0.01
+	}
+	n := float64(mates)
+	if d := math.Hypot(cx, cy); d > 1e-6 {
+		cx, cy = cx/d, cy/d
 	}
+	dx := 0.6*cx + 1.0*sx + 0.4*vx/n + 1.0*tx
+	dy := 0.6*cy + 1.0*sy + 0.4*vy/n + 1.0*ty
+	return dx, dy, true
 }
 
 // ---------- Initialize ----------
-func NewGame() *Game {
+func NewGame(agents []*Agent) *Game {
 	rand.Seed(time.Now().UnixNano())
 
 	A := make([][]float64, gridH)
@@ -419,6 +565,7 @@ func NewGame() *Game {
 		A:               A,
 		Anext:           Anext,
 		texture:         ebiten.NewImage(gridW, gridH),
+		pixels:          newFieldPixels(gridW, gridH),
 		generation:      0,
 		currentIndex:    0,
 		stepCount:       0,
@@ -426,11 +573,10 @@ func NewGame() *Game {
 		autoEvolveDelay: 3 * time.Second,
 		lastEvolveTime:  time.Now(),
 		start:           time.Now(),
-		// Initialize Anomaly position in the center
-		anomalyX: float64(gridW / 2),
-		anomalyY: float64(gridH / 2),
+		agents:          agents,
 		// initialize Lorenz attractor with standard params but small dt
-		lorenz: Lorenz{x: 0.1, y: 0.0, z: 0.0, sigma: 10.0, rho: 28.0, beta: 8.0 / 3.0, dt: 0.005},
+		lorenz: Lorenz{x: 0.1, y: 0.0, z: 0.0, sigma: 10.0, rho: 28.0, beta: 8.0 / 3.0, dt: 0.005, method: odeMethod},
+		mod:    modParams{strength: 1, speed: 1, cutoff: 1},
 	}
 
 	// initialize random population
@@ -438,6 +584,13 @@ func NewGame() *Game {
 	for i := 0; i < populationSz; i++ {
 		g.population[i] = randomGenome()
 	}
+	// anomaly population starts from the hand-tuned constants plus random variants
+	g.anomalies = make([]AnomalyGenome, anomalyPopSz)
+	g.anomalies[0] = defaultAnomalyGenome()
+	for i := 1; i < anomalyPopSz; i++ {
+		g.anomalies[i] = randomAnomalyGenome()
+	}
+	g.anomaly = g.anomalies[0]
 	// prepare kernel for first genome
 	g.applyGenomeKernel(&g.population[0])
 	// seed grid for first genome
@@ -482,54 +635,78 @@ func (g *Game) seedFromGenome(gen *Genome) {
 			}
 		}
 	}
-	// Reset anomaly position to center on new genome start
-	g.anomalyX = float64(gridW / 2)
-	g.anomalyY = float64(gridH / 2)
+	// Reset anomaly positions on new genome start
+	g.resetAgents()
+	g.devoured = 0
 }
 
 // ---------- Single step (MODIFIED) ----------
 func (g *Game) step(gen *Genome) {
-	// 1. Move the anomaly (finding the shortest path to peak activity)
-	g.findTargetAndMoveAnomaly()
+	// 0. Advance the modulators and derive the parameters for this step
+	stepBindings(g.bindings)
+	mu := clamp(gen.Mu+g.mod.mu, 0.01, 1.0)
+	sigma := clamp(gen.Sigma+g.mod.sigma, 0.005, 0.5)
+	dt := clamp(gen.Dt+g.mod.dt, 0.005, 0.5)
+
+	// 1. Move the anomalies along their steering behaviours
+	g.moveAgents()
 
 	// 2. Perform Lenia-step
-	for y := 0; y < gridH; y++ {
-		for x := 0; x < gridW; x++ {
-			var u float64
-			for _, k := range g.kernel {
-				nx := wrap(x+k.dx, gridW)
-				ny := wrap(y+k.dy, gridH)
-				u += k.w * g.A[ny][nx]
+	g.stepper.step(g.A, g.Anext, dt, func(src, dst [][]float64) {
+		for y := 0; y < gridH; y++ {
+			for x := 0; x < gridW; x++ {
+				var u float64
+				for _, k := range g.kernel {
+					nx := wrap(x+k.dx, gridW)
+					ny := wrap(y+k.dy, gridH)
+					u += k.w * src[ny][nx]
+				}
+				dst[y][x] = growth(u, mu, sigma)
 			}
-			grow := growth(u, gen.Mu, gen.Sigma)
-			val := g.A[y][x] + gen.Dt*grow
-			g.Anext[y][x] = clamp(val, 0.0, 1.0)
 		}
-	}
+	})
 	g.A, g.Anext = g.Anext, g.A
 
 	// 3. Apply the devouring effect
 	g.applyAnomalyEffect()
 
-	// 4. Occasionally apply FFT-based filtering to the field to create wave-like structures
-	if g.stepCount%8 == 0 {
-		// cutoff influenced by lorenz z and 5D mapping
-		mm := map5D(gen)
-		cutoff := 0.08 + 0.4*mm[2] // radius component influences cutoff
-		// further modulate by lorenz z
-		cutoff *= 0.5 + 0.5*math.Tanh(g.lorenz.z*0.02)
-		if cutoff < 0.02 {
-			cutoff = 0.02
-		}
-		if cutoff > 0.95 {
-			cutoff = 0.95
+	// 4. Apply 2D spectral filtering on schedule to create wave-like structures
+	if g.filter.Due(g.stepCount) {
+		// without an explicit -filter cutoff it follows the 5D mapping and the modulated gain
+		if !g.filter.Fixed {
+			mm := map5D(gen)
+			cutoff := 0.08 + 0.4*mm[2] // radius component influences cutoff
+			cutoff *= g.mod.cutoff
+			if cutoff < 0.02 {
+				cutoff = 0.02
+			}
+			if cutoff > 0.95 {
+				cutoff = 0.95
+			}
+			g.filter.Cutoff = cutoff
 		}
-		g.applyFFTFilter(cutoff)
+		g.filter.Apply(g.A)
+	}
+}
+
+// params exposes the modulated values by name for -mod bindings
+func (g *Game) params() map[string]*float64 {
+	return map[string]*float64{
+		"mu":       &g.mod.mu,
+		"sigma":    &g.mod.sigma,
+		"dt":       &g.mod.dt,
+		"strength": &g.mod.strength,
+		"speed":    &g.mod.speed,
+		"cutoff":   &g.mod.cutoff,
 	}
 }
 
 // ---------- Fitness evaluation ----------
+// The genome is evaluated against a random opponent from the anomaly population; the
+// opponent is credited with the mass it devours.
 func (g *Game) evaluateGenome(gen *Genome) float64 {
+	opp := &g.anomalies[rand.Intn(len(g.anomalies))]
+	g.anomaly = *opp
 	g.applyGenomeKernel(gen)
 	g.seedFromGenome(gen)
 
@@ -579,6 +756,22 @@ func (g *Game) evaluateGenome(gen *Genome) float64 {
 	if meanActivity < 0.01 {
 		score = score * 0.1
 	}
+
+	// reward surviving the anomaly: the share of activity that escaped being devoured
+	var mass float64
+	for y := 0; y < gridH; y++ {
+		for x := 0; x < gridW; x++ {
+			mass += g.A[y][x]
+		}
+	}
+	survival := 1.0
+	if mass+g.devoured > 0 {
+		survival = mass / (mass + g.devoured)
+	}
+	score *= 0.5 + 0.5*survival
+	opp.devouredSum += 1 - survival
+	opp.encounters++
+
 	score *= 1.0 - 0.05*math.Abs(gen.Radius-6.0)/6.0
 	if score < 0 {
 		score = 0
@@ -645,6 +838,19 @@ func (g *Game) Update() error {
 			g.lastEvolveTime = time.Now()
 		}
 	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF) {
+		g.filter.Next()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyP) {
+		g.palettes.Next()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyY) {
+		g.showLyap = !g.showLyap
+		if g.showLyap {
+			g.lorenzLyap = odeLyapunov(&g.lorenz, g.lorenz.method, lyapunovODESteps)
+			fmt.Printf("Lorenz largest Lyapunov exponent %.4f (%s, %d steps)\n", g.lorenzLyap, g.lorenz.method, lyapunovODESteps)
+		}
+	}
 	if ebiten.IsKeyPressed(ebiten.KeyRight) {
 		if time.Since(g.lastEvolveTime) > 200*time.Millisecond {
 			g.currentIndex = (g.currentIndex + 1) % len(g.population)
@@ -701,6 +907,14 @@ func (g *Game) evolveOnce() {
 	sort.Slice(g.population, func(i, j int) bool {
 		return g.population[i].Fitness > g.population[j].Fitness
 	})
+	mean := 0.0
+	for _, gen := range g.population {
+		mean += gen.Fitness
+	}
+	mean /= float64(len(g.population))
+	g.leniaMean = mean
+	g.evolveAnomalies()
+	g.anomaly = g.anomalies[0]
 
 	newPop := make([]Genome, 0, populationSz)
 	for i := 0; i < elitism && i < len(g.population); i++ {
@@ -721,6 +935,86 @@ func (g *Game) evolveOnce() {
 	g.stepCount = 0
 }
 
+// ---------- Anomaly co-evolution ----------
+// evolveAnomalies scores the anomalies from this generation's encounters and breeds the
+// next anomaly population
+func (g *Game) evolveAnomalies() {
+	for i := range g.anomalies {
+		a := &g.anomalies[i]
+		if a.encounters > 0 {
+			a.Fitness = a.devouredSum/float64(a.encounters) - a.upkeep()
+		}
+		a.devouredSum, a.encounters = 0, 0
+	}
+	sort.Slice(g.anomalies, func(i, j int) bool {
+		return g.anomalies[i].Fitness > g.anomalies[j].Fitness
+	})
+	mean := 0.0
+	for _, a := range g.anomalies {
+		mean += a.Fitness
+	}
+	mean /= float64(len(g.anomalies))
+	g.anomalyMean = mean
+
+	next := make([]AnomalyGenome, 0, anomalyPopSz)
+	for i := 0; i < anomalyElitism && i < len(g.anomalies); i++ {
+		next = append(next, g.anomalies[i])
+	}
+	for len(next) < anomalyPopSz {
+		child := crossoverAnomaly(tournamentSelectAnomaly(g.anomalies), tournamentSelectAnomaly(g.anomalies))
+		mutateAnomaly(&child)
+		next = append(next, child)
+	}
+	g.anomalies = next
+	g.anomalyGeneration++
+}
+
+func crossoverAnomaly(a, b AnomalyGenome) AnomalyGenome {
+	child := AnomalyGenome{
+		Radius:       (a.Radius + b.Radius) * 0.5,
+		Strength:     a.Strength,
+		SearchRadius: b.SearchRadius,
+		Speed:        (a.Speed + b.Speed) * 0.5,
+		LorenzCouple: (a.LorenzCouple + b.LorenzCouple) * 0.5,
+	}
+	if rand.Float64() < 0.5 {
+		child.Strength = b.Strength
+	}
+	if rand.Float64() < 0.5 {
+		child.SearchRadius = a.SearchRadius
+	}
+	return child
+}
+
+func mutateAnomaly(a *AnomalyGenome) {
+	if rand.Float64() < anomalyMutationRate {
+		a.Radius = clamp(a.Radius+rand.NormFloat64()*2.0, 3.0, anomalyMaxRadius)
+	}
+	if rand.Float64() < anomalyMutationRate {
+		a.Strength = clamp(a.Strength+rand.NormFloat64()*0.3, 0.05, anomalyMaxStrength)
+	}
+	if rand.Float64() < anomalyMutationRate {
+		a.SearchRadius = clamp(a.SearchRadius+rand.NormFloat64()*6.0, 5.0, 120.0)
+	}
+	if rand.Float64() < anomalyMutationRate {
+		a.Speed = clamp(a.Speed+rand.NormFloat64()*0.2, 0.1, anomalyMaxSpeed)
+	}
+	if rand.Float64() < anomalyMutationRate {
+		a.LorenzCouple = clamp(a.LorenzCouple+rand.NormFloat64()*0.2, 0.0, 3.0)
+	}
+}
+
+func tournamentSelectAnomaly(pop []AnomalyGenome) AnomalyGenome {
+	best := pop[rand.Intn(len(pop))]
+	for i := 0; i < 2; i++ {
+		cand := pop[rand.Intn(len(pop))]
+		if cand.Fitness > best.Fitness {
+			best = cand
+		}
+	}
+	return best
+}
+
 func tournamentSelect(pop []Genome) Genome {
 	best := pop[rand.Intn(len(pop))]
 	for i := 0; i < 2; i++ {
@@ -734,77 +1028,130 @@ func tournamentSelect(pop []Genome) Genome {
 
 // ---------- Draw / display (MODIFIED for Anomaly visualization) ----------
 func (g *Game) Draw(screen *ebiten.Image) {
+	start := g.timer.Begin()
 	bias := g.population[g.currentIndex].ColorBias
-	ax, ay := g.anomalyX, g.anomalyY
-
-	for y := 0; y < gridH; y++ {
-		for x := 0; x < gridW; x++ {
-			v := clamp(g.A[y][x]+bias*0.08, 0, 1)
-			dx := float64(x) - ax
-			dy := float64(y) - ay
-			if dx > float64(gridW/2) {
-				dx -= float64(gridW)
-			} else if dx < float64(-gridW/2) {
-				dx += float64(gridW)
-			}
-			if dy > float64(gridH/2) {
-				dy -= float64(gridH)
-			} else if dy < float64(-gridH/2) {
-				dy += float64(gridH)
-			}
-			dist := math.Hypot(dx, dy)
-
-			localBias := bias
-			if dist < anomalyRadius {
-				localBias += anomalyColorBias
-				v = clamp(g.A[y][x]+localBias*0.08, 0, 1)
+	pal := g.palettes.Current()
+	g.pixels.Fill(g.A, pal, bias)
+	// recolour the cells inside each anomaly, visiting only its bounding square
+	rad := g.anomaly.Radius
+	for _, a := range g.agents {
+		for dy := int(math.Floor(-rad)); dy <= int(math.Ceil(rad)); dy++ {
+			for dx := int(math.Floor(-rad)); dx <= int(math.Ceil(rad)); dx++ {
+				x := int(math.Floor(a.X)) + dx
+				y := int(math.Floor(a.Y)) + dy
+				x, y = (x%gridW+gridW)%gridW, (y%gridH+gridH)%gridH
+				dist := math.Hypot(torusDelta(float64(x)-a.X, gridW), torusDelta(float64(y)-a.Y, gridH))
+				if dist < rad {
+					r, gg, b := pal.Biased(g.A[y][x], bias+anomalyColorBias)
+					g.pixels.SetRGB(x, y, r, gg, b)
+				}
 			}
-
-			r, gg, b := colorRamp(v)
-			g.texture.Set(x, y, color.NRGBA{R: r, G: gg, B: b, A: 0xFF})
 		}
 	}
+	g.texture.WritePixels(g.pixels.Pix)
+	g.timer.End(start)
 
 	op := &ebiten.DrawImageOptions{}
 	op.GeoM.Scale(float64(cellSize), float64(cellSize))
 	op.Filter = ebiten.FilterNearest
 	screen.DrawImage(g.texture, op)
 
+	// agent overlays, colored by behaviour
+	for _, a := range g.agents {
+		c := a.Behaviour.Color()
+		cx, cy := float32(a.X*cellSize), float32(a.Y*cellSize)
+		vector.StrokeCircle(screen, cx, cy, float32(g.anomaly.Radius*cellSize), 2, c, true)
+		vector.StrokeLine(screen, cx, cy, cx+float32(a.VX*cellSize*4), cy+float32(a.VY*cellSize*4), 2, c, true)
+	}
+
 	cur := &g.population[g.currentIndex]
-	txt := fmt.Sprintf("Gen: %d  Index: %d/%d  Fitness(best): %.3f  μ:%.3f σ:%.3f R:%.2f shell:%.2f Δt:%.3f",
-		g.generation, g.currentIndex, len(g.population), g.population[0].Fitness, cur.Mu, cur.Sigma, cur.Radius, cur.ShellSigma, cur.Dt)
+	txt := fmt.Sprintf("Gen: %d  Index: %d/%d  Fitness(best): %.3f mean: %.3f  μ:%.3f σ:%.3f R:%.2f shell:%.2f Δt:%.3f",
+		g.generation, g.currentIndex, len(g.population), g.population[0].Fitness, g.leniaMean, cur.Mu, cur.Sigma, cur.Radius, cur.ShellSigma, cur.Dt)
 	text.Draw(screen, txt, basicfont.Face7x13, 6, 16, color.White)
 
-	help := fmt.Sprintf("Keys: ←/→ switch genome   G evolve once   SPACE toggle auto-evolve   (auto delay %.1fs)    FPS:", g.autoEvolveDelay.Seconds())
+	help := fmt.Sprintf("Keys: ←/→ switch genome   G evolve once   SPACE toggle auto-evolve   F filter   Y lyapunov   (auto delay %.1fs)    FPS:", g.autoEvolveDelay.Seconds())
 	text.Draw(screen, help, basicfont.Face7x13, 6, 32, color.White)
-	fps := fmt.Sprintf("%d", g.lastFPS)
+	fps := fmt.Sprintf("%d    palette: %s    %s", g.lastFPS, pal.Name, &g.timer)
 	text.Draw(screen, fps, basicfont.Face7x13, 6, 48, color.White)
 
-	anomalyPos := fmt.Sprintf("Anomaly Pos: (%.1f, %.1f)  Lorenz Z: %.3f", g.anomalyX, g.anomalyY, g.lorenz.z)
+	counts := map[string]int{}
+	var names []string
+	for _, a := range g.agents {
+		if counts[a.Behaviour.Name()] == 0 {
+			names = append(names, a.Behaviour.Name())
+		}
+		counts[a.Behaviour.Name()]++
+	}
+	for i, n := range names {
+		names[i] = fmt.Sprintf("%s×%d", n, counts[n])
+	}
+	anomalyPos := fmt.Sprintf("Anomalies: %s  Lorenz Z: %.3f  Devoured: %.1f", strings.Join(names, " "), g.lorenz.z, g.devoured)
 	text.Draw(screen, anomalyPos, basicfont.Face7x13, 6, 64, color.White)
+
+	an := g.anomaly
+	anomalyTxt := fmt.Sprintf("Anomaly Gen: %d  Fitness(best): %.3f mean: %.3f  R:%.1f str:%.2f search:%.0f speed:%.2f lorenz:%.2f upkeep:%.3f",
+		g.anomalyGeneration, g.anomalies[0].Fitness, g.anomalyMean, an.Radius, an.Strength, an.SearchRadius, an.Speed, an.LorenzCouple, an.upkeep())
+	text.Draw(screen, anomalyTxt, basicfont.Face7x13, 6, 80, color.White)
+
+	mods := make([]string, len(g.bindings))
+	for i, b := range g.bindings {
+		mods[i] = b.String()
+	}
+	text.Draw(screen, "Mod: "+strings.Join(mods, "  "), basicfont.Face7x13, 6, 96, color.White)
+	text.Draw(screen, "Filter: "+g.filter.String(), basicfont.Face7x13, 6, 112, color.White)
+	if g.showLyap {
+		text.Draw(screen, fmt.Sprintf("Lorenz λ: %+.4f", g.lorenzLyap), basicfont.Face7x13, 6, 128, color.White)
+	}
 }
 
 func (g *Game) Layout(outW, outH int) (int, int) {
 	return gridW * cellSize, gridH * cellSize
 }
 
-// ---------- color ramp (modified to use 5D mapping subtly) ----------
-func colorRamp(v float64) (r, gCol, b uint8) {
-	v = clamp(v, 0, 1)
-	if v < 0.5 {
-		t := v / 0.5
-		return uint8(20 + 50*t), uint8(50 + 150*t), uint8(200 - 100*t)
-	}
-	t := (v - 0.5) / 0.5
-	return uint8(70 + 180*t), uint8(200 - 80*t), uint8(100 + 150*t)
-}
-
 // ---------- main ----------
 func main() {
 	ebiten.SetWindowSize(gridW*cellSize, gridH*cellSize)
 	ebiten.SetWindowTitle("Evolving Lenia-like Artificial Life (Ebiten) - Extended")
 
-	game := NewGame()
+	agentSpec := flag.String("agents", "greedy", "comma-separated anomaly behaviours: greedy, gradient, random, patrol, flock (name*N for several)")
+	modSpec := flag.String("mod", defaultModulation, "parameter bindings param=source[:scale[:offset]], params: mu, sigma, dt (offsets), strength, speed, cutoff (gains)")
+	odeSpec := flag.String("integrator", "euler", "attractor integrator: euler, midpoint, rk4 or rk45 (adaptive)")
+	fieldSpec := flag.String("field", "euler", "field integrator: euler, midpoint or rk4")
+	filterSpec := flag.String("filter", "lowpass@8", "spectral filter kind[:cutoff[:width]][@every], kinds: lowpass, highpass, bandpass, notch, gaussian (without a cutoff it follows the genome radius)")
+	paletteSpec := flag.String("palette", "classic", "colormap: classic, viridis, magma, inferno, cividis, twilight, greyscale or a gradient file")
+	flag.Parse()
+	agents, err := parseAgents(*agentSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if odeMethod, err = parseMethod(*odeSpec); err != nil {
+		log.Fatal(err)
+	}
+	fieldMethod, err := parseMethod(*fieldSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	filter, err := parseFilter(*filterSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	palettes, err := newPaletteCycle(*paletteSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	game := NewGame(agents)
+	game.filter = filter
+	game.palettes = palettes
+	if game.stepper, err = newFieldStepper(fieldMethod); err != nil {
+		log.Fatal(err)
+	}
+	game.bindings, err = parseBindings(*modSpec, game.params())
+	if err != nil {
+		log.Fatal(err)
+	}
 	if err := ebiten.RunGame(game); err != nil {
 		log.Fatal(err)
 	}
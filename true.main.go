@@ -1,7 +1,9 @@
 // lenia_lorenz.go
+// run: go run true.main.go modulator.go integrator.go fftplan.go lyapunov.go palette.go render.go
 package main
 
 import (
+	"flag"
 	"fmt"
 	"image/color"
 	"log"
@@ -10,10 +12,9 @@ import (
 	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/text"
 	"golang.org/x/image/font/basicfont"
-
-	"gonum.org/v1/gonum/dsp/fourier"
 )
 
 // ---------- Simulation parameters ----------
@@ -21,6 +22,11 @@ const (
 	gridW    = 128
 	gridH    = 128
 	cellSize = 4
+
+	errorEvery = 30  // frames between integrator error reports (E key)
+	errorSteps = 100 // attractor steps compared per report
+
+	lyapunovODESteps = 20000 // attractor steps per exponent estimate (Y key)
 )
 
 // ---------- Genome ----------
@@ -30,47 +36,51 @@ type Genome struct {
 }
 
 // ---------- Kernel ----------
+// buildKernel returns the ring kernel normalized to sum 1, centred on cell (0, 0) with
+// negative offsets wrapped, so FFT convolution leaves the field in place
 func buildKernel(R float64) [][]float64 {
 	kernel := make([][]float64, gridH)
 	for y := 0; y < gridH; y++ {
 		kernel[y] = make([]float64, gridW)
 	}
 	shellSigma := 0.15
-	cx, cy := gridW/2, gridH/2
+	var sum float64
 	for y := 0; y < gridH; y++ {
 		for x := 0; x < gridW; x++ {
-			dx := float64(x - cx)
-			dy := float64(y - cy)
+			dx := float64(x)
+			if x > gridW/2 {
+				dx -= gridW
+			}
+			dy := float64(y)
+			if y > gridH/2 {
+				dy -= gridH
+			}
 			dist := math.Hypot(dx, dy)
 			if dist <= R {
 				rn := dist / R
 				val := math.Exp(-0.5 * math.Pow((rn-0.5)/shellSigma, 2))
 				kernel[y][x] = val
+				sum += val
 			}
 		}
 	}
+	for y := 0; y < gridH; y++ {
+		for x := 0; x < gridW; x++ {
+			kernel[y][x] /= sum
+		}
+	}
 	return kernel
 }
 
-// ---------- Lorenz Attractor ----------
-type Lorenz struct {
-	x, y, z       float64
-	sigma, rho, b float64
-	dt            float64
-}
-
-func NewLorenz() *Lorenz {
-	return &Lorenz{x: 0.1, y: 0, z: 0, sigma: 10, rho: 28, b: 8.0 / 3.0, dt: 0.01}
-}
-
-func (l *Lorenz) Step() {
-	dx := l.sigma * (l.y - l.x)
-	dy := l.x*(l.rho-l.z) - l.y
-	dz := l.x*l.y - l.b*l.z
-	l.x += dx * l.dt
-	l.y += dy * l.dt
-	l.z += dz * l.dt
-}
+// ---------- Modulation ----------
+// defaultModulation keeps the original Lorenz wiring, x to μ, y to σ and z to the color
+// bias, but binds the parameters to the attractor instead of letting them drift: the old
+// step added 0.002·tanh(x/20) to μ and scaled σ by 1+0.001·y, so both wandered until
+// clamped, while these bindings hold μ within 0.3±0.05 and σ within 0.06±0.01. The color
+// bias spans about the old tanh(z/30) range in field units; 1.25:1 is 0.5:0.4 scaled by
+// 2.5 since the palette shifts 0.08 per unit of bias where colorRamp shifted 0.2.
+// Override with -mod.
+const defaultModulation = "mu=lorenz.x:0.05:0.3,sigma=lorenz.y:0.01:0.06,colorbias=lorenz.z:1.25:1"
 
 // ---------- Game ----------
 type Game struct {
@@ -78,11 +88,31 @@ type Game struct {
 	Anext   [][]float64
 	genome  Genome
 	texture *ebiten.Image
+	pixels  *FieldPixels
+	timer   FrameTimer
 
-	fft2d     *fourier.FFT2
+	fft2d     *FFT2Plan
 	kernelFFT []complex128
+	spectrum  []complex128
+
+	bindings []*Binding
+	stepper  *fieldStepper
+
+	// integrator error report
+	showErrors bool
+	fieldErr   [RK4 + 1]float64
+	odeErr     [len(methodNames)]float64
+	odeSource  string
+
+	// Lyapunov exponents (Y key): the field from a perturbed twin, nil when off, and the
+	// first attractor that drives a binding
+	lyap            *Lyapunov
+	twinA, twinNext [][]float64
+	odeLyap         float64
+	lyapSource      string
+
+	palettes *PaletteCycle // P key
 
-	lorenz  *Lorenz
 	frame   int
 	start   time.Time
 	lastFPS int
@@ -112,24 +142,34 @@ func NewGame() *Game {
 		}
 	}
 
-	fft2d := fourier.NewFFT2(gridH, gridW)
-	kernel := buildKernel(6)
-	kernelFlat := flatten(kernel)
-	kernelFFT := fft2d.Coefficients(nil, kernelFlat)
+	fft2d := newFFT2Plan(gridW, gridH)
+	kernelFFT := flatten(buildKernel(6))
+	fft2d.Transform(kernelFFT, false)
 
 	return &Game{
 		A:       A,
 		Anext:   Anext,
 		genome:  Genome{Mu: 0.3, Sigma: 0.06, Dt: 0.08, ColorBias: 0},
 		texture: ebiten.NewImage(gridW, gridH),
+		pixels:  newFieldPixels(gridW, gridH),
 
 		fft2d:     fft2d,
 		kernelFFT: kernelFFT,
-		lorenz:    NewLorenz(),
+		spectrum:  make([]complex128, gridW*gridH),
 		start:     time.Now(),
 	}
 }
 
+// params exposes the parameters that modulators can be bound to
+func (g *Game) params() map[string]*float64 {
+	return map[string]*float64{
+		"mu":        &g.genome.Mu,
+		"sigma":     &g.genome.Sigma,
+		"dt":        &g.genome.Dt,
+		"colorbias": &g.genome.ColorBias,
+	}
+}
+
 // ---------- Helpers ----------
 func flatten(m [][]float64) []complex128 {
 	out := make([]complex128, len(m)*len(m[0]))
@@ -143,19 +183,6 @@ func flatten(m [][]float64) []complex128 {
 	return out
 }
 
-func reshape(data []complex128) [][]float64 {
-	out := make([][]float64, gridH)
-	idx := 0
-	for y := 0; y < gridH; y++ {
-		out[y] = make([]float64, gridW)
-		for x := 0; x < gridW; x++ {
-			out[y][x] = real(data[idx])
-			idx++
-		}
-	}
-	return out
-}
-
 func clamp(v, lo, hi float64) float64 {
 	if v < lo {
 		return lo
@@ -175,36 +202,107 @@ func growth(u, mu, sigma float64) float64 {
 }
 
 // ---------- Step ----------
-func (g *Game) step() {
+// rate writes the growth G(K*A) of the lattice src into dst
+func (g *Game) rate(src, dst [][]float64) {
 	// FFT convolution
-	stateFFT := g.fft2d.Coefficients(nil, flatten(g.A))
-	for i := range stateFFT {
-		stateFFT[i] *= g.kernelFFT[i]
+	F := g.spectrum
+	for y := 0; y < gridH; y++ {
+		for x := 0; x < gridW; x++ {
+			F[y*gridW+x] = complex(src[y][x], 0)
+		}
 	}
-	conv := g.fft2d.Sequence(nil, stateFFT)
-	U := reshape(conv)
-
-	// Lorenz modulation
-	g.lorenz.Step()
-	g.genome.Mu = clamp(g.genome.Mu+0.002*math.Tanh(g.lorenz.x/20), 0.01, 1.0)
-	g.genome.Sigma = clamp(g.genome.Sigma*(1+0.001*g.lorenz.y), 0.001, 1.0)
-	g.genome.ColorBias = math.Tanh(g.lorenz.z / 30)
+	g.fft2d.Transform(F, false)
+	for i := range F {
+		F[i] *= g.kernelFFT[i]
+	}
+	g.fft2d.Transform(F, true)
 
-	// Update grid
+	norm := 1 / float64(gridW*gridH)
 	for y := 0; y < gridH; y++ {
 		for x := 0; x < gridW; x++ {
-			u := U[y][x]
-			grow := growth(u, g.genome.Mu, g.genome.Sigma)
-			val := g.A[y][x] + g.genome.Dt*grow
-			g.Anext[y][x] = clamp(val, 0, 1)
+			u := real(F[y*gridW+x]) * norm
+			dst[y][x] = growth(u, g.genome.Mu, g.genome.Sigma)
 		}
 	}
+}
+
+func (g *Game) step() {
+	// parameter modulation
+	stepBindings(g.bindings)
+	g.genome.Mu = clamp(g.genome.Mu, 0.01, 1.0)
+	g.genome.Sigma = clamp(g.genome.Sigma, 0.001, 1.0)
+	g.genome.Dt = clamp(g.genome.Dt, 0.001, 1.0)
+
+	// Update grid
+	g.stepper.step(g.A, g.Anext, g.genome.Dt, g.rate)
 	g.A, g.Anext = g.Anext, g.A
+
+	if g.lyap != nil {
+		g.stepper.step(g.twinA, g.twinNext, g.genome.Dt, g.rate)
+		g.twinA, g.twinNext = g.twinNext, g.twinA
+		g.lyap.Dt = g.genome.Dt
+		g.lyap.Advance(func() float64 { return fieldDistance(g.twinA, g.A) },
+			func(f float64) { fieldRescale(g.twinA, g.A, f) })
+	}
+}
+
+// startLyapunov starts a perturbed twin of the field and estimates the exponent of the
+// first attractor that drives a binding
+func (g *Game) startLyapunov() {
+	g.twinA, g.twinNext = newLattice(gridH, gridW), newLattice(gridH, gridW)
+	perturbField(g.twinA, g.A, fieldD0, rand.New(rand.NewSource(time.Now().UnixNano())))
+	g.lyap = newLyapunov(fieldD0, g.genome.Dt, lyapunovEvery)
+
+	g.lyapSource = ""
+	for _, b := range g.bindings {
+		if sys, ok := b.Mod.(odeSystem); ok {
+			g.odeLyap = odeLyapunov(sys, odeMethod, lyapunovODESteps)
+			g.lyapSource = b.Source
+			fmt.Printf("%s largest Lyapunov exponent %.4f (%s, %d steps)\n", b.Source, g.odeLyap, odeMethod, lyapunovODESteps)
+			break
+		}
+	}
+}
+
+// reportErrors compares every integrator against a reference on the current field and
+// on the first attractor that drives a binding
+func (g *Game) reportErrors() {
+	g.fieldErr = compareField(g.A, g.genome.Dt, g.rate)
+	fmt.Printf("field Δt=%.3f  rms error euler %.2e  midpoint %.2e  rk4 %.2e\n",
+		g.genome.Dt, g.fieldErr[Euler], g.fieldErr[Midpoint], g.fieldErr[RK4])
+
+	g.odeSource = ""
+	for _, b := range g.bindings {
+		if sys, ok := b.Mod.(odeSystem); ok {
+			g.odeErr = compareODE(sys, errorSteps)
+			g.odeSource = b.Source
+			fmt.Printf("%s over %d steps  error euler %.2e  midpoint %.2e  rk4 %.2e  rk45 %.2e\n",
+				b.Source, errorSteps, g.odeErr[Euler], g.odeErr[Midpoint], g.odeErr[RK4], g.odeErr[RK45])
+			break
+		}
+	}
 }
 
 // ---------- Ebiten interface ----------
 func (g *Game) Update() error {
+	if inpututil.IsKeyJustPressed(ebiten.KeyE) {
+		g.showErrors = !g.showErrors
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyP) {
+		g.palettes.Next()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyY) {
+		if g.lyap == nil {
+			g.startLyapunov()
+		} else {
+			g.lyap = nil
+		}
+	}
+
 	g.step()
+	if g.showErrors && g.frame%errorEvery == 0 {
+		g.reportErrors()
+	}
 	g.frame++
 	if g.frame%30 == 0 {
 		elapsed := time.Since(g.start).Seconds()
@@ -214,42 +312,83 @@ func (g *Game) Update() error {
 }
 
 func (g *Game) Draw(screen *ebiten.Image) {
-	for y := 0; y < gridH; y++ {
-		for x := 0; x < gridW; x++ {
-			v := g.A[y][x]
-			r, gg, b := colorRamp(v + g.genome.ColorBias*0.2)
-			g.texture.Set(x, y, color.NRGBA{R: r, G: gg, B: b, A: 0xFF})
-		}
-	}
+	start := g.timer.Begin()
+	pal := g.palettes.Current()
+	g.pixels.Fill(g.A, pal, g.genome.ColorBias)
+	g.texture.WritePixels(g.pixels.Pix)
+	g.timer.End(start)
 	op := &ebiten.DrawImageOptions{}
 	op.GeoM.Scale(float64(cellSize), float64(cellSize))
 	screen.DrawImage(g.texture, op)
 
-	txt := fmt.Sprintf("μ: %.3f σ: %.3f Δt: %.3f FPS: %d", g.genome.Mu, g.genome.Sigma, g.genome.Dt, g.lastFPS)
+	txt := fmt.Sprintf("μ: %.3f σ: %.3f Δt: %.3f FPS: %d  field: %s  palette: %s  (E: integrator errors, Y: lyapunov, P: palette)",
+		g.genome.Mu, g.genome.Sigma, g.genome.Dt, g.lastFPS, g.stepper.Method, pal.Name)
 	text.Draw(screen, txt, basicfont.Face7x13, 6, 18, color.White)
+
+	text.Draw(screen, g.timer.String(), basicfont.Face7x13, 6, 34, color.White)
+
+	y := 50
+	for _, b := range g.bindings {
+		text.Draw(screen, b.String(), basicfont.Face7x13, 6, y, color.White)
+		y += 16
+	}
+
+	if g.showErrors {
+		fe := fmt.Sprintf("field rms err  euler %.1e  mid %.1e  rk4 %.1e", g.fieldErr[Euler], g.fieldErr[Midpoint], g.fieldErr[RK4])
+		text.Draw(screen, fe, basicfont.Face7x13, 6, y, color.White)
+		if g.odeSource != "" {
+			oe := fmt.Sprintf("%s err  euler %.1e  mid %.1e  rk4 %.1e  rk45 %.1e",
+				g.odeSource, g.odeErr[Euler], g.odeErr[Midpoint], g.odeErr[RK4], g.odeErr[RK45])
+			text.Draw(screen, oe, basicfont.Face7x13, 6, y+16, color.White)
+		}
+		y += 32
+	}
+
+	if g.lyap != nil {
+		text.Draw(screen, "field "+g.lyap.String(), basicfont.Face7x13, 6, y, color.White)
+		if g.lyapSource != "" {
+			text.Draw(screen, fmt.Sprintf("%s λ: %+.4f", g.lyapSource, g.odeLyap), basicfont.Face7x13, 6, y+16, color.White)
+		}
+	}
 }
 
 func (g *Game) Layout(outW, outH int) (int, int) {
 	return gridW * cellSize, gridH * cellSize
 }
 
-// ---------- Color ----------
-func colorRamp(v float64) (r, g, b uint8) {
-	v = clamp(v, 0, 1)
-	if v < 0.5 {
-		t := v / 0.5
-		return uint8(20 + 50*t), uint8(50 + 150*t), uint8(200 - 100*t)
-	}
-	t := (v - 0.5) / 0.5
-	return uint8(70 + 180*t), uint8(200 - 80*t), uint8(100 + 150*t)
-}
-
 // ---------- Main ----------
 func main() {
 	ebiten.SetWindowSize(gridW*cellSize, gridH*cellSize)
 	ebiten.SetWindowTitle("Lenia + Lorenz Artificial Life")
 
+	modSpec := flag.String("mod", defaultModulation, "parameter modulation: param=source[:scale[:offset]],... (params: mu, sigma, dt, colorbias; sources: lorenz, rossler, chua[.x|.y|.z][@dt], logistic[@r], sine[@freq], noise[@theta])")
+	odeSpec := flag.String("integrator", "euler", "attractor integrator: euler, midpoint, rk4 or rk45 (adaptive)")
+	fieldSpec := flag.String("field", "euler", "field integrator: euler, midpoint or rk4")
+	paletteSpec := flag.String("palette", "classic", "colormap: classic, viridis, magma, inferno, cividis, twilight, greyscale or a gradient file")
+	flag.Parse()
+
+	palettes, err := newPaletteCycle(*paletteSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if odeMethod, err = parseMethod(*odeSpec); err != nil {
+		log.Fatal(err)
+	}
+	fieldMethod, err := parseMethod(*fieldSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	game := NewGame()
+	game.palettes = palettes
+	if game.stepper, err = newFieldStepper(fieldMethod); err != nil {
+		log.Fatal(err)
+	}
+	bindings, err := parseBindings(*modSpec, game.params())
+	if err != nil {
+		log.Fatal(err)
+	}
+	game.bindings = bindings
 	if err := ebiten.RunGame(game); err != nil {
 		log.Fatal(err)
 	}
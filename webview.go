@@ -0,0 +1,342 @@
+// webview.go
+//
+// A browser viewer for simulations on headless machines: an embedded HTTP server streams
+// the frames a program publishes as MJPEG, shows its HUD lines next to them and sends key
+// presses and mouse clicks back, so the program's own controls work from the page.
+// Keys are named by the browser's KeyboardEvent.code ("KeyG", "Space", "ArrowLeft") and
+// clicks and wheel turns carry positions relative to the frame, in [0, 1).
+// There is no authentication: anyone who can reach the address can watch and steer the
+// program, so listen on 127.0.0.1:8080 (and tunnel it, e.g. ssh -L 8080:127.0.0.1:8080)
+// rather than :8080 on shared networks. Events must be posted as application/json, which
+// browsers only send cross-origin after a CORS preflight that this server never grants,
+// so other web pages cannot inject input.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	webKeyHold   = time.Second // a key without a repeated keydown for this long counts as released
+	webMaxClicks = 64          // clicks or wheel turns queued between two polls
+)
+
+// WebView serves the published frames and collects the browser's input
+type WebView struct {
+	Addr     string // listen address, "" for no server
+	FPS      int    // frames streamed per second at most
+	Quality  int    // JPEG quality
+	Headless bool   // run without a window; the program drives its own loop
+
+	mu      sync.Mutex
+	frame   []byte // latest JPEG
+	last    time.Time
+	clients map[chan []byte]bool
+	hud     []string
+	keys    map[string]*webKey
+	clicks  []WebClick
+	scrolls []WebScroll
+}
+
+type webKey struct {
+	down    bool
+	pressed bool // a keydown not yet seen by Pressed or JustPressed, so short taps are not lost
+	at      time.Time
+}
+
+// WebClick is a mouse button pressed on the frame
+type WebClick struct {
+	X, Y   float64 // position relative to the frame, in [0, 1)
+	Button int     // 0 left, 1 middle, 2 right
+}
+
+// WebScroll is a mouse wheel turn over the frame
+type WebScroll struct {
+	X, Y float64 // position relative to the frame, in [0, 1)
+	DY   float64 // +1 away from the user, -1 towards, like ebiten.Wheel
+}
+
+// newWebViewFlags registers the web viewer flags and returns the WebView they fill in
+// once flag.Parse has run
+func newWebViewFlags() *WebView {
+	v := &WebView{}
+	flag.StringVar(&v.Addr, "web", "", "serve a browser viewer on this address, e.g. 127.0.0.1:8080 (no authentication)")
+	flag.IntVar(&v.FPS, "web-fps", 15, "frames per second streamed to the browser")
+	flag.IntVar(&v.Quality, "web-quality", 80, "JPEG quality of streamed frames")
+	flag.BoolVar(&v.Headless, "web-headless", false, "run without a window, only the web viewer (needs -web)")
+	return v
+}
+
+// Enabled reports whether the server was asked for
+func (v *WebView) Enabled() bool { return v.Addr != "" }
+
+// Start listens on Addr and serves the viewer in the background
+func (v *WebView) Start() error {
+	if v.FPS < 1 {
+		v.FPS = 1
+	}
+	v.clients = map[chan []byte]bool{}
+	v.keys = map[string]*webKey{}
+	ln, err := net.Listen("tcp", v.Addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", v.servePage)
+	mux.HandleFunc("/stream", v.serveStream)
+	mux.HandleFunc("/hud", v.serveHUD)
+	mux.HandleFunc("/event", v.serveEvent)
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			log.Printf("web: %v", err)
+		}
+	}()
+	log.Printf("web viewer on http://%s/", ln.Addr())
+	return nil
+}
+
+// ---------- Program side ----------
+// Wanted reports whether a browser is watching and the next frame is due, so programs
+// only prepare frames that will be sent
+func (v *WebView) Wanted() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return len(v.clients) > 0 && time.Since(v.last) >= time.Second/time.Duration(v.FPS)
+}
+
+// Publish encodes img and sends it to every browser. img may be reused once it returns.
+func (v *WebView) Publish(img image.Image) {
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: v.Quality}); err != nil {
+		log.Printf("web: %v", err)
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.frame, v.last = b.Bytes(), time.Now()
+	for c := range v.clients {
+		// a browser still receiving the previous frame skips this one
+		select {
+		case c <- v.frame:
+		default:
+		}
+	}
+}
+
+// SetHUD replaces the text lines shown under the frame
+func (v *WebView) SetHUD(lines ...string) {
+	v.mu.Lock()
+	v.hud = append(v.hud[:0], lines...)
+	v.mu.Unlock()
+}
+
+// Pressed reports whether the key with the given KeyboardEvent.code is held in a browser
+// or was pressed since the last call
+func (v *WebView) Pressed(code string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	k := v.keys[code]
+	if k == nil {
+		return false
+	}
+	if k.down && time.Since(k.at) > webKeyHold {
+		k.down = false
+	}
+	p := k.down || k.pressed
+	k.pressed = false
+	return p
+}
+
+// JustPressed reports whether the key was pressed since the last call, for toggles that
+// must not repeat while the key is held
+func (v *WebView) JustPressed(code string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	k := v.keys[code]
+	if k == nil {
+		return false
+	}
+	p := k.pressed
+	k.pressed = false
+	return p
+}
+
+// Clicks returns the clicks since the last call
+func (v *WebView) Clicks() []WebClick {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c := v.clicks
+	v.clicks = nil
+	return c
+}
+
+// Scrolls returns the wheel turns since the last call
+func (v *WebView) Scrolls() []WebScroll {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s := v.scrolls
+	v.scrolls = nil
+	return s
+}
+
+// ---------- HTTP side ----------
+func (v *WebView) serveStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	c := make(chan []byte, 1)
+	v.mu.Lock()
+	v.clients[c] = true
+	if v.frame != nil {
+		c <- v.frame
+	}
+	v.mu.Unlock()
+	defer func() {
+		v.mu.Lock()
+		delete(v.clients, c)
+		v.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=frame")
+	w.Header().Set("Cache-Control", "no-cache")
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case f := <-c:
+			fmt.Fprintf(w, "--frame\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(f))
+			if _, err := w.Write(f); err != nil {
+				return
+			}
+			fmt.Fprint(w, "\r\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func (v *WebView) serveHUD(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	lines := append([]string(nil), v.hud...)
+	v.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lines)
+}
+
+// webEvent is what the page posts to /event
+type webEvent struct {
+	Type   string  `json:"type"` // keydown, keyup, click or wheel
+	Code   string  `json:"code"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Button int     `json:"button"`
+	DY     float64 `json:"dy"`
+}
+
+func (v *WebView) serveEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST an event", http.StatusMethodNotAllowed)
+		return
+	}
+	if t, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); t != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	var e webEvent
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&e); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	switch e.Type {
+	case "keydown", "keyup":
+		k := v.keys[e.Code]
+		if k == nil {
+			k = &webKey{}
+			v.keys[e.Code] = k
+		}
+		k.down = e.Type == "keydown"
+		if k.down {
+			k.pressed, k.at = true, time.Now()
+		}
+	case "click":
+		if len(v.clicks) < webMaxClicks {
+			v.clicks = append(v.clicks, WebClick{e.X, e.Y, e.Button})
+		}
+	case "wheel":
+		if len(v.scrolls) < webMaxClicks {
+			v.scrolls = append(v.scrolls, WebScroll{e.X, e.Y, e.DY})
+		}
+	default:
+		http.Error(w, "unknown event "+e.Type, http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (v *WebView) servePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, webPage)
+}
+
+// webPage shows the stream scaled to the window, polls the HUD and posts input events.
+// Keys the page would otherwise use itself (arrows, space) are kept from it.
+const webPage = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>simulation</title>
+<style>
+body { margin: 0; background: #111; color: #ddd; font: 13px monospace; }
+img { display: block; width: 100%; max-height: 85vh; object-fit: contain; image-rendering: pixelated; cursor: crosshair; }
+pre { margin: 8px; white-space: pre-wrap; }
+</style></head>
+<body>
+<img id="view" src="/stream" alt="waiting for frames">
+<pre id="hud"></pre>
+<script>
+const view = document.getElementById("view"), hud = document.getElementById("hud");
+const send = e => fetch("/event", {method: "POST", headers: {"Content-Type": "application/json"}, body: JSON.stringify(e)});
+const held = new Set();
+addEventListener("keydown", e => {
+	if (["Space", "ArrowLeft", "ArrowRight", "ArrowUp", "ArrowDown"].includes(e.code)) e.preventDefault();
+	held.add(e.code);
+	send({type: "keydown", code: e.code});
+});
+addEventListener("keyup", e => { held.delete(e.code); send({type: "keyup", code: e.code}); });
+addEventListener("blur", () => { held.forEach(code => send({type: "keyup", code})); held.clear(); });
+view.addEventListener("contextmenu", e => e.preventDefault());
+// pos is the mouse position relative to the frame, which object-fit letterboxes inside the element
+const pos = e => {
+	const r = view.getBoundingClientRect(), s = Math.min(r.width / view.naturalWidth, r.height / view.naturalHeight);
+	const w = view.naturalWidth * s, h = view.naturalHeight * s;
+	const x = (e.clientX - r.left - (r.width - w) / 2) / w, y = (e.clientY - r.top - (r.height - h) / 2) / h;
+	return x >= 0 && x < 1 && y >= 0 && y < 1 ? {x, y} : null;
+};
+view.addEventListener("mousedown", e => {
+	const p = pos(e);
+	if (p) send({type: "click", ...p, button: e.button});
+});
+view.addEventListener("wheel", e => {
+	e.preventDefault();
+	const p = pos(e);
+	if (p && e.deltaY) send({type: "wheel", ...p, dy: -Math.sign(e.deltaY)});
+}, {passive: false});
+setInterval(() => fetch("/hud").then(r => r.json()).then(l => { hud.textContent = (l || []).join("\n"); }), 500);
+</script>
+</body></html>
+`